@@ -0,0 +1,340 @@
+// Package bot builds chat bots on top of client.Client
+// A bot registers handlers for prefixed commands such as "!deploy prod", replies in
+// the room the command came from (or by private message), runs scheduled tasks and
+// keeps a small key/value state that a Store persists between runs
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"tcp_server/client"
+	"tcp_server/protocol"
+	"time"
+)
+
+// eventBuffer is how many events may wait for the bot before new ones are dropped
+const eventBuffer = 256
+
+// Handler runs a command; a returned error is sent back to the caller
+type Handler func(ctx *Context) error
+
+// Task is a scheduled job; a returned error is logged
+type Task func(ctx context.Context, b *Bot) error
+
+// Context describes the command being handled
+type Context struct {
+	context.Context
+	Bot     *Bot
+	Command string             // Command name without the prefix, e.g. "deploy"
+	Args    string             // Everything after the command name
+	From    string             // User who sent the command
+	Room    string             // Room the command was sent in ("" = lobby)
+	Private bool               // The command came as a private message
+	Event   *protocol.Response // The message event itself
+}
+
+// Fields splits the arguments on whitespace
+func (c *Context) Fields() []string {
+	return strings.Fields(c.Args)
+}
+
+// Reply answers where the command came from: the same room, or privately
+func (c *Context) Reply(text string) error {
+	if c.Private {
+		return c.Bot.Whisper(c.From, text)
+	}
+	return c.Bot.Say(c.Room, text)
+}
+
+// Whisper answers the caller privately
+func (c *Context) Whisper(text string) error {
+	return c.Bot.Whisper(c.From, text)
+}
+
+// command is a registered handler with its help text
+type command struct {
+	help    string
+	handler Handler
+}
+
+// task is a scheduled job with its interval
+type task struct {
+	interval time.Duration
+	run      Task
+}
+
+// Option configures a Bot
+type Option func(*Bot)
+
+// WithPrefix sets the prefix that marks a message as a command (default "!")
+func WithPrefix(prefix string) Option {
+	return func(b *Bot) {
+		b.prefix = prefix
+	}
+}
+
+// WithRooms joins rooms after registering, so commands sent there reach the bot
+// Commands sent in the lobby and by private message always do
+func WithRooms(rooms ...string) Option {
+	return func(b *Bot) {
+		b.rooms = append(b.rooms, rooms...)
+	}
+}
+
+// WithStore loads the bot's state from store on start and saves it after changes
+func WithStore(store Store) Option {
+	return func(b *Bot) {
+		b.store = store
+	}
+}
+
+// WithLogger sets the logger for the bot and its client (default slog.Default())
+func WithLogger(logger *slog.Logger) Option {
+	return func(b *Bot) {
+		b.logger = logger
+	}
+}
+
+// WithClientOptions passes options to the underlying client, e.g. client.WithReconnect
+func WithClientOptions(opts ...client.Option) Option {
+	return func(b *Bot) {
+		b.clientOpts = append(b.clientOpts, opts...)
+	}
+}
+
+// Bot is a chat bot
+type Bot struct {
+	address    string
+	name       string
+	prefix     string
+	rooms      []string
+	store      Store
+	logger     *slog.Logger
+	clientOpts []client.Option
+
+	commands map[string]command
+	tasks    []task
+
+	client *client.Client
+	events chan *protocol.Response
+
+	stateMu sync.Mutex
+	state   map[string]string
+	dirty   bool
+
+	running sync.WaitGroup // Handlers and tasks in progress
+}
+
+// New creates a bot that will connect to address as name
+func New(address, name string, opts ...Option) *Bot {
+	b := &Bot{
+		address:  address,
+		name:     name,
+		prefix:   "!",
+		logger:   slog.Default(),
+		commands: make(map[string]command),
+		events:   make(chan *protocol.Response, eventBuffer),
+		state:    make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.Handle("help", "List commands", b.handleHelp)
+	return b
+}
+
+// Name returns the bot's username
+func (b *Bot) Name() string {
+	return b.name
+}
+
+// Handle registers a command handler; names are case-insensitive and given without the prefix
+func (b *Bot) Handle(name, help string, handler Handler) {
+	b.commands[strings.ToLower(name)] = command{help: help, handler: handler}
+}
+
+// Every runs a task each interval while the bot is running
+func (b *Bot) Every(interval time.Duration, run Task) {
+	b.tasks = append(b.tasks, task{interval: interval, run: run})
+}
+
+// Run connects, registers, joins the rooms and handles commands until ctx is done
+func (b *Bot) Run(ctx context.Context) error {
+	if err := b.loadState(); err != nil {
+		return err
+	}
+
+	opts := append([]client.Option{
+		client.WithLogger(b.logger),
+		client.WithEventHandler(b.queueEvent),
+	}, b.clientOpts...)
+	b.client = client.NewClient(b.address, opts...)
+
+	if err := b.client.Connect(); err != nil {
+		return err
+	}
+	defer b.client.Close()
+
+	if err := b.client.Register(b.name); err != nil {
+		return err
+	}
+	for _, room := range b.rooms {
+		if err := b.call(protocol.CmdJoinRoom, room); err != nil {
+			return fmt.Errorf("join %s: %w", room, err)
+		}
+	}
+
+	listening := make(chan struct{})
+	defer close(listening)
+	go b.client.StartListening(listening)
+
+	for _, t := range b.tasks {
+		b.running.Add(1)
+		go b.runTask(ctx, t)
+	}
+
+	b.logger.Info("bot started", "name", b.name, "commands", len(b.commands), "tasks", len(b.tasks))
+	for {
+		select {
+		case <-ctx.Done():
+			b.running.Wait()
+			b.client.Quit()
+			return b.saveState()
+		case event := <-b.events:
+			b.dispatch(ctx, event)
+		}
+	}
+}
+
+// queueEvent hands events from the client to the bot without blocking the client
+func (b *Bot) queueEvent(event *protocol.Response) {
+	select {
+	case b.events <- event:
+	default:
+		b.logger.Warn("bot is too slow, event dropped", "event", event.Event)
+	}
+}
+
+// dispatch starts the handler for a command message
+func (b *Bot) dispatch(ctx context.Context, event *protocol.Response) {
+	if event.From == b.name {
+		return
+	}
+
+	var private bool
+	switch event.Event {
+	case protocol.EventMessage:
+	case protocol.EventPrivateMessage:
+		private = true
+	default:
+		return
+	}
+
+	text, ok := strings.CutPrefix(strings.TrimSpace(event.Data), b.prefix)
+	if !ok || text == "" {
+		return
+	}
+	name, args, _ := strings.Cut(text, " ")
+
+	cmdCtx := &Context{
+		Context: ctx,
+		Bot:     b,
+		Command: strings.ToLower(name),
+		Args:    strings.TrimSpace(args),
+		From:    event.From,
+		Room:    event.Room,
+		Private: private,
+		Event:   event,
+	}
+
+	cmd, ok := b.commands[cmdCtx.Command]
+	if !ok {
+		cmdCtx.Reply(fmt.Sprintf("Unknown command %s%s, try %shelp", b.prefix, name, b.prefix))
+		return
+	}
+
+	b.running.Add(1)
+	go func() {
+		defer b.running.Done()
+		defer b.saveIfDirty()
+		defer func() {
+			if r := recover(); r != nil {
+				b.logger.Error("bot command panicked", "command", cmdCtx.Command, "panic", r)
+				cmdCtx.Reply(fmt.Sprintf("%s%s failed", b.prefix, cmdCtx.Command))
+			}
+		}()
+
+		if err := cmd.handler(cmdCtx); err != nil {
+			b.logger.Warn("bot command failed", "command", cmdCtx.Command, "from", cmdCtx.From, "error", err)
+			cmdCtx.Reply(fmt.Sprintf("%s%s failed: %v", b.prefix, cmdCtx.Command, err))
+		}
+	}()
+}
+
+// runTask runs a scheduled task each interval until ctx is done
+func (b *Bot) runTask(ctx context.Context, t task) {
+	defer b.running.Done()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.run(ctx, b); err != nil {
+				b.logger.Warn("bot task failed", "error", err)
+			}
+			b.saveIfDirty()
+		}
+	}
+}
+
+// handleHelp lists the registered commands
+func (b *Bot) handleHelp(ctx *Context) error {
+	names := make([]string, 0, len(b.commands))
+	for name := range b.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = fmt.Sprintf("%s%s - %s", b.prefix, name, b.commands[name].help)
+	}
+	return ctx.Reply(strings.Join(lines, "\n"))
+}
+
+// Say posts a message to a room ("" = lobby) without changing the session's active room
+func (b *Bot) Say(room, text string) error {
+	if room == "" {
+		room = "lobby"
+	}
+	return b.call(protocol.CmdSay, room+" "+text)
+}
+
+// Whisper sends a private message to a user
+func (b *Bot) Whisper(user, text string) error {
+	return b.call(protocol.CmdPrivateMessage, user+":"+text)
+}
+
+// call sends a command and turns a failed response into an error
+func (b *Bot) call(command, data string) error {
+	if b.client == nil {
+		return errors.New("bot is not running")
+	}
+	response, err := b.client.SendMessage(command, data)
+	if err != nil {
+		return err
+	}
+	if !response.Success {
+		return fmt.Errorf("%s: %s", command, response.Message)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"tcp_server/client"
+	"tcp_server/protocol"
+	"tcp_server/server"
+	"testing"
+	"time"
+)
+
+// startServer runs a server on a free loopback address until the test ends
+func startServer(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	s := server.NewServer(address, server.WithLogger(slog.New(slog.DiscardHandler)))
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+			return address
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// user is a plain chat client that collects the events it receives
+type user struct {
+	*client.Client
+	events chan *protocol.Response
+}
+
+func newUser(t *testing.T, address, name string) *user {
+	t.Helper()
+
+	u := &user{events: make(chan *protocol.Response, 64)}
+	u.Client = client.NewClient(address,
+		client.WithLogger(slog.New(slog.DiscardHandler)),
+		client.WithEventHandler(func(event *protocol.Response) { u.events <- event }),
+	)
+	if err := u.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(func() { u.Close() })
+	if err := u.Register(name); err != nil {
+		t.Fatalf("Register(%s) error = %v", name, err)
+	}
+
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go u.StartListening(done)
+	return u
+}
+
+// send runs a command and fails the test if the server rejects it
+func (u *user) send(t *testing.T, command, data string) {
+	t.Helper()
+	response, err := u.SendMessage(command, data)
+	if err != nil || !response.Success {
+		t.Fatalf("%s %q = %+v, %v", command, data, response, err)
+	}
+}
+
+// expect waits for an event of a type from the bot and checks its room and text
+func (u *user) expect(t *testing.T, event, room, contains string) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case e := <-u.events:
+			if e.From != "bot" || e.Event != event {
+				continue
+			}
+			if e.Room != room || !strings.Contains(e.Data, contains) {
+				t.Fatalf("Got %s in %q: %q, want %q containing %q", event, e.Room, e.Data, room, contains)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %s containing %q", event, contains)
+		}
+	}
+}
+
+// runBot runs b until the test ends and waits for it to join its rooms
+func runBot(t *testing.T, b *Bot) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	})
+
+	// The bot is ready once it has joined its rooms
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestBotCommands(t *testing.T) {
+	address := startServer(t)
+	store := FileStore(filepath.Join(t.TempDir(), "state.json"))
+
+	b := New(address, "bot", WithRooms("ops"), WithStore(store), WithLogger(slog.New(slog.DiscardHandler)))
+	b.Handle("deploy", "Deploy an environment", func(ctx *Context) error {
+		if ctx.Args == "" {
+			return errors.New("which environment?")
+		}
+		ctx.Bot.Set("last_deploy", ctx.Args)
+		return ctx.Reply("deploying " + ctx.Args + " for " + ctx.From)
+	})
+	runBot(t, b)
+
+	alice := newUser(t, address, "alice")
+	alice.send(t, protocol.CmdJoinRoom, "ops")
+
+	// A command in a room is answered in that room
+	alice.send(t, protocol.CmdMessage, "!deploy prod")
+	alice.expect(t, protocol.EventMessage, "ops", "deploying prod for alice")
+
+	// Handler errors and unknown commands are reported back
+	alice.send(t, protocol.CmdMessage, "!deploy")
+	alice.expect(t, protocol.EventMessage, "ops", "which environment?")
+	alice.send(t, protocol.CmdMessage, "!nope")
+	alice.expect(t, protocol.EventMessage, "ops", "Unknown command !nope")
+
+	// Plain messages are ignored
+	alice.send(t, protocol.CmdMessage, "hello everyone")
+
+	// A private command gets a private answer
+	alice.send(t, protocol.CmdPrivateMessage, "bot:!help")
+	alice.expect(t, protocol.EventPrivateMessage, "", "!deploy - Deploy an environment")
+
+	// Lobby commands are answered in the lobby
+	alice.send(t, protocol.CmdJoinRoom, "lobby")
+	alice.send(t, protocol.CmdMessage, "!DEPLOY staging")
+	alice.expect(t, protocol.EventMessage, "", "deploying staging")
+
+	// State is saved after the handler returns
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		state, err := store.Load()
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if state["last_deploy"] == "staging" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Saved state = %v", state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBotTasksAndState(t *testing.T) {
+	address := startServer(t)
+	store := FileStore(filepath.Join(t.TempDir(), "state.json"))
+	if err := store.Save(map[string]string{"greeting": "hi"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	var runs atomic.Int32
+	b := New(address, "bot", WithStore(store), WithLogger(slog.New(slog.DiscardHandler)))
+	b.Every(20*time.Millisecond, func(ctx context.Context, b *Bot) error {
+		if runs.Add(1) == 1 {
+			return b.Say("", b.Get("greeting")+" from a task")
+		}
+		return nil
+	})
+
+	bob := newUser(t, address, "bob")
+	runBot(t, b)
+	bob.expect(t, protocol.EventMessage, "", "hi from a task")
+
+	if runs.Load() < 1 {
+		t.Error("Task did not run")
+	}
+}
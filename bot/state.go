@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Store persists a bot's state between runs
+type Store interface {
+	Load() (map[string]string, error)
+	Save(state map[string]string) error
+}
+
+// FileStore keeps the state in a JSON file
+type FileStore string
+
+// Load reads the state; a missing file is an empty state
+func (f FileStore) Load() (map[string]string, error) {
+	data, err := os.ReadFile(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := map[string]string{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Save writes the state through a temporary file so a crash never leaves it half written
+func (f FileStore) Save(state map[string]string) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(string(f)), ".bot-state-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), string(f))
+}
+
+// Get returns a state value ("" if unset)
+func (b *Bot) Get(key string) string {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	return b.state[key]
+}
+
+// Set changes a state value; it is saved after the running handler or task returns
+func (b *Bot) Set(key, value string) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	b.state[key] = value
+	b.dirty = true
+}
+
+// Delete removes a state value
+func (b *Bot) Delete(key string) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	delete(b.state, key)
+	b.dirty = true
+}
+
+// loadState fills the state from the store
+func (b *Bot) loadState() error {
+	if b.store == nil {
+		return nil
+	}
+	state, err := b.store.Load()
+	if err != nil {
+		return err
+	}
+
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	for key, value := range state {
+		b.state[key] = value
+	}
+	return nil
+}
+
+// saveIfDirty saves the state if it changed since the last save
+func (b *Bot) saveIfDirty() {
+	b.stateMu.Lock()
+	dirty := b.dirty
+	b.stateMu.Unlock()
+
+	if dirty {
+		if err := b.saveState(); err != nil {
+			b.logger.Warn("failed to save bot state", "error", err)
+		}
+	}
+}
+
+// saveState writes the state to the store
+func (b *Bot) saveState() error {
+	if b.store == nil {
+		return nil
+	}
+
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+
+	if err := b.store.Save(b.state); err != nil {
+		return err
+	}
+	b.dirty = false
+	return nil
+}
@@ -2,57 +2,243 @@ package client
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"tcp_server/protocol"
+	"tcp_server/sockopt"
 	"time"
 )
 
 // Client represents a TCP client that connects to a server
 type Client struct {
-	address  string        // Server address to connect to (e.g., "localhost:8080")
-	conn     net.Conn      // TCP connection
-	reader   *bufio.Reader // Buffered reader for efficient reading
-	writer   *bufio.Writer // Buffered writer for efficient writing
-	mu       sync.Mutex    // Mutex for thread-safe operations
-	username string        // Client's username
+	address  string          // Server address to connect to (e.g., "localhost:8080")
+	conn     net.Conn        // TCP connection
+	reader   *bufio.Reader   // Buffered reader for efficient reading
+	writer   *bufio.Writer   // Buffered writer for efficient writing
+	wire     *countingWriter // The connection under writer, counting the bytes that reached it
+	mu       sync.Mutex      // Mutex for thread-safe operations
+	username string          // Client's username
+	logger   *slog.Logger    // Structured logger for connection events
+	onEvent  EventHandler    // Called for server-initiated pushes
+
+	resumeToken string        // Token from REGISTER for resuming the session after a drop
+	sessionKey  string        // Key from REGISTER for registering the username again while it is online
+	lastSeq     atomic.Uint64 // Sequence number of the last event received
+
+	writeMu sync.Mutex // Serializes writes (heartbeat replies may be sent while a request waits)
+	partial []byte     // Start of a line cut off by a read timeout
+
+	heartbeat       time.Duration // Interval between client pings (0 = disabled)
+	heartbeatMissed int           // Treat the connection as dead after this many failed pings
+	rtt             atomic.Int64  // Round-trip time of the last answered ping, in nanoseconds
+	heartbeatOnce   sync.Once     // Starts the heartbeat goroutine once
+
+	pingMu sync.Mutex                // Guards pings
+	pings  map[string]chan time.Time // Pings waiting for their pong, by nonce
+
+	socketOptions sockopt.Options // TCP options applied after dialing
+
+	reconnect    *ReconnectConfig // Automatic reconnection settings (nil = disabled)
+	onState      StateHandler     // Called on connection state changes
+	stateMu      sync.Mutex       // Guards the fields below
+	state        State            // Current connection state
+	queue        []queuedMessage  // Messages sent while reconnecting
+	reconnecting bool             // Whether a background reconnect is running
+	closed       bool             // Set by Close; stops reconnecting
+	closing      chan struct{}    // Closed by Close to interrupt backoff waits
+}
+
+// connError is an I/O failure on the connection
+// sent reports whether the message had been written before the failure
+type connError struct {
+	err  error
+	sent bool
+}
+
+func (e *connError) Error() string { return e.err.Error() }
+func (e *connError) Unwrap() error { return e.err }
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// EventHandler receives server-initiated pushes such as broadcast messages
+type EventHandler func(event *protocol.Response)
+
+// Option configures optional client behavior
+type Option func(*Client)
+
+// WithLogger sets the structured logger used for connection events (default slog.Default())
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithEventHandler sets the function called for server pushes
+// By default events are printed to stdout
+func WithEventHandler(handler EventHandler) Option {
+	return func(c *Client) {
+		c.onEvent = handler
+	}
+}
+
+// WithKeepAlive sets TCP keepalive on the connection (Enable false turns it off)
+// Zero Idle, Interval or Count keep the OS defaults for that setting
+func WithKeepAlive(cfg net.KeepAliveConfig) Option {
+	return func(c *Client) {
+		c.socketOptions.KeepAlive = &cfg
+	}
+}
+
+// WithNoDelay sets TCP_NODELAY on the connection (false enables Nagle's algorithm)
+func WithNoDelay(noDelay bool) Option {
+	return func(c *Client) {
+		c.socketOptions.NoDelay = &noDelay
+	}
+}
+
+// WithSocketBuffers sets the receive and send buffer sizes in bytes (0 = OS default)
+func WithSocketBuffers(readBuffer, writeBuffer int) Option {
+	return func(c *Client) {
+		c.socketOptions.ReadBuffer = readBuffer
+		c.socketOptions.WriteBuffer = writeBuffer
+	}
+}
+
+// WithLinger sets SO_LINGER on the connection (0 discards unsent data on close)
+func WithLinger(d time.Duration) Option {
+	return func(c *Client) {
+		c.socketOptions.Linger = &d
+	}
+}
+
+// splitAddress returns the network and address to dial
+// "unix:///path" selects a Unix socket; anything else is a TCP "host:port"
+func splitAddress(address string) (network, addr string) {
+	if path, ok := strings.CutPrefix(address, "unix://"); ok {
+		return "unix", path
+	}
+	return "tcp", strings.TrimPrefix(address, "tcp://")
 }
 
 // NewClient creates a new TCP client
-func NewClient(address string) *Client {
-	return &Client{
+// address is "host:port", or "unix:///path/to/chat.sock" for a local Unix socket
+func NewClient(address string, opts ...Option) *Client {
+	c := &Client{
 		address: address,
+		logger:  slog.Default(),
+		onEvent: printEvent,
+		closing: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
 // Connect establishes a connection to the server
+// With WithReconnect it keeps retrying with backoff until it succeeds
 func (c *Client) Connect() error {
-	// Dial creates a TCP connection to the server
-	conn, err := net.Dial("tcp", c.address)
+	if c.reconnect != nil {
+		err := c.dialWithBackoff(false)
+		if err != nil {
+			c.setState(StateDisconnected, err)
+			return err
+		}
+		c.startHeartbeat()
+		return nil
+	}
+
+	c.setState(StateConnecting, nil)
+	welcome, err := c.dial()
+	if err != nil {
+		c.setState(StateDisconnected, err)
+		return err
+	}
+	c.setState(StateConnected, nil)
+	c.startHeartbeat()
+
+	fmt.Printf("🎉 %s\n", welcome.Message)
+	return nil
+}
+
+// dial connects to the server, replacing any previous connection, and reads the welcome message
+func (c *Client) dial() (*protocol.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Dial creates a TCP (or Unix socket) connection to the server
+	network, addr := splitAddress(c.address)
+	conn, err := net.Dial(network, addr)
 	if err != nil {
-		return fmt.Errorf("failed to connect to server: %w", err)
+		return nil, fmt.Errorf("failed to connect to server: %w", err)
+	}
+	if err := c.socketOptions.Apply(conn); err != nil {
+		c.logger.Warn("failed to set socket options", "error", err)
 	}
 
+	c.writeMu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
 	c.conn = conn
 	c.reader = bufio.NewReader(conn)
-	c.writer = bufio.NewWriter(conn)
+	c.wire = &countingWriter{w: conn}
+	c.writer = bufio.NewWriter(c.wire)
+	c.partial = nil
+	c.writeMu.Unlock()
+	c.logger.Debug("connected", "address", c.address, "local_addr", conn.LocalAddr().String())
 
 	// Read welcome message
 	response, err := c.readResponse()
 	if err != nil {
-		return fmt.Errorf("failed to read welcome message: %w", err)
+		conn.Close()
+		return nil, fmt.Errorf("failed to read welcome message: %w", err)
 	}
-
-	fmt.Printf("🎉 %s\n", response.Message)
-	return nil
+	return response, nil
 }
 
 // SendMessage sends a message to the server and waits for response
+// While reconnecting (see WithReconnect) the message is queued and ErrQueued is returned
 func (c *Client) SendMessage(command, data string) (*protocol.Response, error) {
+	if c.reconnect != nil && c.isReconnecting() {
+		return nil, c.queueMessage(command, data)
+	}
+
+	response, err := c.roundTrip(command, data)
+
+	var ce *connError
+	if errors.As(err, &ce) && c.connLost(ce.err) && !ce.sent {
+		return nil, c.queueMessage(command, data)
+	}
+	return response, err
+}
+
+// roundTrip writes one message and waits for its response
+func (c *Client) roundTrip(command, data string) (*protocol.Response, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.conn == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
 	// Create message
 	msg := protocol.NewMessage(c.username, command, data)
 
@@ -67,53 +253,116 @@ func (c *Client) SendMessage(command, data string) (*protocol.Response, error) {
 		return nil, fmt.Errorf("failed to marshal message: %w", err)
 	}
 
+	if err := c.writeFrame(jsonData); err != nil {
+		return nil, err
+	}
+
+	// Wait for response
+	response, err := c.readResponse()
+	if err != nil {
+		return nil, &connError{err: fmt.Errorf("failed to read response: %w", err), sent: true}
+	}
+
+	return response, nil
+}
+
+// writeFrame writes one encoded frame; failures are returned as *connError
+func (c *Client) writeFrame(frame []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
 	// Set write deadline
 	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 
+	// Once part of the frame is on the wire the server may act on it, so it counts as sent
+	// and is not queued again after a reconnect
+	start := c.wire.n
+	fail := func(err error) error {
+		c.writer.Reset(c.wire)
+		return &connError{err: err, sent: c.wire.n > start}
+	}
+
 	// Write to connection
-	_, err = c.writer.Write(jsonData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send message: %w", err)
+	if _, err := c.writer.Write(frame); err != nil {
+		return fail(fmt.Errorf("failed to send message: %w", err))
 	}
 
 	// Flush buffer to ensure data is sent
-	err = c.writer.Flush()
-	if err != nil {
-		return nil, fmt.Errorf("failed to flush buffer: %w", err)
+	if err := c.writer.Flush(); err != nil {
+		return fail(fmt.Errorf("failed to flush buffer: %w", err))
 	}
+	return nil
+}
 
-	// Wait for response
-	response, err := c.readResponse()
+// readLine reads one line with a deadline; the caller must hold c.mu
+// A line cut off by the deadline is kept and completed by the next read
+func (c *Client) readLine(timeout time.Duration) (string, error) {
+	c.conn.SetReadDeadline(time.Now().Add(timeout))
+
+	line, err := c.reader.ReadString('\n')
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		c.partial = append(c.partial, line...)
+		return "", err
 	}
-
-	return response, nil
+	if len(c.partial) > 0 {
+		line = string(c.partial) + line
+		c.partial = nil
+	}
+	return line, nil
 }
 
 // readResponse reads and parses a response from the server
+// Events that arrive while waiting are handed to the event handler
 func (c *Client) readResponse() (*protocol.Response, error) {
-	// Set read deadline
-	c.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	for {
+		// Read until newline
+		line, err := c.readLine(30 * time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
 
-	// Read until newline
-	line, err := c.reader.ReadString('\n')
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		// Parse response
+		var response protocol.Response
+		if err := response.FromJSON([]byte(line)); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		if response.IsEvent() {
+			c.handleEvent(&response)
+			continue
+		}
+
+		return &response, nil
 	}
+}
 
-	// Parse response
-	var response protocol.Response
-	if err := response.FromJSON([]byte(line)); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+// handleEvent acknowledges an event's sequence number and passes it to the event handler
+// Server pings are answered here and never reach the handler
+func (c *Client) handleEvent(event *protocol.Response) {
+	if c.handleHeartbeat(event) {
+		return
 	}
+	if event.Seq > c.lastSeq.Load() {
+		c.lastSeq.Store(event.Seq)
+	}
+	c.onEvent(event)
+}
 
-	return &response, nil
+// printEvent is the default event handler: it shows the event text
+func printEvent(event *protocol.Response) {
+	fmt.Printf("\n%s\n", event.Message)
+	fmt.Print("> ")
 }
 
 // Register registers a username with the server
 func (c *Client) Register(username string) error {
-	response, err := c.SendMessage(protocol.CmdRegister, username)
+	return c.AddSession(username, "")
+}
+
+// AddSession registers a username that is already online from another connection
+// key is the user's session key, shown by SESSIONS (or SessionKey on a registered client)
+func (c *Client) AddSession(username, key string) error {
+	response, err := c.SendMessage(protocol.CmdRegister, strings.TrimSpace(username+" "+key))
 	if err != nil {
 		return err
 	}
@@ -122,11 +371,59 @@ func (c *Client) Register(username string) error {
 		return fmt.Errorf("registration failed: %s", response.Message)
 	}
 
+	c.mu.Lock()
 	c.username = username
+	c.resumeToken = response.Data
+	c.sessionKey = response.Key
+	c.mu.Unlock()
 	fmt.Printf("✅ %s\n", response.Message)
 	return nil
 }
 
+// Resume takes over the session from before a dropped connection
+// Call it on a new connection (after Connect) instead of Register; missed events
+// are delivered to the event handler before it returns
+func (c *Client) Resume() error {
+	token := c.ResumeToken()
+	if token == "" {
+		return fmt.Errorf("no resumable session")
+	}
+
+	response, err := c.SendMessage(protocol.CmdResume, fmt.Sprintf("%s %d", token, c.lastSeq.Load()))
+	if err != nil {
+		return err
+	}
+	if !response.Success {
+		return fmt.Errorf("resume failed: %s", response.Message)
+	}
+
+	c.mu.Lock()
+	c.resumeToken = response.Data
+	c.sessionKey = response.Key
+	c.mu.Unlock()
+	fmt.Printf("🔄 %s\n", response.Message)
+	return nil
+}
+
+// ResumeToken returns the token for resuming this session ("" if the server does not support it)
+func (c *Client) ResumeToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumeToken
+}
+
+// SessionKey returns the key other connections need to register this username while it is online
+func (c *Client) SessionKey() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionKey
+}
+
+// LastEventSeq returns the sequence number of the last event received
+func (c *Client) LastEventSeq() uint64 {
+	return c.lastSeq.Load()
+}
+
 // Echo sends an echo request
 func (c *Client) Echo(data string) error {
 	response, err := c.SendMessage(protocol.CmdEcho, data)
@@ -172,6 +469,97 @@ func (c *Client) ListUsers() error {
 	return nil
 }
 
+// ListUsersWithStatus requests online users with their status and idle time
+func (c *Client) ListUsersWithStatus() error {
+	return c.runCommand(protocol.CmdListUsers, protocol.ListUsersWithStatus)
+}
+
+// SetStatus sets the presence status: "online", "away [text]", "busy [text]" or custom text
+func (c *Client) SetStatus(status string) error {
+	return c.runCommand(protocol.CmdStatus, status)
+}
+
+// PrivateMessage sends a message to every session of one user
+func (c *Client) PrivateMessage(to, text string) error {
+	return c.runCommand(protocol.CmdPrivateMessage, to+":"+text)
+}
+
+// JoinRoom joins a room and sends further chat messages there
+func (c *Client) JoinRoom(room string) error {
+	return c.runCommand(protocol.CmdJoinRoom, room)
+}
+
+// LeaveRoom leaves a room
+func (c *Client) LeaveRoom(room string) error {
+	return c.runCommand(protocol.CmdLeaveRoom, room)
+}
+
+// ListRooms lists rooms and their member counts
+func (c *Client) ListRooms() error {
+	return c.runCommand(protocol.CmdListRooms, "")
+}
+
+// Sessions lists the sessions connected under this username
+func (c *Client) Sessions() error {
+	return c.runCommand(protocol.CmdSessions, "")
+}
+
+// KillSession disconnects another session of this username
+func (c *Client) KillSession(id string) error {
+	return c.runCommand(protocol.CmdKillSession, id)
+}
+
+// EditMessage replaces the text of one of your messages (admins may edit any)
+func (c *Client) EditMessage(id uint64, text string) error {
+	return c.runCommand(protocol.CmdEdit, fmt.Sprintf("%d %s", id, text))
+}
+
+// DeleteMessage deletes one of your messages (admins may delete any)
+func (c *Client) DeleteMessage(id uint64) error {
+	return c.runCommand(protocol.CmdDelete, strconv.FormatUint(id, 10))
+}
+
+// React adds an emoji reaction to a message
+func (c *Client) React(id uint64, emoji string) error {
+	return c.runCommand(protocol.CmdReact, fmt.Sprintf("%d %s", id, emoji))
+}
+
+// Unreact removes your emoji reaction from a message
+func (c *Client) Unreact(id uint64, emoji string) error {
+	return c.runCommand(protocol.CmdUnreact, fmt.Sprintf("%d %s", id, emoji))
+}
+
+// Reply posts a reply in a message's thread
+func (c *Client) Reply(id uint64, text string) error {
+	return c.runCommand(protocol.CmdReply, fmt.Sprintf("%d %s", id, text))
+}
+
+// Thread lists a thread's first message and one page of its replies (pages start at 1)
+func (c *Client) Thread(id uint64, page int) error {
+	return c.runCommand(protocol.CmdThread, fmt.Sprintf("%d %d", id, page))
+}
+
+// Follow receives a thread's replies as events
+func (c *Client) Follow(id uint64) error {
+	return c.runCommand(protocol.CmdFollow, strconv.FormatUint(id, 10))
+}
+
+// Unfollow stops receiving a thread's replies
+func (c *Client) Unfollow(id uint64) error {
+	return c.runCommand(protocol.CmdUnfollow, strconv.FormatUint(id, 10))
+}
+
+// Search searches the message history, e.g. `deploy "rolled back" from:alice in:ops page:2`
+func (c *Client) Search(query string) error {
+	return c.runCommand(protocol.CmdSearch, query)
+}
+
+// SendToRoom sends a chat message to one of your rooms ("lobby" for the lobby)
+// without changing where SendChatMessage posts
+func (c *Client) SendToRoom(room, message string) error {
+	return c.runCommand(protocol.CmdSay, room+" "+message)
+}
+
 // ListMessages requests the list of recent messages
 func (c *Client) ListMessages() error {
 	response, err := c.SendMessage(protocol.CmdListMessages, "")
@@ -202,8 +590,78 @@ func (c *Client) GetServerTime() error {
 	return nil
 }
 
+// Oper authenticates as a server operator, granting the admin role
+func (c *Client) Oper(name, password string) error {
+	return c.runCommand(protocol.CmdOper, name+" "+password)
+}
+
+// Kick disconnects every connection of a user (admin only)
+func (c *Client) Kick(username, reason string) error {
+	return c.runCommand(protocol.CmdKick, strings.TrimSpace(username+" "+reason))
+}
+
+// Ban bans a username, IP address or CIDR range (admin only)
+func (c *Client) Ban(target, reason string) error {
+	return c.runCommand(protocol.CmdBan, strings.TrimSpace(target+" "+reason))
+}
+
+// Unban lifts a ban (admin only)
+func (c *Client) Unban(target string) error {
+	return c.runCommand(protocol.CmdUnban, target)
+}
+
+// Mute stops a user from sending messages; a zero duration mutes until Unmute (admin only)
+func (c *Client) Mute(username string, duration time.Duration) error {
+	data := username
+	if duration > 0 {
+		data += " " + duration.String()
+	}
+	return c.runCommand(protocol.CmdMute, data)
+}
+
+// Unmute lifts a mute (admin only)
+func (c *Client) Unmute(username string) error {
+	return c.runCommand(protocol.CmdUnmute, username)
+}
+
+// Notice broadcasts a system notice to everyone (admin only)
+func (c *Client) Notice(text string) error {
+	return c.runCommand(protocol.CmdNotice, text)
+}
+
+// ClearHistory deletes the server's message history (admin only)
+func (c *Client) ClearHistory() error {
+	return c.runCommand(protocol.CmdClearHistory, "")
+}
+
+// ListConnections lists connections with their addresses and connect times (admin only)
+func (c *Client) ListConnections() error {
+	return c.runCommand(protocol.CmdListConnections, "")
+}
+
+// runCommand sends a command and prints the outcome
+func (c *Client) runCommand(command, data string) error {
+	response, err := c.SendMessage(command, data)
+	if err != nil {
+		return err
+	}
+
+	if !response.Success {
+		fmt.Printf("❌ Error: %s\n", response.Message)
+		return nil
+	}
+
+	if response.Data != "" {
+		fmt.Printf("✅ %s:\n%s\n", response.Message, response.Data)
+	} else {
+		fmt.Printf("✅ %s\n", response.Message)
+	}
+	return nil
+}
+
 // Quit sends a quit message and closes the connection
 func (c *Client) Quit() error {
+	c.markClosed() // The server hanging up is expected now
 	response, err := c.SendMessage(protocol.CmdQuit, "")
 	if err != nil {
 		return err
@@ -224,12 +682,24 @@ func (c *Client) StartListening(done chan struct{}) {
 		case <-done:
 			return
 		default:
+			if c.isReconnecting() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
 			// Try to read broadcast messages (non-blocking)
-			c.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			c.mu.Lock()
+			line, err := c.readLine(100 * time.Millisecond)
+			c.mu.Unlock()
 
-			line, err := c.reader.ReadString('\n')
 			if err != nil {
-				// Timeout or error - continue
+				// Timeouts are expected; anything else means the connection is gone
+				var netErr net.Error
+				if !errors.As(err, &netErr) || !netErr.Timeout() {
+					if !c.connLost(err) {
+						return
+					}
+				}
 				continue
 			}
 
@@ -240,7 +710,9 @@ func (c *Client) StartListening(done chan struct{}) {
 			}
 
 			// Display broadcast message
-			if response.Success && len(response.Message) > 0 {
+			if response.IsEvent() {
+				c.handleEvent(&response)
+			} else if response.Success && len(response.Message) > 0 {
 				fmt.Printf("\n%s\n", response.Message)
 				fmt.Print("> ")
 			}
@@ -248,9 +720,14 @@ func (c *Client) StartListening(done chan struct{}) {
 	}
 }
 
-// Close closes the connection
+// Close closes the connection and stops reconnecting
 func (c *Client) Close() error {
+	c.markClosed()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.conn != nil {
+		c.logger.Debug("closing connection", "address", c.address)
 		return c.conn.Close()
 	}
 	return nil
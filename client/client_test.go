@@ -0,0 +1,304 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"tcp_server/protocol"
+	"tcp_server/server"
+	"testing"
+	"time"
+)
+
+// startServer runs a server on address until the test ends or it is shut down
+func startServer(t *testing.T, address string, opts ...server.Option) *server.Server {
+	t.Helper()
+
+	opts = append([]server.Option{server.WithLogger(slog.New(slog.DiscardHandler))}, opts...)
+	s := server.NewServer(address, opts...)
+	go s.Start()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// freeAddress returns a loopback address nothing is listening on
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestReconnectAfterServerRestart(t *testing.T) {
+	address := freeAddress(t)
+	first := startServer(t, address)
+
+	var mu sync.Mutex
+	var states []State
+	c := NewClient(address,
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithEventHandler(func(*protocol.Response) {}),
+		WithStateHandler(func(state State, err error) {
+			mu.Lock()
+			states = append(states, state)
+			mu.Unlock()
+		}),
+		WithReconnect(ReconnectConfig{InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, QueueSize: 2}),
+	)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+	if err := c.Register("bot"); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	first.Shutdown()
+
+	// The first call notices the dead connection; later ones are queued up to the cap
+	c.SendMessage(protocol.CmdMessage, "lost")
+	for _, text := range []string{"queued 1", "queued 2"} {
+		if _, err := c.SendMessage(protocol.CmdMessage, text); !errors.Is(err, ErrQueued) {
+			t.Fatalf("Expected ErrQueued, got %v", err)
+		}
+	}
+	if _, err := c.SendMessage(protocol.CmdMessage, "queued 3"); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Expected ErrQueueFull, got %v", err)
+	}
+
+	second := startServer(t, address)
+	defer second.Shutdown()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.State() != StateConnected || c.QueueLength() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("client did not reconnect (state %s, queue %d)", c.State(), c.QueueLength())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The client registered again and flushed its queue
+	resp, err := c.SendMessage(protocol.CmdListMessages, "")
+	if err != nil {
+		t.Fatalf("LIST_MESSAGES failed: %v", err)
+	}
+	if !strings.Contains(resp.Data, "bot: queued 1") || !strings.Contains(resp.Data, "bot: queued 2") {
+		t.Errorf("Queued messages missing from history:\n%s", resp.Data)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(states) < 4 || states[len(states)-1] != StateConnected {
+		t.Errorf("Unexpected state changes: %v", states)
+	}
+}
+
+func TestConnectGivesUp(t *testing.T) {
+	c := NewClient(freeAddress(t),
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithReconnect(ReconnectConfig{InitialDelay: time.Millisecond, MaxAttempts: 3}),
+	)
+	if err := c.Connect(); err == nil {
+		t.Fatal("Expected Connect to fail with nothing listening")
+	}
+	if c.State() != StateDisconnected {
+		t.Errorf("Expected to end disconnected, got %s", c.State())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cfg := ReconnectConfig{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.5}.withDefaults()
+
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{attempt: 1, base: 100 * time.Millisecond},
+		{attempt: 2, base: 200 * time.Millisecond},
+		{attempt: 4, base: 800 * time.Millisecond},
+		{attempt: 10, base: time.Second},
+	}
+
+	for _, tt := range tests {
+		for range 20 {
+			d := cfg.backoff(tt.attempt)
+			if d < tt.base/2 || d > tt.base*3/2 {
+				t.Errorf("backoff(%d) = %s, want within 50%% of %s", tt.attempt, d, tt.base)
+			}
+		}
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	address := freeAddress(t)
+	s := startServer(t, address, server.WithHeartbeat(20*time.Millisecond, 2))
+	defer s.Shutdown()
+
+	c := NewClient(address,
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithEventHandler(func(*protocol.Response) {}),
+		WithHeartbeat(10*time.Millisecond, 2),
+	)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	// An idle client stays connected because heartbeats keep flowing
+	time.Sleep(200 * time.Millisecond)
+	if c.RTT() <= 0 {
+		t.Error("Expected an RTT measurement")
+	}
+	if resp, err := c.SendMessage(protocol.CmdEcho, "alive"); err != nil || resp.Data != "alive" {
+		t.Fatalf("ECHO after idle period failed: %v %+v", err, resp)
+	}
+}
+
+func TestPingWhileListening(t *testing.T) {
+	address := freeAddress(t)
+	s := startServer(t, address)
+	defer s.Shutdown()
+
+	c := NewClient(address, WithLogger(slog.New(slog.DiscardHandler)), WithEventHandler(func(*protocol.Response) {}))
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	// The listener reads the pong and hands it to Ping
+	done := make(chan struct{})
+	defer close(done)
+	go c.StartListening(done)
+
+	for range 3 {
+		if rtt, err := c.Ping(); err != nil || rtt <= 0 {
+			t.Fatalf("Ping() = %v, %v", rtt, err)
+		}
+	}
+}
+
+func TestPingDoesNotBlockRequests(t *testing.T) {
+	// A server that answers ECHO but never PING
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte(`{"success":true,"message":"Welcome"}` + "\n"))
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var msg protocol.Message
+			if err := msg.FromJSON(scanner.Bytes()); err == nil && msg.Command == protocol.CmdEcho {
+				frame, _ := protocol.NewResponse(true, "Echo", msg.Data).ToJSON()
+				conn.Write(frame)
+			}
+		}
+	}()
+
+	c := NewClient(l.Addr().String(), WithLogger(slog.New(slog.DiscardHandler)), WithEventHandler(func(*protocol.Response) {}))
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+	c.heartbeat = 2 * time.Second // Ping's timeout
+
+	pinged := make(chan error, 1)
+	go func() {
+		_, err := c.Ping()
+		pinged <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// A request goes through while the ping is still waiting for its pong
+	started := time.Now()
+	if resp, err := c.SendMessage(protocol.CmdEcho, "still here"); err != nil || resp.Data != "still here" {
+		t.Fatalf("ECHO during a ping = %+v, %v", resp, err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("ECHO waited %v for the ping", elapsed)
+	}
+	if err := <-pinged; err == nil {
+		t.Error("Ping() succeeded without a pong")
+	}
+}
+
+func TestUnixSocketAddress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.sock")
+	s := server.NewServer("", server.WithLogger(slog.New(slog.DiscardHandler)),
+		server.WithListener(server.ListenerConfig{Address: "unix://" + path}))
+	go s.Start()
+	defer s.Shutdown()
+
+	c := NewClient("unix://"+path,
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithReconnect(ReconnectConfig{InitialDelay: 5 * time.Millisecond, MaxAttempts: 100}),
+	)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect over unix socket failed: %v", err)
+	}
+	defer c.Close()
+
+	if resp, err := c.SendMessage(protocol.CmdEcho, "local"); err != nil || resp.Data != "local" {
+		t.Errorf("ECHO over unix socket failed: %v %+v", err, resp)
+	}
+}
+
+// partialConn accepts the first few bytes of a write and then fails
+type partialConn struct {
+	net.Conn
+	accept int
+}
+
+func (c *partialConn) Write(p []byte) (int, error) {
+	n := min(len(p), c.accept)
+	c.accept -= n
+	if n < len(p) {
+		return n, errors.New("connection reset")
+	}
+	return n, nil
+}
+
+func (c *partialConn) SetWriteDeadline(time.Time) error { return nil }
+
+func TestPartialWriteCountsAsSent(t *testing.T) {
+	for _, tc := range []struct {
+		accept int
+		sent   bool
+	}{{0, false}, {5, true}} {
+		conn := &partialConn{accept: tc.accept}
+		c := &Client{conn: conn, wire: &countingWriter{w: conn}}
+		c.writer = bufio.NewWriter(c.wire)
+
+		var ce *connError
+		if err := c.writeFrame([]byte(`{"command":"MESSAGE","data":"hi"}` + "\n")); !errors.As(err, &ce) {
+			t.Fatalf("writeFrame() error = %v, want *connError", err)
+		}
+		if ce.sent != tc.sent {
+			t.Errorf("accepting %d bytes: sent = %v, want %v", tc.accept, ce.sent, tc.sent)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"tcp_server/protocol"
+	"time"
+)
+
+// defaultPingTimeout bounds Ping when no heartbeat interval is configured
+const defaultPingTimeout = 5 * time.Second
+
+// WithHeartbeat pings the server every interval and treats the connection as dead
+// after missed failed pings in a row (it then reconnects if WithReconnect is set)
+// The pings also keep the connection alive for servers that reap silent clients
+func WithHeartbeat(interval time.Duration, missed int) Option {
+	return func(c *Client) {
+		c.heartbeat = interval
+		c.heartbeatMissed = max(missed, 1)
+	}
+}
+
+// RTT returns the round-trip time measured by the last successful ping (0 if none yet)
+func (c *Client) RTT() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
+// Ping sends a PING and waits for the server's pong, returning the round-trip time
+// Events that arrive in the meantime are passed to the event handler as usual
+// The connection is only locked while sending and reading, so requests and
+// StartListening keep running; whichever of them reads the pong hands it over
+func (c *Client) Ping() (time.Duration, error) {
+	timeout := c.heartbeat
+	if timeout <= 0 {
+		timeout = defaultPingTimeout
+	}
+
+	sent := time.Now()
+	nonce := strconv.FormatInt(sent.UnixNano(), 10)
+	pong := make(chan time.Time, 1)
+	c.pingMu.Lock()
+	if c.pings == nil {
+		c.pings = make(map[string]chan time.Time)
+	}
+	c.pings[nonce] = pong
+	c.pingMu.Unlock()
+	defer func() {
+		c.pingMu.Lock()
+		delete(c.pings, nonce)
+		c.pingMu.Unlock()
+	}()
+
+	if err := c.sendPing(nonce); err != nil {
+		return 0, err
+	}
+
+	deadline := sent.Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, errors.New("ping timed out")
+		}
+		wait := min(remaining, pingReadInterval)
+
+		// Read for a moment if nobody else is reading, otherwise wait for them to hand the pong over
+		if c.mu.TryLock() {
+			err := c.readEvents(wait)
+			c.mu.Unlock()
+			if err != nil {
+				return 0, fmt.Errorf("ping failed: %w", err)
+			}
+		} else {
+			select {
+			case received := <-pong:
+				return c.pinged(sent, received), nil
+			case <-time.After(wait):
+			}
+		}
+
+		select {
+		case received := <-pong:
+			return c.pinged(sent, received), nil
+		default:
+		}
+	}
+}
+
+// pinged records and returns the round-trip time of a ping answered at received
+func (c *Client) pinged(sent, received time.Time) time.Duration {
+	rtt := received.Sub(sent)
+	c.rtt.Store(int64(rtt))
+	return rtt
+}
+
+// pingReadInterval is how long Ping reads or waits at a time before checking for its pong
+const pingReadInterval = 50 * time.Millisecond
+
+// sendPing writes a PING carrying nonce
+func (c *Client) sendPing(nonce string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+	frame, err := protocol.NewMessage("", protocol.CmdPing, nonce).ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal ping: %w", err)
+	}
+	return c.writeFrame(frame)
+}
+
+// readEvents handles the events that arrive within timeout; the caller must hold c.mu
+// Replies are stale answers to requests that already gave up, so they are skipped
+func (c *Client) readEvents(timeout time.Duration) error {
+	if c.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		line, err := c.readLine(time.Until(deadline))
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil
+			}
+			return err
+		}
+
+		var response protocol.Response
+		if err := response.FromJSON([]byte(line)); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		if response.IsEvent() {
+			c.handleEvent(&response)
+		}
+	}
+}
+
+// handleHeartbeat answers server pings and swallows stray pongs
+// It returns false for every other event
+func (c *Client) handleHeartbeat(event *protocol.Response) bool {
+	switch event.Event {
+	case protocol.EventPing:
+		frame, err := protocol.NewMessage("", protocol.CmdPong, event.Data).ToJSON()
+		if err == nil {
+			if err := c.writeFrame(frame); err != nil {
+				c.logger.Debug("pong failed", "error", err)
+			}
+		}
+		return true
+	case protocol.EventPong:
+		// Hand the pong to the Ping waiting for it; late or unknown ones are dropped
+		c.pingMu.Lock()
+		pong, ok := c.pings[event.Data]
+		delete(c.pings, event.Data)
+		c.pingMu.Unlock()
+		if ok {
+			pong <- time.Now()
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// startHeartbeat starts the heartbeat goroutine once, if heartbeats are enabled
+func (c *Client) startHeartbeat() {
+	if c.heartbeat <= 0 {
+		return
+	}
+	c.heartbeatOnce.Do(func() { go c.heartbeatLoop() })
+}
+
+// heartbeatLoop pings the server until the client is closed
+func (c *Client) heartbeatLoop() {
+	ticker := time.NewTicker(c.heartbeat)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-c.closing:
+			return
+		case <-ticker.C:
+		}
+
+		if c.isReconnecting() || c.State() != StateConnected {
+			missed = 0
+			continue
+		}
+
+		if _, err := c.Ping(); err != nil {
+			missed++
+			c.logger.Debug("heartbeat missed", "missed", missed, "error", err)
+			if missed >= c.heartbeatMissed {
+				missed = 0
+				c.heartbeatFailed(fmt.Errorf("no heartbeat reply after %d attempts: %w", c.heartbeatMissed, err))
+			}
+			continue
+		}
+		missed = 0
+	}
+}
+
+// heartbeatFailed drops a connection that stopped answering
+func (c *Client) heartbeatFailed(err error) {
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.mu.Unlock()
+
+	if !c.connLost(err) {
+		c.logger.Warn("connection lost", "address", c.address, "error", err)
+		c.setState(StateDisconnected, err)
+	}
+}
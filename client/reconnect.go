@@ -0,0 +1,312 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"tcp_server/protocol"
+	"time"
+)
+
+// State is the client's connection state
+type State int
+
+// Connection states reported to a StateHandler
+const (
+	StateDisconnected State = iota // Not connected (the handler's err holds the cause, if any)
+	StateConnecting                // Dialing the server
+	StateConnected                 // Connected and, after a reconnect, registered again
+)
+
+// String returns the state name
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	default:
+		return "disconnected"
+	}
+}
+
+// StateHandler is called whenever the connection state changes
+// err is the reason for StateDisconnected (nil otherwise)
+type StateHandler func(state State, err error)
+
+// ErrQueued is returned by SendMessage while the client is reconnecting:
+// the message was queued and will be sent once the connection is back
+var ErrQueued = errors.New("connection lost, message queued until reconnected")
+
+// ErrQueueFull is returned when a message cannot be queued during a reconnect
+var ErrQueueFull = errors.New("connection lost and outgoing queue is full")
+
+// ReconnectConfig controls automatic reconnection
+type ReconnectConfig struct {
+	InitialDelay time.Duration // Delay before the first attempt (default 500ms)
+	MaxDelay     time.Duration // Upper bound for the delay between attempts (default 30s)
+	Multiplier   float64       // Growth factor for the delay (default 2)
+	Jitter       float64       // Randomize each delay by up to ±Jitter of its length (default 0.2)
+	MaxAttempts  int           // Give up after this many attempts in a row (0 = never)
+	QueueSize    int           // Outgoing messages kept while disconnected (default 100)
+}
+
+// DefaultReconnectConfig returns the reconnect settings used for zero fields
+func DefaultReconnectConfig() ReconnectConfig {
+	return ReconnectConfig{
+		InitialDelay: 500 * time.Millisecond,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+		QueueSize:    100,
+	}
+}
+
+// withDefaults fills zero fields from DefaultReconnectConfig
+func (cfg ReconnectConfig) withDefaults() ReconnectConfig {
+	def := DefaultReconnectConfig()
+	if cfg.InitialDelay <= 0 {
+		cfg.InitialDelay = def.InitialDelay
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = def.MaxDelay
+	}
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = def.Multiplier
+	}
+	if cfg.Jitter < 0 || cfg.Jitter > 1 {
+		cfg.Jitter = def.Jitter
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = def.QueueSize
+	}
+	return cfg
+}
+
+// backoff returns the jittered delay before the given attempt (starting at 1)
+func (cfg ReconnectConfig) backoff(attempt int) time.Duration {
+	delay := float64(cfg.InitialDelay)
+	for i := 1; i < attempt && delay < float64(cfg.MaxDelay); i++ {
+		delay *= cfg.Multiplier
+	}
+	delay = min(delay, float64(cfg.MaxDelay))
+
+	// Spread reconnecting clients out so a restarted server is not hit all at once
+	delay += delay * cfg.Jitter * (2*rand.Float64() - 1)
+	return time.Duration(delay)
+}
+
+// WithReconnect enables automatic reconnection with jittered exponential backoff
+// Connect retries until it succeeds; a lost connection is re-established in the
+// background, the session is resumed (or registered again) and queued messages are sent
+func WithReconnect(cfg ReconnectConfig) Option {
+	return func(c *Client) {
+		cfg = cfg.withDefaults()
+		c.reconnect = &cfg
+	}
+}
+
+// WithStateHandler sets the function called on connection state changes
+func WithStateHandler(handler StateHandler) Option {
+	return func(c *Client) {
+		c.onState = handler
+	}
+}
+
+// queuedMessage is an outgoing command waiting for the connection to come back
+type queuedMessage struct {
+	command string
+	data    string
+}
+
+// State returns the current connection state
+func (c *Client) State() State {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.state
+}
+
+// setState records a state change and notifies the state handler
+func (c *Client) setState(state State, err error) {
+	c.stateMu.Lock()
+	c.state = state
+	c.stateMu.Unlock()
+
+	if c.onState != nil {
+		c.onState(state, err)
+	}
+}
+
+// queueMessage keeps a message to send after reconnecting
+// It returns ErrQueued, or ErrQueueFull if the queue is at its cap
+func (c *Client) queueMessage(command, data string) error {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	if len(c.queue) >= c.reconnect.QueueSize {
+		return ErrQueueFull
+	}
+	c.queue = append(c.queue, queuedMessage{command: command, data: data})
+	return ErrQueued
+}
+
+// connLost starts reconnecting in the background (once) after an I/O failure
+// It returns false if reconnecting is disabled or the client was closed
+func (c *Client) connLost(cause error) bool {
+	if c.reconnect == nil {
+		return false
+	}
+
+	c.stateMu.Lock()
+	if c.closed || c.reconnecting {
+		reconnecting := c.reconnecting
+		c.stateMu.Unlock()
+		return reconnecting
+	}
+	c.reconnecting = true
+	c.stateMu.Unlock()
+
+	c.logger.Warn("connection lost", "address", c.address, "error", cause)
+	c.setState(StateDisconnected, cause)
+	go c.reconnectLoop()
+	return true
+}
+
+// markClosed stops any reconnect attempts; it is safe to call more than once
+func (c *Client) markClosed() {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.closing)
+	}
+}
+
+// isReconnecting reports whether a background reconnect is in progress
+func (c *Client) isReconnecting() bool {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.reconnecting
+}
+
+// reconnectLoop re-establishes the connection, restores the session and flushes the queue
+func (c *Client) reconnectLoop() {
+	if err := c.dialWithBackoff(true); err != nil {
+		c.stateMu.Lock()
+		c.reconnecting = false
+		c.stateMu.Unlock()
+
+		c.logger.Error("reconnect failed", "address", c.address, "error", err)
+		c.setState(StateDisconnected, err)
+		return
+	}
+	c.flushQueue()
+}
+
+// dialWithBackoff dials until it succeeds, the attempts run out or the client is closed
+// When reconnecting, the first attempt waits too and the session is resumed or registered again
+func (c *Client) dialWithBackoff(reconnecting bool) error {
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 || reconnecting {
+			select {
+			case <-time.After(c.reconnect.backoff(attempt)):
+			case <-c.closing:
+				return errors.New("client closed")
+			}
+		}
+
+		c.setState(StateConnecting, nil)
+		_, err := c.dial()
+		if err == nil && reconnecting {
+			err = c.restoreSession()
+		}
+		if err == nil {
+			c.setState(StateConnected, nil)
+			return nil
+		}
+
+		c.logger.Warn("connect attempt failed", "address", c.address, "attempt", attempt, "error", err)
+		if c.reconnect.MaxAttempts > 0 && attempt >= c.reconnect.MaxAttempts {
+			return err
+		}
+	}
+}
+
+// restoreSession resumes the previous session, falling back to registering the username again
+func (c *Client) restoreSession() error {
+	c.mu.Lock()
+	username, token, key := c.username, c.resumeToken, c.sessionKey
+	c.mu.Unlock()
+
+	if token != "" {
+		response, err := c.roundTrip(protocol.CmdResume, fmt.Sprintf("%s %d", token, c.lastSeq.Load()))
+		if err != nil {
+			return err
+		}
+		if response.Success {
+			c.mu.Lock()
+			c.resumeToken = response.Data
+			c.sessionKey = response.Key
+			c.mu.Unlock()
+			c.logger.Info("session resumed", "username", username, "detail", response.Message)
+			return nil
+		}
+	}
+
+	if username == "" {
+		return nil
+	}
+	// The key lets the registration through if other sessions kept the username online
+	response, err := c.roundTrip(protocol.CmdRegister, strings.TrimSpace(username+" "+key))
+	if err != nil {
+		return err
+	}
+	if !response.Success {
+		return errors.New("registration failed: " + response.Message)
+	}
+
+	c.mu.Lock()
+	c.resumeToken = response.Data
+	c.sessionKey = response.Key
+	c.mu.Unlock()
+	c.logger.Info("registered again", "username", username)
+	return nil
+}
+
+// flushQueue sends the messages queued while disconnected, oldest first
+// New messages keep queueing until it is done so they cannot overtake older ones
+func (c *Client) flushQueue() {
+	for {
+		c.stateMu.Lock()
+		if len(c.queue) == 0 {
+			c.reconnecting = false
+			c.stateMu.Unlock()
+			return
+		}
+		next := c.queue[0]
+		c.queue = c.queue[1:]
+		c.stateMu.Unlock()
+
+		response, err := c.roundTrip(next.command, next.data)
+		if err != nil {
+			// Put it back; the next reconnect sends it again
+			c.stateMu.Lock()
+			c.queue = append([]queuedMessage{next}, c.queue...)
+			c.reconnecting = false
+			c.stateMu.Unlock()
+			c.connLost(err)
+			return
+		}
+		if !response.Success {
+			c.logger.Warn("queued message rejected", "command", next.command, "error", response.Message)
+		}
+	}
+}
+
+// QueueLength returns the number of messages waiting for the connection to come back
+func (c *Client) QueueLength() int {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return len(c.queue)
+}
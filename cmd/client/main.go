@@ -2,31 +2,34 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strings"
 	"tcp_server/client"
 	"tcp_server/protocol"
+	"time"
 )
 
 func main() {
-	// Set up logging
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	heartbeat := flag.Duration("heartbeat", 10*time.Second, "Ping the server this often (0 = disabled)")
+	flag.Parse()
 
 	// Server address
 	address := "localhost:8080"
-	if len(os.Args) > 1 {
-		address = os.Args[1]
+	if flag.NArg() > 0 {
+		address = flag.Arg(0)
 	}
 
 	// Create client
-	c := client.NewClient(address)
+	c := client.NewClient(address, client.WithHeartbeat(*heartbeat, 3))
 
 	// Connect to server
 	fmt.Printf("🔌 Connecting to server at %s...\n", address)
 	if err := c.Connect(); err != nil {
-		log.Fatalf("Failed to connect: %v", err)
+		slog.Error("failed to connect", "address", address, "error", err)
+		os.Exit(1)
 	}
 	defer c.Close()
 
@@ -37,13 +40,19 @@ func main() {
 
 	for {
 		fmt.Println("\n📋 Available commands:")
-		fmt.Println("  1. REGISTER      - Register your username")
+		fmt.Println("  1. REGISTER      - Register your username (add \"name key\" for another session)")
 		fmt.Println("  2. MESSAGE       - Send a chat message")
 		fmt.Println("  3. LIST_USERS    - List online users")
 		fmt.Println("  4. ECHO          - Test echo")
 		fmt.Println("  5. TIME          - Get server time")
 		fmt.Println("  6. LIST_MESSAGES - List recent messages")
 		fmt.Println("  7. QUIT          - Disconnect")
+		fmt.Println("  8. STATUS        - Set your status (online, away, busy or custom text)")
+		fmt.Println("  Rooms & sessions: PM, JOIN_ROOM, LEAVE_ROOM, LIST_ROOMS, SAY room text, SESSIONS, KILL_SESSION")
+		fmt.Println("  Messages: EDIT id text, DELETE id, REACT id emoji, UNREACT id emoji")
+		fmt.Println("  Threads: REPLY id text, THREAD id [page], FOLLOW id, UNFOLLOW id")
+		fmt.Println("  Search: SEARCH words \"a phrase\" from:user in:room after:2024-05-01 before:24h page:2")
+		fmt.Println("  Operators: OPER, KICK, BAN, UNBAN, MUTE, UNMUTE, NOTICE, CLEAR_HISTORY, LIST_CONNECTIONS")
 		fmt.Print("\nEnter command (or number): ")
 
 		if !scanner.Scan() {
@@ -71,6 +80,8 @@ func main() {
 			input = "LIST_MESSAGES"
 		case "7":
 			input = "QUIT"
+		case "8":
+			input = "STATUS"
 		}
 
 		command := strings.ToUpper(input)
@@ -124,7 +135,30 @@ func main() {
 			return
 
 		default:
-			fmt.Printf("❌ Unknown command: %s\n", command)
+			// Any other command the protocol knows (e.g., admin commands) is sent as-is
+			spec, ok := protocol.LookupCommand(command)
+			if !ok {
+				fmt.Printf("❌ Unknown command: %s\n", command)
+				break
+			}
+
+			prompt := "Enter data (optional): "
+			if spec.RequiresData {
+				prompt = "Enter data: "
+			}
+			fmt.Print(prompt)
+			if !scanner.Scan() {
+				return
+			}
+			response, err := c.SendMessage(command, strings.TrimSpace(scanner.Text()))
+			if err != nil {
+				fmt.Printf("❌ Error: %v\n", err)
+				break
+			}
+			fmt.Printf("Response: %s\n", response.Message)
+			if response.Data != "" {
+				fmt.Println(response.Data)
+			}
 		}
 	}
 }
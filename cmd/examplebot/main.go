@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"tcp_server/bot"
+	"time"
+)
+
+func main() {
+	name := flag.String("name", "helper", "Bot username")
+	rooms := flag.String("rooms", "", "Comma-separated rooms to join (the lobby and private messages always work)")
+	stateFile := flag.String("state", "examplebot.json", "File the bot keeps its state in (empty = no persistence)")
+	prefix := flag.String("prefix", "!", "Prefix that marks a message as a command")
+	announce := flag.Duration("announce", 0, "Post the uptime to the lobby this often (0 = never)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: examplebot [flags] [address]\n\n")
+		fmt.Fprintf(os.Stderr, "Commands: !ping, !echo text, !count, !roll [sides], !help\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	address := "localhost:8080"
+	if flag.NArg() > 0 {
+		address = flag.Arg(0)
+	}
+
+	opts := []bot.Option{bot.WithPrefix(*prefix)}
+	if *rooms != "" {
+		opts = append(opts, bot.WithRooms(strings.Split(*rooms, ",")...))
+	}
+	if *stateFile != "" {
+		opts = append(opts, bot.WithStore(bot.FileStore(*stateFile)))
+	}
+	b := bot.New(address, *name, opts...)
+
+	started := time.Now()
+	b.Handle("ping", "Check that the bot is alive", func(ctx *bot.Context) error {
+		return ctx.Reply("pong")
+	})
+	b.Handle("echo", "Repeat the text", func(ctx *bot.Context) error {
+		if ctx.Args == "" {
+			return fmt.Errorf("usage: %secho text", *prefix)
+		}
+		return ctx.Reply(ctx.Args)
+	})
+	b.Handle("count", "Count how often this was asked, across restarts", func(ctx *bot.Context) error {
+		n, _ := strconv.Atoi(ctx.Bot.Get("count"))
+		n++
+		ctx.Bot.Set("count", strconv.Itoa(n))
+		return ctx.Reply(fmt.Sprintf("Asked %d time(s)", n))
+	})
+	b.Handle("roll", "Roll a die (default 6 sides)", func(ctx *bot.Context) error {
+		sides := 6
+		if fields := ctx.Fields(); len(fields) > 0 {
+			n, err := strconv.Atoi(fields[0])
+			if err != nil || n < 2 {
+				return fmt.Errorf("sides must be a number of at least 2")
+			}
+			sides = n
+		}
+		return ctx.Reply(fmt.Sprintf("🎲 %s rolled %d", ctx.From, rand.IntN(sides)+1))
+	})
+	if *announce > 0 {
+		b.Every(*announce, func(ctx context.Context, b *bot.Bot) error {
+			return b.Say("", fmt.Sprintf("⏱️ Up for %s", time.Since(started).Round(time.Second)))
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := b.Run(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+}
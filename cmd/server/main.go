@@ -1,28 +1,270 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"tcp_server/logging"
+	"tcp_server/proxyproto"
 	"tcp_server/server"
+	"tcp_server/sockopt"
+	"tcp_server/webhook"
+	"time"
 )
 
 func main() {
+	// Command-line flags
+	logLevel := flag.String("log-level", "info", "Minimum log level (debug, info, warn, error)")
+	logFormat := flag.String("log-format", logging.FormatText, "Log output format (text or json)")
+	redact := flag.Bool("redact", false, "Keep message bodies out of the logs")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics over HTTP on this address (e.g., :9090)")
+	apiAddr := flag.String("api-addr", "", "Serve the HTTP/JSON API at /api/ on this address (e.g., :8082)")
+	botTokensFile := flag.String("bot-tokens", "", "File of HTTP API bot credentials, one name:token per line")
+	webhooksFile := flag.String("webhooks", "", "JSON file of outgoing webhooks to POST chat events to")
+	messageStore := flag.String("message-store", "", "Keep messages in this file (JSON lines), rebuild history and the search index from it on start and compact old edits away")
+	deadLetterFile := flag.String("webhook-dead-letters", "", "Append undeliverable webhook payloads to this file (JSON lines)")
+	wsAddr := flag.String("ws-addr", "", "Serve WebSocket clients at /ws on this HTTP address, with optional listener parameters (e.g., :8081?max=500)")
+	operatorsFile := flag.String("operators", "", "File of operator credentials, one name:password per line")
+	idleTimeout := flag.Duration("idle-timeout", 10*time.Minute, "Mark users away after this long without a command (0 = never)")
+	heartbeat := flag.Duration("heartbeat", 0, "Ping clients this often, e.g. 15s (0 = disabled; clients must answer with PONG)")
+	heartbeatMissed := flag.Int("heartbeat-missed", 3, "Close connections after this many unanswered pings")
+	resumeWindow := flag.Duration("resume-window", 2*time.Minute, "How long a dropped session can be resumed (0 = disabled)")
+	keepAlive := flag.String("keepalive", "", `TCP keepalive as "idle,interval,count" (e.g., 30s,10s,3) or "off" (default: Go default)`)
+	noDelay := flag.Bool("nodelay", true, "Set TCP_NODELAY (false enables Nagle's algorithm)")
+	readBuffer := flag.Int("rcvbuf", 0, "Socket receive buffer size in bytes (0 = OS default)")
+	writeBuffer := flag.Int("sndbuf", 0, "Socket send buffer size in bytes (0 = OS default)")
+	linger := flag.Duration("linger", -1, "SO_LINGER on close; 0 discards unsent data (negative = OS default)")
+	var listeners []string
+	flag.Func("listen", `Additional listener, repeatable: address plus optional policy, e.g. ":8443?name=public&cert=c.pem&key=k.pem&auth&max=500&rate=5&burst=10" or "unix:///path/chat.sock?codec=text"`, func(v string) error {
+		listeners = append(listeners, v)
+		return nil
+	})
+	proxyProtocol := flag.String("proxy-protocol", "", "Comma-separated CIDRs of load balancers that send PROXY v1/v2 headers to the main address")
+	socketMode := flag.String("socket-mode", "0660", "Permissions of Unix socket files (octal)")
+	controlAddr := flag.String("control", "", "Operator control socket path, or tcp:127.0.0.1:port")
+	flag.Parse()
+
 	// Set up logging
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logger, err := logging.New(logging.Config{Level: level, Format: *logFormat})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
 
 	// Server address
 	address := ":8080"
-	if len(os.Args) > 1 {
-		address = os.Args[1]
+	if flag.NArg() > 0 {
+		address = flag.Arg(0)
+	}
+
+	// Load operator credentials for OPER
+	operators := map[string]string{}
+	if *operatorsFile != "" {
+		operators, err = loadCredentials(*operatorsFile)
+		if err != nil {
+			logger.Error("failed to load operators", "file", *operatorsFile, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Load bot tokens for the HTTP API
+	botTokens := map[string]string{}
+	if *botTokensFile != "" {
+		botTokens, err = loadBotTokens(*botTokensFile)
+		if err != nil {
+			logger.Error("failed to load bot tokens", "file", *botTokensFile, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Extra listeners (TCP, TLS or Unix sockets) have their own policy but share the same users and rooms
+	mode, err := strconv.ParseUint(*socketMode, 8, 32)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -socket-mode %q\n", *socketMode)
+		os.Exit(2)
+	}
+	var listenOpts []server.Option
+	for _, spec := range listeners {
+		cfg, err := server.ParseListenerConfig(spec)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if cfg.Mode == 0 {
+			cfg.Mode = os.FileMode(mode)
+		}
+		listenOpts = append(listenOpts, server.WithListener(cfg))
+	}
+
+	// Real client addresses from trusted load balancers
+	if *proxyProtocol != "" {
+		trusted, err := proxyproto.ParsePrefixes(*proxyProtocol)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		listenOpts = append(listenOpts, server.WithProxyProtocol(trusted...))
+	}
+
+	// Socket options for accepted connections
+	socketOpts := []server.Option{
+		server.WithNoDelay(*noDelay),
+		server.WithSocketBuffers(*readBuffer, *writeBuffer),
+	}
+	keepAliveCfg, err := sockopt.ParseKeepAlive(*keepAlive)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if keepAliveCfg != nil {
+		socketOpts = append(socketOpts, server.WithKeepAlive(*keepAliveCfg))
+	}
+	if *linger >= 0 {
+		socketOpts = append(socketOpts, server.WithLinger(*linger))
+	}
+
+	// Durable messages for history and search across restarts
+	var storeOpts []server.Option
+	if *messageStore != "" {
+		store, err := server.OpenFileMessageStore(*messageStore)
+		if err != nil {
+			logger.Error("failed to open message store", "file", *messageStore, "error", err)
+			os.Exit(1)
+		}
+		defer store.Close()
+		storeOpts = append(storeOpts, server.WithMessageStore(store))
 	}
 
 	// Create server
-	srv := server.NewServer(address)
+	var srv *server.Server
+	srv = server.NewServer(address, append(append(append(socketOpts, listenOpts...), storeOpts...),
+		server.WithOperators(operators),
+		server.WithBotTokens(botTokens),
+		server.WithReloadFunc(func() error {
+			// RELOAD re-reads the operators and bot token files
+			if *operatorsFile != "" {
+				operators, err := loadCredentials(*operatorsFile)
+				if err != nil {
+					return err
+				}
+				srv.SetOperators(operators)
+				logger.Info("operators reloaded", "count", len(operators))
+			}
+			if *botTokensFile != "" {
+				tokens, err := loadBotTokens(*botTokensFile)
+				if err != nil {
+					return err
+				}
+				srv.SetBotTokens(tokens)
+				logger.Info("bot tokens reloaded", "count", len(tokens))
+			}
+			return nil
+		}),
+		server.WithLogger(logger),
+		server.WithRedaction(*redact),
+		server.WithIdleTimeout(*idleTimeout),
+		server.WithResumeWindow(*resumeWindow),
+		server.WithHeartbeat(*heartbeat, *heartbeatMissed),
+	)...)
 	defer srv.Shutdown()
 
+	// Expose metrics on a separate HTTP listener if requested
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", srv.Metrics())
+		go func() {
+			logger.Info("metrics endpoint started", "address", *metricsAddr)
+			if err := http.ListenAndServe(*metricsAddr, mux); err != nil {
+				logger.Error("metrics endpoint error", "error", err)
+			}
+		}()
+	}
+
+	// POST selected events to outgoing webhooks
+	if *webhooksFile != "" {
+		hooks, err := webhook.LoadFile(*webhooksFile)
+		if err != nil {
+			logger.Error("failed to load webhooks", "file", *webhooksFile, "error", err)
+			os.Exit(1)
+		}
+		hookOpts := []webhook.Option{webhook.WithLogger(logger)}
+		if *deadLetterFile != "" {
+			deadLetters, err := os.OpenFile(*deadLetterFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+			if err != nil {
+				logger.Error("failed to open webhook dead-letter log", "file", *deadLetterFile, "error", err)
+				os.Exit(1)
+			}
+			defer deadLetters.Close()
+			hookOpts = append(hookOpts, webhook.WithDeadLetterLog(deadLetters))
+		}
+		dispatcher, err := webhook.New(hooks, hookOpts...)
+		if err != nil {
+			logger.Error("invalid webhooks", "file", *webhooksFile, "error", err)
+			os.Exit(1)
+		}
+		defer dispatcher.Close()
+		defer srv.Subscribe(dispatcher.Handle)()
+		logger.Info("webhooks enabled", "count", len(hooks))
+	}
+
+	// Serve the HTTP/JSON API for bots if requested
+	if *apiAddr != "" {
+		go func() {
+			logger.Info("http api started", "address", *apiAddr)
+			if err := http.ListenAndServe(*apiAddr, srv.APIHandler()); err != nil {
+				logger.Error("http api error", "error", err)
+			}
+		}()
+	}
+
+	// Bridge browsers to the chat over WebSocket if requested
+	if *wsAddr != "" {
+		cfg, err := server.ParseListenerConfig(*wsAddr)
+		if err != nil {
+			logger.Error("invalid websocket gateway", "error", err)
+			os.Exit(1)
+		}
+		l, err := net.Listen("tcp", cfg.Address)
+		if err != nil {
+			logger.Error("failed to open websocket gateway", "address", cfg.Address, "error", err)
+			os.Exit(1)
+		}
+		go func() {
+			if err := srv.ServeWebSocket(l, cfg); err != nil {
+				logger.Error("websocket gateway error", "error", err)
+			}
+		}()
+	}
+
+	// Serve the operator control channel if requested
+	if *controlAddr != "" {
+		control, err := server.ListenControl(*controlAddr)
+		if err != nil {
+			logger.Error("failed to open control channel", "address", *controlAddr, "error", err)
+			os.Exit(1)
+		}
+		defer control.Close()
+		go func() {
+			if err := srv.ServeControl(control); err != nil {
+				logger.Error("control channel error", "error", err)
+			}
+		}()
+	}
+
 	// Set up graceful shutdown on Ctrl+C
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -30,11 +272,52 @@ func main() {
 	// Start server in goroutine
 	go func() {
 		if err := srv.Start(); err != nil {
-			log.Fatalf("Server error: %v", err)
+			logger.Error("server error", "error", err)
+			os.Exit(1)
 		}
 	}()
 
 	// Wait for shutdown signal
-	<-sigChan
-	fmt.Println("\n\n🛑 Received shutdown signal...")
+	sig := <-sigChan
+	logger.Info("received shutdown signal", "signal", sig.String())
+}
+
+// loadCredentials reads credentials, one name:secret per line
+// Blank lines and lines starting with # are ignored
+func loadCredentials(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	credentials := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, secret, ok := strings.Cut(line, ":")
+		if !ok || name == "" || secret == "" {
+			return nil, fmt.Errorf("line %d: expected name:secret", lineNo)
+		}
+		credentials[name] = secret
+	}
+	return credentials, scanner.Err()
+}
+
+// loadBotTokens reads bot credentials (name:token) and returns them keyed by token
+func loadBotTokens(path string) (map[string]string, error) {
+	bots, err := loadCredentials(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make(map[string]string, len(bots))
+	for name, token := range bots {
+		tokens[token] = name
+	}
+	return tokens, nil
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"tcp_server/server"
+)
+
+func main() {
+	address := flag.String("socket", "/tmp/tcp_server.sock", "Control socket path, or tcp:127.0.0.1:port")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: serverctl [-socket path] [command [args...]]\n\n")
+		fmt.Fprintf(os.Stderr, "Commands: STATS, CLIENTS, KICK user [reason], DRAIN, RELOAD, HISTORY [n], HELP\n")
+		fmt.Fprintf(os.Stderr, "Without a command, serverctl reads commands from stdin.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	conn, err := server.DialControl(*address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to connect to %s: %v\n", *address, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	// One-shot mode: run the command given on the command line
+	if flag.NArg() > 0 {
+		if !run(conn, reader, strings.Join(flag.Args(), " ")) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Interactive mode: one command per line
+	scanner := bufio.NewScanner(os.Stdin)
+	fmt.Print("serverctl> ")
+	for scanner.Scan() {
+		command := strings.TrimSpace(scanner.Text())
+		if command != "" {
+			run(conn, reader, command)
+			if strings.EqualFold(command, "QUIT") {
+				return
+			}
+		}
+		fmt.Print("serverctl> ")
+	}
+}
+
+// run sends one command and prints the reply; it returns false if the server answered ERR
+func run(conn io.Writer, reader *bufio.Reader, command string) bool {
+	if _, err := fmt.Fprintf(conn, "%s\n", command); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to send command: %v\n", err)
+		os.Exit(1)
+	}
+
+	summary, body, err := server.ReadControlReply(reader)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return false
+	}
+
+	fmt.Printf("✅ %s\n", summary)
+	for _, line := range body {
+		fmt.Println(line)
+	}
+	return true
+}
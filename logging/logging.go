@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Output formats supported by New
+const (
+	FormatText = "text" // key=value lines, easy to read in a terminal
+	FormatJSON = "json" // one JSON object per line, for log collectors
+)
+
+// Config describes how to build a structured logger
+type Config struct {
+	Level  slog.Level // Minimum level to write (e.g., slog.LevelInfo)
+	Format string     // FormatText or FormatJSON
+	Output io.Writer  // Where log records are written (defaults to stderr)
+}
+
+// New creates a slog logger writing to the configured sink
+// Any other slog.Handler can be plugged in with slog.New directly
+func New(cfg Config) (*slog.Logger, error) {
+	out := cfg.Output
+	if out == nil {
+		out = os.Stderr
+	}
+
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(out, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(out, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", cfg.Format)
+	}
+}
+
+// ParseLevel converts a level name (debug, info, warn, error) to a slog.Level
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level: %s", name)
+	}
+	return level, nil
+}
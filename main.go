@@ -2,7 +2,8 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"tcp_server/client"
 	"tcp_server/server"
 	"time"
@@ -12,13 +13,14 @@ import (
 // For actual usage, run cmd/server/main.go and cmd/client/main.go separately
 func main() {
 	fmt.Println("🎓 TCP/IP Demo")
-	fmt.Println("===========================\n")
+	fmt.Println("===========================")
+	fmt.Println()
 
 	// Start server in background
 	srv := server.NewServer(":9999")
 	go func() {
 		if err := srv.Start(); err != nil {
-			log.Printf("Server error: %v", err)
+			slog.Error("server error", "error", err)
 		}
 	}()
 
@@ -33,13 +35,15 @@ func main() {
 	// Connect clients
 	fmt.Println("\n🔌 Connecting Client 1...")
 	if err := client1.Connect(); err != nil {
-		log.Fatalf("Client 1 connection failed: %v", err)
+		slog.Error("client 1 connection failed", "error", err)
+		os.Exit(1)
 	}
 	defer func() { _ = client1.Close() }()
 
 	fmt.Println("🔌 Connecting Client 2...")
 	if err := client2.Connect(); err != nil {
-		log.Fatalf("Client 2 connection failed: %v", err)
+		slog.Error("client 2 connection failed", "error", err)
+		os.Exit(1)
 	}
 	defer func() { _ = client2.Close() }()
 
@@ -0,0 +1,370 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds metric families and renders them in the Prometheus text format
+// Implemented with the standard library only (no client_golang dependency)
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+// family is a named group of samples that can render itself
+type family interface {
+	name() string
+	write(w io.Writer)
+}
+
+// NewRegistry creates an empty metrics registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register adds a family to the registry
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// WriteText writes every metric in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name() < families[j].name() })
+	for _, f := range families {
+		f.write(w)
+	}
+}
+
+// ServeHTTP serves the metrics so the registry can be mounted at /metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+// desc holds the metadata shared by every metric type
+type desc struct {
+	metricName string
+	help       string
+	kind       string // counter, gauge or histogram
+	labelNames []string
+}
+
+func (d *desc) name() string { return d.metricName }
+
+// writeHeader writes the HELP and TYPE lines for a family
+func (d *desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.metricName, d.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.metricName, d.kind)
+}
+
+// Counter is a monotonically increasing integer value
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() { c.value.Add(1) }
+
+// Add increments the counter by n
+func (c *Counter) Add(n uint64) { c.value.Add(n) }
+
+// Value returns the current count
+func (c *Counter) Value() uint64 { return c.value.Load() }
+
+// counterFamily renders a single unlabeled counter
+type counterFamily struct {
+	desc
+	counter *Counter
+}
+
+func (f *counterFamily) write(w io.Writer) {
+	f.writeHeader(w)
+	fmt.Fprintf(w, "%s %d\n", f.metricName, f.counter.Value())
+}
+
+// NewCounter registers an unlabeled counter
+func (r *Registry) NewCounter(name, help string) *Counter {
+	f := &counterFamily{desc: desc{metricName: name, help: help, kind: "counter"}, counter: &Counter{}}
+	r.register(f)
+	return f.counter
+}
+
+// CounterVec is a set of counters partitioned by label values
+type CounterVec struct {
+	desc
+	mu       sync.Mutex
+	counters map[string]*Counter
+	values   map[string][]string
+}
+
+// NewCounterVec registers a counter family with the given label names
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	v := &CounterVec{
+		desc:     desc{metricName: name, help: help, kind: "counter", labelNames: labelNames},
+		counters: make(map[string]*Counter),
+		values:   make(map[string][]string),
+	}
+	r.register(v)
+	return v
+}
+
+// WithLabelValues returns the counter for the given label values, creating it if needed
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c, ok := v.counters[key]
+	if !ok {
+		c = &Counter{}
+		v.counters[key] = c
+		v.values[key] = append([]string(nil), values...)
+	}
+	return c
+}
+
+func (v *CounterVec) write(w io.Writer) {
+	v.writeHeader(w)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, key := range sortedKeys(v.counters) {
+		fmt.Fprintf(w, "%s%s %d\n", v.metricName, formatLabels(v.labelNames, v.values[key]), v.counters[key].Value())
+	}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64) { g.bits.Store(math.Float64bits(v)) }
+
+// Add adds delta (which may be negative) to the gauge
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if g.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// Value returns the current gauge value
+func (g *Gauge) Value() float64 { return math.Float64frombits(g.bits.Load()) }
+
+// gaugeFamily renders a single unlabeled gauge
+type gaugeFamily struct {
+	desc
+	value func() float64
+}
+
+func (f *gaugeFamily) write(w io.Writer) {
+	f.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", f.metricName, formatFloat(f.value()))
+}
+
+// NewGauge registers an unlabeled gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(&gaugeFamily{desc: desc{metricName: name, help: help, kind: "gauge"}, value: g.Value})
+	return g
+}
+
+// NewGaugeFunc registers a gauge whose value is computed at scrape time
+func (r *Registry) NewGaugeFunc(name, help string, value func() float64) {
+	r.register(&gaugeFamily{desc: desc{metricName: name, help: help, kind: "gauge"}, value: value})
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64 // Upper bounds, sorted ascending
+	counts  []uint64  // Observations per bucket (not cumulative)
+	sum     float64
+	count   uint64
+}
+
+// newHistogram creates a histogram with the given bucket upper bounds
+func newHistogram(buckets []float64) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Histogram{buckets: b, counts: make([]uint64, len(b))}
+}
+
+// Observe records a single observation
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// writeSamples writes the bucket, sum and count lines for one histogram
+func (h *Histogram) writeSamples(w io.Writer, name string, labelNames, labelValues []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	bucketLabels := append(append([]string(nil), labelNames...), "le")
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += h.counts[i]
+		values := append(append([]string(nil), labelValues...), formatFloat(upper))
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(bucketLabels, values), cumulative)
+	}
+	values := append(append([]string(nil), labelValues...), "+Inf")
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(bucketLabels, values), h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(labelNames, labelValues), formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(labelNames, labelValues), h.count)
+}
+
+// histogramFamily renders a single unlabeled histogram
+type histogramFamily struct {
+	desc
+	histogram *Histogram
+}
+
+func (f *histogramFamily) write(w io.Writer) {
+	f.writeHeader(w)
+	f.histogram.writeSamples(w, f.metricName, nil, nil)
+}
+
+// NewHistogram registers an unlabeled histogram with the given bucket upper bounds
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	f := &histogramFamily{
+		desc:      desc{metricName: name, help: help, kind: "histogram"},
+		histogram: newHistogram(buckets),
+	}
+	r.register(f)
+	return f.histogram
+}
+
+// HistogramVec is a set of histograms partitioned by label values
+type HistogramVec struct {
+	desc
+	buckets    []float64
+	mu         sync.Mutex
+	histograms map[string]*Histogram
+	values     map[string][]string
+}
+
+// NewHistogramVec registers a histogram family with the given label names
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	v := &HistogramVec{
+		desc:       desc{metricName: name, help: help, kind: "histogram", labelNames: labelNames},
+		buckets:    buckets,
+		histograms: make(map[string]*Histogram),
+		values:     make(map[string][]string),
+	}
+	r.register(v)
+	return v
+}
+
+// WithLabelValues returns the histogram for the given label values, creating it if needed
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	h, ok := v.histograms[key]
+	if !ok {
+		h = newHistogram(v.buckets)
+		v.histograms[key] = h
+		v.values[key] = append([]string(nil), values...)
+	}
+	return h
+}
+
+func (v *HistogramVec) write(w io.Writer) {
+	v.writeHeader(w)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, key := range sortedKeys(v.histograms) {
+		v.histograms[key].writeSamples(w, v.metricName, v.labelNames, v.values[key])
+	}
+}
+
+// DefBuckets are latency buckets in seconds, suited to in-memory command handling
+var DefBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// formatLabels renders {name="value",...} or an empty string without labels
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// escapeLabel escapes backslashes, quotes and newlines in label values
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatFloat renders a sample value the way Prometheus expects
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// sortedKeys returns map keys in sorted order for stable output
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
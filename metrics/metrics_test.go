@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Requests by command.", "command")
+	requests.WithLabelValues("ECHO").Add(2)
+	requests.WithLabelValues(`say "hi"`).Inc()
+
+	r.NewGaugeFunc("clients", "Connected clients.", func() float64 { return 3 })
+
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	out := buf.String()
+
+	want := []string{
+		"# TYPE clients gauge\nclients 3\n",
+		"# HELP requests_total Requests by command.\n# TYPE requests_total counter\n",
+		`requests_total{command="ECHO"} 2`,
+		`requests_total{command="say \"hi\""} 1`,
+		"# TYPE latency_seconds histogram\n",
+		`latency_seconds_bucket{le="0.1"} 1`,
+		`latency_seconds_bucket{le="1"} 2`,
+		`latency_seconds_bucket{le="+Inf"} 3`,
+		"latency_seconds_sum 5.55\n",
+		"latency_seconds_count 3\n",
+	}
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("Output missing %q\n%s", w, out)
+		}
+	}
+
+	// Families are sorted by name for stable output
+	if strings.Index(out, "clients") > strings.Index(out, "latency_seconds") {
+		t.Error("Expected families in sorted order")
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	v := r.NewHistogramVec("duration_seconds", "Duration.", []float64{1}, "command")
+	v.WithLabelValues("TIME").Observe(0.5)
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+
+	want := `duration_seconds_bucket{command="TIME",le="1"} 1`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("Output missing %q\n%s", want, buf.String())
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("up_total", "Up.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "up_total 1") {
+		t.Errorf("Body missing counter:\n%s", rec.Body.String())
+	}
+}
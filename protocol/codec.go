@@ -0,0 +1,82 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Codec converts between wire frames and protocol values
+// Every frame is one line; EncodeResponse includes the trailing newline
+type Codec interface {
+	Name() string                                  // Name used in configuration (e.g., "json")
+	DecodeMessage(line []byte) (*Message, error)   // Parse one request line
+	EncodeResponse(resp *Response) ([]byte, error) // Encode a reply or event
+}
+
+// Codecs available to listeners
+var (
+	JSONCodec Codec = jsonCodec{} // One JSON object per line (the default)
+	TextCodec Codec = textCodec{} // "COMMAND data" lines for humans using telnet or netcat
+)
+
+// CodecByName returns the codec registered under name ("json" or "text")
+func CodecByName(name string) (Codec, bool) {
+	for _, c := range []Codec{JSONCodec, TextCodec} {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// jsonCodec is the JSON-lines wire format used by client.Client
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) DecodeMessage(line []byte) (*Message, error) {
+	var msg Message
+	if err := msg.FromJSON(line); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (jsonCodec) EncodeResponse(resp *Response) ([]byte, error) {
+	return resp.ToJSON()
+}
+
+// textCodec is a plain-text format: requests are "COMMAND data", replies are
+// "OK message" or "ERR CODE message" with data lines indented below, and events start with "*"
+type textCodec struct{}
+
+func (textCodec) Name() string { return "text" }
+
+func (textCodec) DecodeMessage(line []byte) (*Message, error) {
+	text := strings.TrimSpace(string(line))
+	if text == "" {
+		return nil, fmt.Errorf("empty line")
+	}
+	command, data, _ := strings.Cut(text, " ")
+	return &Message{Command: strings.ToUpper(command), Data: strings.TrimSpace(data)}, nil
+}
+
+func (textCodec) EncodeResponse(resp *Response) ([]byte, error) {
+	var b strings.Builder
+	switch {
+	case resp.IsEvent():
+		fmt.Fprintf(&b, "* %s\n", resp.Message)
+	case resp.Success:
+		fmt.Fprintf(&b, "OK %s\n", resp.Message)
+	default:
+		fmt.Fprintf(&b, "ERR %s %s\n", resp.Code, resp.Message)
+	}
+	// Event data is usually the chat text the line already shows; the rest (e.g., a ping's
+	// nonce, to be echoed with PONG) follows like a reply's
+	if resp.Data != "" && !(resp.IsEvent() && strings.Contains(resp.Message, resp.Data)) {
+		for _, line := range strings.Split(resp.Data, "\n") {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+	return []byte(b.String()), nil
+}
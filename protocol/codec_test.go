@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestTextCodec(t *testing.T) {
+	msg, err := TextCodec.DecodeMessage([]byte("message hello there\r\n"))
+	if err != nil {
+		t.Fatalf("DecodeMessage() error = %v", err)
+	}
+	if msg.Command != CmdMessage || msg.Data != "hello there" {
+		t.Errorf("DecodeMessage() = %+v", msg)
+	}
+	if _, err := TextCodec.DecodeMessage([]byte("  \n")); err == nil {
+		t.Error("Expected an error for an empty line")
+	}
+
+	tests := []struct {
+		resp *Response
+		want string
+	}{
+		{NewResponse(true, "Online users", "alice\nbob"), "OK Online users\n  alice\n  bob\n"},
+		{NewErrorResponse(CodeValidation, "Bad input"), "ERR VALIDATION Bad input\n"},
+		{NewEvent(EventJoin, "bob", "→ bob joined", ""), "* → bob joined\n"},
+		{NewEvent(EventMessage, "bob", "[Broadcast] bob: hi", "hi"), "* [Broadcast] bob: hi\n"},
+		{NewEvent(EventPing, "", "ping", "42"), "* ping\n  42\n"},
+	}
+	for _, tt := range tests {
+		got, err := TextCodec.EncodeResponse(tt.resp)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("EncodeResponse(%s) = %q, %v; want %q", tt.resp, got, err, tt.want)
+		}
+	}
+}
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+	line, err := NewMessage("", CmdEcho, "hi").ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := JSONCodec.DecodeMessage(line)
+	if err != nil || msg.Command != CmdEcho || msg.Data != "hi" {
+		t.Errorf("DecodeMessage() = %+v, %v", msg, err)
+	}
+
+	if c, ok := CodecByName("text"); !ok || c != TextCodec {
+		t.Error("CodecByName(text) did not return TextCodec")
+	}
+	if _, ok := CodecByName("xml"); ok {
+		t.Error("CodecByName(xml) should fail")
+	}
+}
@@ -3,6 +3,7 @@ package protocol
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 )
 
 // Message represents a structured message exchanged between client and server
@@ -15,22 +16,181 @@ type Message struct {
 
 // Response represents the server's response to a client request
 type Response struct {
-	Success bool   `json:"success"` // Whether the operation succeeded
-	Message string `json:"message"` // Response message or error description
-	Data    string `json:"data"`    // Optional response data
+	Success bool   `json:"success"`            // Whether the operation succeeded
+	Message string `json:"message"`            // Response message or error description
+	Data    string `json:"data"`               // Optional response data
+	Code    string `json:"code,omitempty"`     // Machine-readable error code (failures only)
+	Event   string `json:"event,omitempty"`    // Event type for server-initiated pushes (empty for replies)
+	From    string `json:"from,omitempty"`     // Username that caused the event
+	Room    string `json:"room,omitempty"`     // Room the event happened in (empty = lobby)
+	To      string `json:"to,omitempty"`       // Recipient of a private message
+	Seq     uint64 `json:"seq,omitempty"`      // Event sequence number, acknowledged when resuming a session
+	ID      uint64 `json:"id,omitempty"`       // Message the event is about (message, edit, delete and reaction events)
+	ReplyTo uint64 `json:"reply_to,omitempty"` // Thread a reply belongs to (ID of its first message)
+	Key     string `json:"key,omitempty"`      // Secret for registering more sessions of the user (REGISTER and RESUME replies)
 }
 
 // Command constants - these define the protocol's vocabulary
 const (
-	CmdEcho         = "ECHO"          // Echo back the data (for testing)
-	CmdRegister     = "REGISTER"      // Register a username
-	CmdMessage      = "MESSAGE"       // Send a chat message
-	CmdListUsers    = "LIST_USERS"    // Get list of online users
-	CmdListMessages = "LIST_MESSAGES" // Get list of recent messages
-	CmdTime         = "TIME"          // Get server time
-	CmdQuit         = "QUIT"          // Disconnect from server
+	CmdEcho           = "ECHO"          // Echo back the data (for testing)
+	CmdRegister       = "REGISTER"      // Register a username ("name", or "name key" to add a session)
+	CmdMessage        = "MESSAGE"       // Send a chat message
+	CmdSay            = "SAY"           // Send a chat message to one of your rooms without switching to it ("room text")
+	CmdListUsers      = "LIST_USERS"    // Get list of online users
+	CmdListMessages   = "LIST_MESSAGES" // Get list of recent messages
+	CmdTime           = "TIME"          // Get server time
+	CmdQuit           = "QUIT"          // Disconnect from server
+	CmdStatus         = "STATUS"        // Set presence ("online", "away [text]", "busy [text]" or custom text)
+	CmdPrivateMessage = "PM"            // Send a private message ("username:message")
+	CmdJoinRoom       = "JOIN_ROOM"     // Join a room and make it the target of MESSAGE
+	CmdLeaveRoom      = "LEAVE_ROOM"    // Leave a room
+	CmdListRooms      = "LIST_ROOMS"    // List rooms and their member counts
+	CmdSessions       = "SESSIONS"      // List your sessions (one per connection)
+	CmdKillSession    = "KILL_SESSION"  // Disconnect one of your other sessions by ID
+	CmdResume         = "RESUME"        // Resume a dropped session ("token lastSeq")
+	CmdPing           = "PING"          // Heartbeat; answered with a "pong" event (no reply)
+	CmdPong           = "PONG"          // Answer to a "ping" event (no reply)
+	CmdEdit           = "EDIT"          // Change one of your messages ("id new text")
+	CmdDelete         = "DELETE"        // Delete one of your messages ("id")
+	CmdReact          = "REACT"         // Add an emoji reaction to a message ("id emoji")
+	CmdUnreact        = "UNREACT"       // Remove your emoji reaction from a message ("id emoji")
+	CmdReply          = "REPLY"         // Reply in a message's thread ("id text")
+	CmdThread         = "THREAD"        // List a thread's replies ("id [page]")
+	CmdFollow         = "FOLLOW"        // Receive a thread's replies as events ("id")
+	CmdUnfollow       = "UNFOLLOW"      // Stop receiving a thread's replies ("id")
+	CmdSearch         = "SEARCH"        // Full-text search ("words \"a phrase\" from:user in:room after:date before:date page:n")
+
+	// Admin commands - require the admin role (granted by OPER)
+	CmdOper            = "OPER"             // Authenticate as an operator ("name password")
+	CmdKick            = "KICK"             // Disconnect a user ("username [reason]")
+	CmdBan             = "BAN"              // Ban a username, IP or CIDR ("target [reason]")
+	CmdUnban           = "UNBAN"            // Lift a ban ("target")
+	CmdMute            = "MUTE"             // Stop a user from sending messages ("username [duration]")
+	CmdUnmute          = "UNMUTE"           // Lift a mute ("username")
+	CmdNotice          = "NOTICE"           // Broadcast a system notice to everyone
+	CmdClearHistory    = "CLEAR_HISTORY"    // Delete the message history
+	CmdListConnections = "LIST_CONNECTIONS" // List connections with addresses and connect times
+)
+
+// Error codes - set on failed responses so clients can react without parsing text
+const (
+	CodeInvalidMessage = "INVALID_MESSAGE" // Message could not be parsed
+	CodeValidation     = "VALIDATION"      // Message failed validation
+	CodeUnknownCommand = "UNKNOWN_COMMAND" // No handler for the command
+	CodeAuthRequired   = "AUTH_REQUIRED"   // Command requires registration
+	CodeRateLimited    = "RATE_LIMITED"    // Client exceeded its rate limit
+	CodeInternal       = "INTERNAL_ERROR"  // Server failed while handling the command
+	CodeRejected       = "REJECTED"        // Server refused the connection
+	CodeForbidden      = "FORBIDDEN"       // Client lacks the role or permission for the command
+	CodeNotFound       = "NOT_FOUND"       // Target of the command does not exist
+)
+
+// Event types - pushed by the server without a matching request
+const (
+	EventMessage = "message" // A chat message from another user
+	EventNotice  = "notice"  // A system notice from an operator
+	EventKicked  = "kicked"  // The receiving connection is being disconnected by an operator
+	EventJoin    = "join"    // A user registered
+	EventLeave   = "leave"   // A registered user disconnected
+	EventRename  = "rename"  // A user changed their name (Data holds the old name)
+	EventStatus  = "status"  // A user's presence status changed (Data holds the status)
+	EventEdit    = "edit"    // A message was edited (ID names it, Data holds the new text)
+	EventDelete  = "delete"  // A message was deleted (ID names it)
+	EventReact   = "react"   // A user reacted to a message (Data holds the emoji)
+	EventUnreact = "unreact" // A user removed a reaction (Data holds the emoji)
+	EventReply   = "reply"   // A reply in a thread you follow (ReplyTo names the thread)
+
+	EventPrivateMessage = "pm" // A private message (To holds the recipient)
+
+	EventPing = "ping" // Server heartbeat; answer with PONG and the same Data
+	EventPong = "pong" // Answer to a PING (Data echoes the PING's data)
 )
 
+// ListUsersWithStatus is the LIST_USERS data that asks for status and idle time
+const ListUsersWithStatus = "status"
+
+// CommandSpec describes the shape of a protocol command
+type CommandSpec struct {
+	Name         string // Command name as sent on the wire (e.g., "ECHO")
+	RequiresData bool   // Whether the command must carry a non-empty Data field
+}
+
+// CommandSet looks up command specs by name
+// Validate consults a CommandSet to decide which commands are known
+type CommandSet interface {
+	Lookup(name string) (CommandSpec, bool)
+}
+
+// commandTable is a thread-safe CommandSet backed by a map
+type commandTable struct {
+	mu    sync.RWMutex
+	specs map[string]CommandSpec
+}
+
+// Lookup returns the spec for a command name
+func (t *commandTable) Lookup(name string) (CommandSpec, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	spec, ok := t.specs[name]
+	return spec, ok
+}
+
+// defaultCommands holds the built-in commands plus any registered by the application
+var defaultCommands = &commandTable{
+	specs: map[string]CommandSpec{
+		CmdEcho:           {Name: CmdEcho, RequiresData: true},
+		CmdRegister:       {Name: CmdRegister, RequiresData: true},
+		CmdMessage:        {Name: CmdMessage, RequiresData: true},
+		CmdListUsers:      {Name: CmdListUsers},
+		CmdListMessages:   {Name: CmdListMessages},
+		CmdTime:           {Name: CmdTime},
+		CmdQuit:           {Name: CmdQuit},
+		CmdStatus:         {Name: CmdStatus, RequiresData: true},
+		CmdPrivateMessage: {Name: CmdPrivateMessage, RequiresData: true},
+		CmdJoinRoom:       {Name: CmdJoinRoom, RequiresData: true},
+		CmdLeaveRoom:      {Name: CmdLeaveRoom, RequiresData: true},
+		CmdListRooms:      {Name: CmdListRooms},
+		CmdSessions:       {Name: CmdSessions},
+		CmdKillSession:    {Name: CmdKillSession, RequiresData: true},
+		CmdResume:         {Name: CmdResume, RequiresData: true},
+		CmdPing:           {Name: CmdPing},
+		CmdPong:           {Name: CmdPong},
+		CmdEdit:           {Name: CmdEdit, RequiresData: true},
+		CmdDelete:         {Name: CmdDelete, RequiresData: true},
+		CmdReact:          {Name: CmdReact, RequiresData: true},
+		CmdUnreact:        {Name: CmdUnreact, RequiresData: true},
+		CmdReply:          {Name: CmdReply, RequiresData: true},
+		CmdThread:         {Name: CmdThread, RequiresData: true},
+		CmdFollow:         {Name: CmdFollow, RequiresData: true},
+		CmdUnfollow:       {Name: CmdUnfollow, RequiresData: true},
+		CmdSearch:         {Name: CmdSearch, RequiresData: true},
+		CmdSay:            {Name: CmdSay, RequiresData: true},
+
+		CmdOper:            {Name: CmdOper, RequiresData: true},
+		CmdKick:            {Name: CmdKick, RequiresData: true},
+		CmdBan:             {Name: CmdBan, RequiresData: true},
+		CmdUnban:           {Name: CmdUnban, RequiresData: true},
+		CmdMute:            {Name: CmdMute, RequiresData: true},
+		CmdUnmute:          {Name: CmdUnmute, RequiresData: true},
+		CmdNotice:          {Name: CmdNotice, RequiresData: true},
+		CmdClearHistory:    {Name: CmdClearHistory},
+		CmdListConnections: {Name: CmdListConnections},
+	},
+}
+
+// RegisterCommand adds a command to the default command set used by Validate
+// Clients call this so they can send private commands a server has registered
+func RegisterCommand(spec CommandSpec) {
+	defaultCommands.mu.Lock()
+	defer defaultCommands.mu.Unlock()
+	defaultCommands.specs[spec.Name] = spec
+}
+
+// LookupCommand returns the spec for a command in the default command set
+func LookupCommand(name string) (CommandSpec, bool) {
+	return defaultCommands.Lookup(name)
+}
+
 // NewMessage creates a new message with the given command and data
 func NewMessage(from, command, data string) *Message {
 	return &Message{
@@ -49,6 +209,32 @@ func NewResponse(success bool, message, data string) *Response {
 	}
 }
 
+// NewErrorResponse creates a failed response carrying an error code
+func NewErrorResponse(code, message string) *Response {
+	return &Response{
+		Success: false,
+		Message: message,
+		Code:    code,
+	}
+}
+
+// NewEvent creates a server-initiated push
+// message is human-readable text; data carries the raw payload
+func NewEvent(event, from, message, data string) *Response {
+	return &Response{
+		Success: true,
+		Message: message,
+		Data:    data,
+		Event:   event,
+		From:    from,
+	}
+}
+
+// IsEvent returns true if the response is a server push rather than a reply
+func (r *Response) IsEvent() bool {
+	return r.Event != ""
+}
+
 // ToJSON converts a message to JSON bytes
 func (m *Message) ToJSON() ([]byte, error) {
 	data, err := json.Marshal(m)
@@ -85,35 +271,26 @@ func (r *Response) FromJSON(data []byte) error {
 	return nil
 }
 
-// Validate checks if a message is valid
+// Validate checks if a message is valid against the default command set
 func (m *Message) Validate() error {
+	return m.ValidateWith(defaultCommands)
+}
+
+// ValidateWith checks if a message is valid against the given command set
+// Servers pass their own command registry so private commands are accepted
+func (m *Message) ValidateWith(commands CommandSet) error {
 	if m.Command == "" {
 		return fmt.Errorf("command cannot be empty")
 	}
 
 	// Validate known commands
-	validCommands := map[string]bool{
-		CmdEcho:         true,
-		CmdRegister:     true,
-		CmdMessage:      true,
-		CmdListUsers:    true,
-		CmdListMessages: true,
-		CmdTime:         true,
-		CmdQuit:         true,
-	}
-
-	if !validCommands[m.Command] {
+	spec, ok := commands.Lookup(m.Command)
+	if !ok {
 		return fmt.Errorf("unknown command: %s", m.Command)
 	}
 
 	// Some commands require data
-	requiresData := map[string]bool{
-		CmdEcho:     true,
-		CmdRegister: true,
-		CmdMessage:  true,
-	}
-
-	if requiresData[m.Command] && m.Data == "" {
+	if spec.RequiresData && m.Data == "" {
 		return fmt.Errorf("command %s requires data", m.Command)
 	}
 
@@ -5,7 +5,7 @@ import (
 )
 
 func TestNewMessage(t *testing.T) {
-	msg := NewMessage("ECHO", "Hello")
+	msg := NewMessage("", "ECHO", "Hello")
 
 	if msg.Command != "ECHO" {
 		t.Errorf("Expected command to be ECHO, got %s", msg.Command)
@@ -64,8 +64,31 @@ func TestMessageValidation(t *testing.T) {
 	}
 }
 
+func TestRegisterCommand(t *testing.T) {
+	msg := Message{Command: "DEPLOY", Data: ""}
+	if err := msg.Validate(); err == nil {
+		t.Fatal("Expected unregistered command to be rejected")
+	}
+
+	RegisterCommand(CommandSpec{Name: "DEPLOY", RequiresData: true})
+	t.Cleanup(func() {
+		defaultCommands.mu.Lock()
+		defer defaultCommands.mu.Unlock()
+		delete(defaultCommands.specs, "DEPLOY")
+	})
+
+	if err := msg.Validate(); err == nil {
+		t.Error("Expected DEPLOY without data to be rejected")
+	}
+
+	msg.Data = "api"
+	if err := msg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+}
+
 func TestMessageJSON(t *testing.T) {
-	msg := NewMessage("ECHO", "Hello World")
+	msg := NewMessage("", "ECHO", "Hello World")
 
 	// Test ToJSON
 	jsonData, err := msg.ToJSON()
@@ -151,7 +174,7 @@ func TestResponseString(t *testing.T) {
 }
 
 func BenchmarkMessageToJSON(b *testing.B) {
-	msg := NewMessage("ECHO", "Benchmark test data")
+	msg := NewMessage("", "ECHO", "Benchmark test data")
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -160,7 +183,7 @@ func BenchmarkMessageToJSON(b *testing.B) {
 }
 
 func BenchmarkMessageFromJSON(b *testing.B) {
-	msg := NewMessage("ECHO", "Benchmark test data")
+	msg := NewMessage("", "ECHO", "Benchmark test data")
 	jsonData, _ := msg.ToJSON()
 
 	b.ResetTimer()
@@ -0,0 +1,257 @@
+// Package proxyproto reads HAProxy PROXY protocol v1 and v2 headers, which load
+// balancers put in front of a TCP stream to pass on the real client address
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// v1MaxLength is the longest valid v1 header, including the CRLF
+const v1MaxLength = 107
+
+// v2Signature starts every v2 header
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrNoHeader is returned when the stream does not start with a PROXY header
+var ErrNoHeader = errors.New("proxyproto: missing PROXY header")
+
+// Header is a parsed PROXY header
+// Source and Destination are nil for health checks (v1 UNKNOWN, v2 LOCAL) and
+// address families other than TCP over IPv4/IPv6
+type Header struct {
+	Version     int
+	Source      *net.TCPAddr
+	Destination *net.TCPAddr
+}
+
+// ReadHeader reads a v1 or v2 header from the start of a stream
+func ReadHeader(r *bufio.Reader) (*Header, error) {
+	prefix, err := r.Peek(5)
+	if err != nil {
+		return nil, err
+	}
+	if string(prefix) == "PROXY" {
+		return readV1(r)
+	}
+
+	prefix, err = r.Peek(len(v2Signature))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(prefix, v2Signature) {
+		return readV2(r)
+	}
+	return nil, ErrNoHeader
+}
+
+// readV1 parses "PROXY TCP4 src dst sport dport\r\n"
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) == v1MaxLength {
+			return nil, errors.New("proxyproto: v1 header too long")
+		}
+	}
+
+	text, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, errors.New("proxyproto: v1 header must end with CRLF")
+	}
+	fields := strings.Split(text, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return &Header{Version: 1}, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("proxyproto: invalid v1 header %q", text)
+	}
+
+	src, err := parseV1Addr(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseV1Addr(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+	return &Header{Version: 1, Source: src, Destination: dst}, nil
+}
+
+// parseV1Addr parses one v1 address and port, checking it matches the protocol
+func parseV1Addr(proto, ip, port string) (*net.TCPAddr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Is4() != (proto == "TCP4") {
+		return nil, fmt.Errorf("proxyproto: invalid %s address %q", proto, ip)
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("proxyproto: invalid port %q", port)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(n))), nil
+}
+
+// readV2 parses the binary v2 header
+func readV2(r *bufio.Reader) (*Header, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, err
+	}
+	if fixed[12]>>4 != 2 {
+		return nil, fmt.Errorf("proxyproto: unsupported v2 version %d", fixed[12]>>4)
+	}
+	command, family, transport := fixed[12]&0x0f, fixed[13]>>4, fixed[13]&0x0f
+
+	body := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	header := &Header{Version: 2}
+	switch command {
+	case 0x0: // LOCAL: the balancer's own connection, e.g. a health check
+		return header, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("proxyproto: unsupported v2 command %d", command)
+	}
+
+	// Only TCP over IPv4/IPv6 carries an address we can use; TLVs after it are ignored
+	var size int
+	switch family {
+	case 0x1:
+		size = net.IPv4len
+	case 0x2:
+		size = net.IPv6len
+	default:
+		return header, nil
+	}
+	if transport != 0x1 {
+		return header, nil
+	}
+	if len(body) < 2*size+4 {
+		return nil, errors.New("proxyproto: v2 address block too short")
+	}
+
+	srcIP, _ := netip.AddrFromSlice(body[:size])
+	dstIP, _ := netip.AddrFromSlice(body[size : 2*size])
+	ports := body[2*size:]
+	header.Source = net.TCPAddrFromAddrPort(netip.AddrPortFrom(srcIP, binary.BigEndian.Uint16(ports[0:2])))
+	header.Destination = net.TCPAddrFromAddrPort(netip.AddrPortFrom(dstIP, binary.BigEndian.Uint16(ports[2:4])))
+	return header, nil
+}
+
+// Conn is a connection whose PROXY header has been read
+// RemoteAddr and LocalAddr report the addresses from the header when it has them
+type Conn struct {
+	net.Conn
+	reader *bufio.Reader
+	header *Header
+}
+
+// Accept reads the PROXY header of a freshly accepted connection
+// The header must arrive within timeout
+func Accept(conn net.Conn, timeout time.Duration) (*Conn, error) {
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	reader := bufio.NewReader(conn)
+	header, err := ReadHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: conn, reader: reader, header: header}, nil
+}
+
+// Read reads from the stream after the header
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address from the header, or the peer's address
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to, or the local socket address
+func (c *Conn) LocalAddr() net.Addr {
+	if c.header.Destination != nil {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// ProxyAddr returns the address of the proxy that sent the header
+func (c *Conn) ProxyAddr() net.Addr {
+	return c.Conn.RemoteAddr()
+}
+
+// Header returns the parsed PROXY header
+func (c *Conn) Header() *Header {
+	return c.header
+}
+
+// Trusted reports whether addr is inside one of the prefixes
+func Trusted(addr net.Addr, prefixes []netip.Prefix) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip, ok := netip.AddrFromSlice(tcp.IP)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePrefixes parses a comma-separated list of CIDRs or single addresses
+func ParsePrefixes(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", item)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", item)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,128 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// v2Header builds a v2 header for TCP over IPv4
+func v2Header(command byte, src, dst netip.AddrPort, tlv []byte) []byte {
+	body := append(src.Addr().AsSlice(), dst.Addr().AsSlice()...)
+	body = binary.BigEndian.AppendUint16(body, src.Port())
+	body = binary.BigEndian.AppendUint16(body, dst.Port())
+	body = append(body, tlv...)
+
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x20|command, 0x11)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(body)))
+	return append(header, body...)
+}
+
+func TestReadHeader(t *testing.T) {
+	src := netip.MustParseAddrPort("203.0.113.7:51234")
+	dst := netip.MustParseAddrPort("10.0.0.1:8080")
+
+	tests := []struct {
+		name    string
+		in      []byte
+		source  string // "" = no address
+		wantErr bool
+	}{
+		{name: "v1 tcp4", in: []byte("PROXY TCP4 203.0.113.7 10.0.0.1 51234 8080\r\n"), source: "203.0.113.7:51234"},
+		{name: "v1 tcp6", in: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 4000 8080\r\n"), source: "[2001:db8::1]:4000"},
+		{name: "v1 unknown", in: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v1 family mismatch", in: []byte("PROXY TCP4 2001:db8::1 10.0.0.1 1 2\r\n"), wantErr: true},
+		{name: "v1 bad port", in: []byte("PROXY TCP4 1.2.3.4 10.0.0.1 99999 2\r\n"), wantErr: true},
+		{name: "v1 no crlf", in: []byte("PROXY TCP4 1.2.3.4 10.0.0.1 1 2\n"), wantErr: true},
+		{name: "v1 too long", in: []byte("PROXY " + strings.Repeat("x", 200) + "\r\n"), wantErr: true},
+		{name: "v2 proxy", in: v2Header(0x1, src, dst, nil), source: "203.0.113.7:51234"},
+		{name: "v2 with tlv", in: v2Header(0x1, src, dst, []byte{0x04, 0x00, 0x01, 0x00}), source: "203.0.113.7:51234"},
+		{name: "v2 local", in: v2Header(0x0, src, dst, nil)},
+		{name: "v2 bad command", in: v2Header(0x7, src, dst, nil), wantErr: true},
+		{name: "no header", in: []byte(`{"command":"REGISTER","data":"alice"}` + "\n"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(bytes.NewReader(append(tt.in, "rest"...)))
+			header, err := ReadHeader(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			got := ""
+			if header.Source != nil {
+				got = header.Source.String()
+			}
+			if got != tt.source {
+				t.Errorf("Source = %q, want %q", got, tt.source)
+			}
+
+			// The stream continues right after the header
+			if rest, _ := io.ReadAll(r); string(rest) != "rest" {
+				t.Errorf("Remaining stream = %q, want %q", rest, "rest")
+			}
+		})
+	}
+}
+
+func TestAcceptConn(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go client.Write([]byte("PROXY TCP4 198.51.100.9 10.0.0.1 40000 8080\r\nhello\n"))
+
+	conn, err := Accept(server, 0)
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	defer conn.Close()
+
+	if got := conn.RemoteAddr().String(); got != "198.51.100.9:40000" {
+		t.Errorf("RemoteAddr() = %s, want 198.51.100.9:40000", got)
+	}
+	if got := conn.LocalAddr().String(); got != "10.0.0.1:8080" {
+		t.Errorf("LocalAddr() = %s, want 10.0.0.1:8080", got)
+	}
+	if line, _ := bufio.NewReader(conn).ReadString('\n'); line != "hello\n" {
+		t.Errorf("Read() = %q, want the data after the header", line)
+	}
+}
+
+func TestTrusted(t *testing.T) {
+	prefixes, err := ParsePrefixes("10.0.0.0/8, 192.168.1.5,2001:db8::/32")
+	if err != nil {
+		t.Fatalf("ParsePrefixes() error = %v", err)
+	}
+
+	tests := map[string]bool{
+		"10.1.2.3:80":          true,
+		"192.168.1.5:80":       true,
+		"192.168.1.6:80":       false,
+		"[2001:db8::7]:80":     true,
+		"[::ffff:10.0.0.1]:80": true,
+		"203.0.113.1:80":       false,
+	}
+	for addr, want := range tests {
+		tcp, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			t.Fatalf("ResolveTCPAddr(%s) error = %v", addr, err)
+		}
+		if got := Trusted(tcp, prefixes); got != want {
+			t.Errorf("Trusted(%s) = %v, want %v", addr, got, want)
+		}
+	}
+
+	if _, err := ParsePrefixes("10.0.0.0/33"); err == nil {
+		t.Error("Expected an error for an invalid CIDR")
+	}
+}
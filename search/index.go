@@ -0,0 +1,207 @@
+// Package search is an in-memory full-text index over chat messages
+// Messages are tokenized into lowercase words with their positions, so queries can
+// combine terms, quoted phrases and sender/room/time filters, and results come with
+// highlighted snippets
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Document is one indexed message
+type Document struct {
+	ID   uint64
+	From string
+	Room string
+	Time time.Time
+	Text string
+}
+
+// token is a word of a text and where it sits in it
+type token struct {
+	word       string
+	start, end int // Byte offsets in the original text
+}
+
+// tokenize splits text into lowercase words of letters and digits
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			tokens = append(tokens, token{word: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{word: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+// words returns just the words of a text
+func words(text string) []string {
+	tokens := tokenize(text)
+	result := make([]string, len(tokens))
+	for i, t := range tokens {
+		result[i] = t.word
+	}
+	return result
+}
+
+// Index maps words to the documents and positions they appear at
+// It is safe for concurrent use
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[uint64]Document
+	postings map[string]map[uint64][]int // word → document ID → positions
+}
+
+// NewIndex creates an empty index
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[uint64]Document),
+		postings: make(map[string]map[uint64][]int),
+	}
+}
+
+// Add indexes a document, replacing any earlier version with the same ID
+func (ix *Index) Add(doc Document) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.removeLocked(doc.ID)
+	ix.docs[doc.ID] = doc
+	for pos, word := range words(doc.Text) {
+		if ix.postings[word] == nil {
+			ix.postings[word] = make(map[uint64][]int)
+		}
+		ix.postings[word][doc.ID] = append(ix.postings[word][doc.ID], pos)
+	}
+}
+
+// Remove drops a document from the index
+func (ix *Index) Remove(id uint64) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.removeLocked(id)
+}
+
+// removeLocked drops a document and its postings; the caller must hold ix.mu
+func (ix *Index) removeLocked(id uint64) {
+	doc, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	delete(ix.docs, id)
+	for _, word := range words(doc.Text) {
+		if docs := ix.postings[word]; docs != nil {
+			delete(docs, id)
+			if len(docs) == 0 {
+				delete(ix.postings, word)
+			}
+		}
+	}
+}
+
+// Reset empties the index
+func (ix *Index) Reset() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	clear(ix.docs)
+	clear(ix.postings)
+}
+
+// Len returns how many documents are indexed
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+// Search returns the documents matching the query and accepted by filter (nil = all),
+// newest first
+func (ix *Index) Search(q Query, filter func(Document) bool) []Document {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	// Every term and every word of every phrase must appear, so start from the rarest
+	var required []string
+	required = append(required, q.Terms...)
+	for _, phrase := range q.Phrases {
+		required = append(required, phrase...)
+	}
+
+	var candidates map[uint64][]int
+	if len(required) > 0 {
+		sort.Slice(required, func(i, j int) bool { return len(ix.postings[required[i]]) < len(ix.postings[required[j]]) })
+		candidates = ix.postings[required[0]]
+	}
+
+	var results []Document
+	check := func(id uint64) {
+		doc := ix.docs[id]
+		if ix.matchLocked(id, required, q.Phrases) && q.matchFilters(doc) && (filter == nil || filter(doc)) {
+			results = append(results, doc)
+		}
+	}
+	if len(required) > 0 {
+		for id := range candidates {
+			check(id)
+		}
+	} else {
+		for id := range ix.docs {
+			check(id)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].ID > results[j].ID })
+	return results
+}
+
+// matchLocked reports whether a document has every required word and every phrase
+// The caller must hold ix.mu
+func (ix *Index) matchLocked(id uint64, required []string, phrases [][]string) bool {
+	for _, word := range required {
+		if len(ix.postings[word][id]) == 0 {
+			return false
+		}
+	}
+	for _, phrase := range phrases {
+		if !ix.hasPhraseLocked(id, phrase) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasPhraseLocked reports whether the phrase's words appear next to each other in order
+func (ix *Index) hasPhraseLocked(id uint64, phrase []string) bool {
+	for _, start := range ix.postings[phrase[0]][id] {
+		found := true
+		for i, word := range phrase[1:] {
+			if !containsInt(ix.postings[word][id], start+i+1) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// containsInt reports whether a sorted slice holds n
+func containsInt(sorted []int, n int) bool {
+	i := sort.SearchInts(sorted, n)
+	return i < len(sorted) && sorted[i] == n
+}
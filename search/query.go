@@ -0,0 +1,142 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query is a parsed search
+// Text like `deploy "rolled back" from:alice in:ops after:2024-05-01 before:24h`
+// needs the word deploy, the phrase "rolled back", alice as sender, the ops room and a
+// time between May 1st and a day ago
+type Query struct {
+	Terms   []string   // Words that must all appear
+	Phrases [][]string // Word sequences that must appear in order
+	From    string     // Sender (case-insensitive, "" = anyone)
+	Room    string     // Room as written after in: or room: ("" = not restricted); the caller interprets it
+	After   time.Time  // Only messages at or after this time (zero = no bound)
+	Before  time.Time  // Only messages before this time (zero = no bound)
+}
+
+// ParseQuery parses search text; times are dates (2006-01-02), RFC 3339 timestamps or
+// ages like 90m, 24h or 7d counted back from now
+func ParseQuery(text string, now time.Time) (Query, error) {
+	var q Query
+	fields, err := splitQuery(text)
+	if err != nil {
+		return Query{}, err
+	}
+
+	for _, f := range fields {
+		if f.quoted {
+			if phrase := words(f.text); len(phrase) == 1 {
+				q.Terms = append(q.Terms, phrase[0])
+			} else if len(phrase) > 1 {
+				q.Phrases = append(q.Phrases, phrase)
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(f.text, ":")
+		if ok && value != "" {
+			switch strings.ToLower(key) {
+			case "from":
+				q.From = strings.ToLower(value)
+				continue
+			case "in", "room":
+				q.Room = value
+				continue
+			case "after", "since":
+				if q.After, err = parseTime(value, now); err != nil {
+					return Query{}, err
+				}
+				continue
+			case "before", "until":
+				if q.Before, err = parseTime(value, now); err != nil {
+					return Query{}, err
+				}
+				continue
+			}
+		}
+		q.Terms = append(q.Terms, words(f.text)...)
+	}
+
+	if q.Empty() {
+		return Query{}, fmt.Errorf("empty query")
+	}
+	return q, nil
+}
+
+// Empty reports whether the query has neither words nor filters
+func (q Query) Empty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0 && q.From == "" && q.Room == "" && q.After.IsZero() && q.Before.IsZero()
+}
+
+// matchFilters applies the sender and time filters
+func (q Query) matchFilters(doc Document) bool {
+	if q.From != "" && strings.ToLower(doc.From) != q.From {
+		return false
+	}
+	if !q.After.IsZero() && doc.Time.Before(q.After) {
+		return false
+	}
+	if !q.Before.IsZero() && !doc.Time.Before(q.Before) {
+		return false
+	}
+	return true
+}
+
+// field is a whitespace-separated part of a query, or a quoted phrase
+type field struct {
+	text   string
+	quoted bool
+}
+
+// splitQuery splits on whitespace, keeping "quoted phrases" together
+func splitQuery(text string) ([]field, error) {
+	var fields []field
+	for {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return fields, nil
+		}
+
+		if rest, ok := strings.CutPrefix(text, `"`); ok {
+			phrase, after, closed := strings.Cut(rest, `"`)
+			if !closed {
+				return nil, fmt.Errorf("unterminated phrase %q", text)
+			}
+			fields = append(fields, field{text: phrase, quoted: true})
+			text = after
+			continue
+		}
+
+		end := strings.IndexAny(text, " \t")
+		if end < 0 {
+			end = len(text)
+		}
+		fields = append(fields, field{text: text[:end]})
+		text = text[end:]
+	}
+}
+
+// parseTime reads a date, an RFC 3339 timestamp or an age before now
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, now.Location()); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use 2006-01-02, RFC 3339 or an age like 24h or 7d)", value)
+}
@@ -0,0 +1,109 @@
+package search
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	q, err := ParseQuery(`Deploy "rolled  BACK" from:Alice in:#ops after:2026-05-01 before:24h db-1`, now)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if len(q.Terms) != 3 || q.Terms[0] != "deploy" || q.Terms[1] != "db" || q.Terms[2] != "1" {
+		t.Errorf("Terms = %q", q.Terms)
+	}
+	if len(q.Phrases) != 1 || len(q.Phrases[0]) != 2 || q.Phrases[0][1] != "back" {
+		t.Errorf("Phrases = %q", q.Phrases)
+	}
+	if q.From != "alice" || q.Room != "#ops" {
+		t.Errorf("From = %q, Room = %q", q.From, q.Room)
+	}
+	if !q.After.Equal(time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)) || !q.Before.Equal(now.Add(-24*time.Hour)) {
+		t.Errorf("After = %v, Before = %v", q.After, q.Before)
+	}
+
+	for _, bad := range []string{"", `"unterminated`, "after:yesterday"} {
+		if _, err := ParseQuery(bad, now); err == nil {
+			t.Errorf("ParseQuery(%q) expected an error", bad)
+		}
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	base := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+	ix := NewIndex()
+	ix.Add(Document{ID: 1, From: "alice", Room: "ops", Time: base, Text: "Deploy rolled back, db is down"})
+	ix.Add(Document{ID: 2, From: "bob", Room: "ops", Time: base.Add(time.Hour), Text: "back to normal, deploy done"})
+	ix.Add(Document{ID: 3, From: "alice", Time: base.Add(2 * time.Hour), Text: "lunch anyone?"})
+
+	search := func(text string) []uint64 {
+		t.Helper()
+		q, err := ParseQuery(text, base.Add(3*time.Hour))
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", text, err)
+		}
+		var ids []uint64
+		for _, doc := range ix.Search(q, nil) {
+			ids = append(ids, doc.ID)
+		}
+		return ids
+	}
+
+	tests := map[string][]uint64{
+		"deploy":                     {2, 1}, // Newest first
+		"DEPLOY back":                {2, 1},
+		`"rolled back"`:              {1},
+		`"back rolled"`:              nil,
+		"deploy from:bob":            {2},
+		"from:alice":                 {3, 1},
+		"deploy before:2h":           {1},
+		"after:2026-05-10T13:00:00Z": {3, 2},
+		"missing":                    nil,
+	}
+	for text, want := range tests {
+		if got := search(text); !equalIDs(got, want) {
+			t.Errorf("Search(%q) = %v, want %v", text, got, want)
+		}
+	}
+
+	// Updates replace the old text and removals drop the document
+	ix.Add(Document{ID: 1, From: "alice", Room: "ops", Time: base, Text: "all fine"})
+	ix.Remove(2)
+	if got := search("deploy"); len(got) != 0 {
+		t.Errorf("Search after update = %v", got)
+	}
+	if ix.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", ix.Len())
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	q, _ := ParseQuery(`db "rolled back"`, time.Now())
+
+	got := q.Snippet("We rolled back the release because the db was down")
+	want := "We **rolled** **back** the release because the **db** was down"
+	if got != want {
+		t.Errorf("Snippet() = %q, want %q", got, want)
+	}
+
+	long := "one two three four five six seven eight nine ten eleven twelve db thirteen fourteen fifteen sixteen seventeen eighteen nineteen twenty twentyone twentytwo twentythree"
+	want = "…eight nine ten eleven twelve **db** thirteen fourteen fifteen sixteen seventeen eighteen nineteen twenty twentyone twentytwo…"
+	if got := q.Snippet(long); got != want {
+		t.Errorf("Snippet() = %q, want %q", got, want)
+	}
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
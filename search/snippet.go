@@ -0,0 +1,95 @@
+package search
+
+import "strings"
+
+// Highlight markers put around matched words in snippets
+const (
+	HighlightStart = "**"
+	HighlightEnd   = "**"
+)
+
+// snippetContext is how many words around the first match a snippet shows
+const (
+	snippetBefore = 5
+	snippetAfter  = 10
+)
+
+// Snippet returns the part of text around the query's first match with matched words highlighted
+// Text longer than the window is cut with "…"
+func (q Query) Snippet(text string) string {
+	tokens := tokenize(text)
+	matched := q.matchedTokens(tokens)
+
+	first := 0
+	for i, m := range matched {
+		if m {
+			first = i
+			break
+		}
+	}
+	if len(tokens) == 0 {
+		return text
+	}
+
+	from := max(first-snippetBefore, 0)
+	to := min(first+snippetAfter, len(tokens)-1)
+	start, end := tokens[from].start, tokens[to].end
+	if from == 0 {
+		start = 0
+	}
+	if to == len(tokens)-1 {
+		end = len(text)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for i := from; i <= to; i++ {
+		if !matched[i] {
+			continue
+		}
+		b.WriteString(text[pos:tokens[i].start])
+		b.WriteString(HighlightStart + text[tokens[i].start:tokens[i].end] + HighlightEnd)
+		pos = tokens[i].end
+	}
+	b.WriteString(text[pos:end])
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// matchedTokens marks the tokens that are query terms or part of a phrase occurrence
+func (q Query) matchedTokens(tokens []token) []bool {
+	matched := make([]bool, len(tokens))
+	terms := make(map[string]bool, len(q.Terms))
+	for _, term := range q.Terms {
+		terms[term] = true
+	}
+
+	for i, t := range tokens {
+		if terms[t.word] {
+			matched[i] = true
+		}
+		for _, phrase := range q.Phrases {
+			if i+len(phrase) > len(tokens) {
+				continue
+			}
+			occurs := true
+			for j, word := range phrase {
+				if tokens[i+j].word != word {
+					occurs = false
+					break
+				}
+			}
+			if occurs {
+				for j := range phrase {
+					matched[i+j] = true
+				}
+			}
+		}
+	}
+	return matched
+}
@@ -0,0 +1,419 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"tcp_server/protocol"
+	"time"
+)
+
+// Role is a permission attached to an authenticated client
+type Role string
+
+// Built-in roles
+const (
+	RoleAdmin Role = "admin" // May use the admin command set
+)
+
+// moderation holds operator credentials and the ban and mute lists
+type moderation struct {
+	mu          sync.RWMutex
+	operators   map[string]string    // Operator name → password (checked by OPER)
+	botTokens   map[string]string    // HTTP API bearer token → bot name
+	bannedUsers map[string]string    // Username → ban reason
+	bannedNets  map[string]bannedNet // Ban target as typed → banned address range
+	muted       map[string]time.Time // Username → mute expiry (zero = until unmuted)
+}
+
+// bannedNet is an IP or CIDR ban
+type bannedNet struct {
+	prefix netip.Prefix
+	reason string
+}
+
+// newModeration creates empty moderation state
+func newModeration() *moderation {
+	return &moderation{
+		operators:   make(map[string]string),
+		botTokens:   make(map[string]string),
+		bannedUsers: make(map[string]string),
+		bannedNets:  make(map[string]bannedNet),
+		muted:       make(map[string]time.Time),
+	}
+}
+
+// HasRole returns true if the client has been granted the role
+func (c *Client) HasRole(role Role) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.roles[role]
+}
+
+// GrantRole attaches a role to the client for the rest of its connection
+func (c *Client) GrantRole(role Role) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.roles == nil {
+		c.roles = make(map[Role]bool)
+	}
+	c.roles[role] = true
+}
+
+// Roles returns the client's roles in sorted order
+func (c *Client) Roles() []Role {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	roles := make([]Role, 0, len(c.roles))
+	for role := range c.roles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i] < roles[j] })
+	return roles
+}
+
+// ConnectedAt returns when the client connected
+func (c *Client) ConnectedAt() time.Time {
+	return c.connectedAt
+}
+
+// SetOperators replaces the operator credentials accepted by OPER
+// Clients that already authenticated keep their roles
+func (s *Server) SetOperators(operators map[string]string) {
+	s.moderation.mu.Lock()
+	defer s.moderation.mu.Unlock()
+
+	s.moderation.operators = make(map[string]string, len(operators))
+	for name, password := range operators {
+		s.moderation.operators[name] = password
+	}
+}
+
+// registerAdminCommands registers OPER and the admin-only command set
+func (s *Server) registerAdminCommands() {
+	commands := []CommandHandler{
+		{Name: protocol.CmdOper, RequiresData: true, Handler: s.handleOper},
+		{Name: protocol.CmdKick, RequiresData: true, RequiresRole: RoleAdmin, Handler: s.handleKick},
+		{Name: protocol.CmdBan, RequiresData: true, RequiresRole: RoleAdmin, Handler: s.handleBan},
+		{Name: protocol.CmdUnban, RequiresData: true, RequiresRole: RoleAdmin, Handler: s.handleUnban},
+		{Name: protocol.CmdMute, RequiresData: true, RequiresRole: RoleAdmin, Handler: s.handleMute},
+		{Name: protocol.CmdUnmute, RequiresData: true, RequiresRole: RoleAdmin, Handler: s.handleUnmute},
+		{Name: protocol.CmdNotice, RequiresData: true, RequiresRole: RoleAdmin, Handler: s.handleNotice},
+		{Name: protocol.CmdClearHistory, RequiresRole: RoleAdmin, Handler: s.handleClearHistory},
+		{Name: protocol.CmdListConnections, RequiresRole: RoleAdmin, Handler: s.handleListConnections},
+	}
+
+	for _, h := range commands {
+		if err := s.commands.Register(h); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// splitArgs splits command data into its first word and the rest
+func splitArgs(data string) (first, rest string) {
+	first, rest, _ = strings.Cut(strings.TrimSpace(data), " ")
+	return first, strings.TrimSpace(rest)
+}
+
+// handleOper grants the admin role to a client that knows an operator password
+func (s *Server) handleOper(client *Client, msg *protocol.Message) *protocol.Response {
+	name, password := splitArgs(msg.Data)
+
+	s.moderation.mu.RLock()
+	expected, ok := s.moderation.operators[name]
+	s.moderation.mu.RUnlock()
+
+	// Compare in constant time so the password can't be guessed byte by byte
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 {
+		s.clientLogger(client).Warn("operator authentication failed", "operator", name)
+		return protocol.NewErrorResponse(protocol.CodeForbidden, "Invalid operator credentials")
+	}
+
+	client.GrantRole(RoleAdmin)
+	s.clientLogger(client).Info("operator authenticated", "operator", name)
+	return protocol.NewResponse(true, "You are now an operator", "")
+}
+
+// handleKick disconnects every connection of a user
+func (s *Server) handleKick(client *Client, msg *protocol.Message) *protocol.Response {
+	username, reason := splitArgs(msg.Data)
+	if reason == "" {
+		reason = "Kicked by an operator"
+	}
+
+	kicked := s.kickUser(username, reason)
+	if kicked == 0 {
+		return protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("User %s is not connected", username))
+	}
+
+	s.clientLogger(client).Info("user kicked", "target", username, "connections", kicked)
+	return protocol.NewResponse(true, fmt.Sprintf("Kicked %s (%d connection(s))", username, kicked), "")
+}
+
+// handleBan bans a username, IP address or CIDR range and disconnects matching clients
+func (s *Server) handleBan(client *Client, msg *protocol.Message) *protocol.Response {
+	target, reason := splitArgs(msg.Data)
+	if reason == "" {
+		reason = "Banned by an operator"
+	}
+
+	var kicked int
+	if prefix, ok := parseBanPrefix(target); ok {
+		s.moderation.mu.Lock()
+		s.moderation.bannedNets[target] = bannedNet{prefix: prefix, reason: reason}
+		s.moderation.mu.Unlock()
+
+		for _, c := range s.snapshotClients() {
+			if addr, ok := addrOf(c.RemoteAddr()); ok && prefix.Contains(addr) {
+				s.kick(c, reason)
+				kicked++
+			}
+		}
+		for _, c := range s.parkedSessions(func(c *Client) bool {
+			addr, ok := addrOf(c.RemoteAddr())
+			return ok && prefix.Contains(addr)
+		}) {
+			s.expireSession(c)
+			kicked++
+		}
+	} else {
+		s.moderation.mu.Lock()
+		s.moderation.bannedUsers[target] = reason
+		s.moderation.mu.Unlock()
+
+		kicked = s.kickUser(target, reason)
+	}
+
+	s.clientLogger(client).Info("ban added", "target", target, "connections", kicked)
+	return protocol.NewResponse(true, fmt.Sprintf("Banned %s (%d connection(s) dropped)", target, kicked), "")
+}
+
+// handleUnban lifts a username or address ban
+func (s *Server) handleUnban(client *Client, msg *protocol.Message) *protocol.Response {
+	target, _ := splitArgs(msg.Data)
+
+	s.moderation.mu.Lock()
+	_, userBan := s.moderation.bannedUsers[target]
+	_, netBan := s.moderation.bannedNets[target]
+	delete(s.moderation.bannedUsers, target)
+	delete(s.moderation.bannedNets, target)
+	s.moderation.mu.Unlock()
+
+	if !userBan && !netBan {
+		return protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("%s is not banned", target))
+	}
+
+	s.clientLogger(client).Info("ban lifted", "target", target)
+	return protocol.NewResponse(true, fmt.Sprintf("Unbanned %s", target), "")
+}
+
+// handleMute stops a user from sending messages, optionally for a duration
+func (s *Server) handleMute(client *Client, msg *protocol.Message) *protocol.Response {
+	username, durationText := splitArgs(msg.Data)
+
+	var until time.Time
+	if durationText != "" {
+		duration, err := time.ParseDuration(durationText)
+		if err != nil || duration <= 0 {
+			return protocol.NewErrorResponse(protocol.CodeValidation, fmt.Sprintf("Invalid mute duration: %s", durationText))
+		}
+		until = time.Now().Add(duration)
+	}
+
+	s.moderation.mu.Lock()
+	s.moderation.muted[username] = until
+	s.moderation.mu.Unlock()
+
+	s.clientLogger(client).Info("user muted", "target", username, "duration", durationText)
+	if until.IsZero() {
+		return protocol.NewResponse(true, fmt.Sprintf("Muted %s", username), "")
+	}
+	return protocol.NewResponse(true, fmt.Sprintf("Muted %s until %s", username, until.Format(time.RFC3339)), "")
+}
+
+// handleUnmute lifts a mute
+func (s *Server) handleUnmute(client *Client, msg *protocol.Message) *protocol.Response {
+	username, _ := splitArgs(msg.Data)
+
+	s.moderation.mu.Lock()
+	_, muted := s.moderation.muted[username]
+	delete(s.moderation.muted, username)
+	s.moderation.mu.Unlock()
+
+	if !muted {
+		return protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("%s is not muted", username))
+	}
+	return protocol.NewResponse(true, fmt.Sprintf("Unmuted %s", username), "")
+}
+
+// handleNotice broadcasts a system notice to every client, including the sender
+func (s *Server) handleNotice(client *Client, msg *protocol.Message) *protocol.Response {
+	event := protocol.NewEvent(protocol.EventNotice, client.Username(),
+		fmt.Sprintf("[Notice] %s", msg.Data), msg.Data)
+	recipients := s.broadcast(event, nil)
+	return protocol.NewResponse(true, fmt.Sprintf("Notice sent to %d client(s)", recipients), "")
+}
+
+// handleClearHistory deletes the stored message history
+func (s *Server) handleClearHistory(client *Client, msg *protocol.Message) *protocol.Response {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return shuttingDown()
+	}
+	cleared := len(s.messages)
+	s.messages = s.messages[:0]
+	clear(s.followers)
+	s.index.Reset()
+	if s.saves != nil {
+		s.saves.clear()
+	}
+	s.mu.Unlock()
+
+	s.clientLogger(client).Info("history cleared", "messages", cleared)
+	return protocol.NewResponse(true, fmt.Sprintf("Cleared %d message(s)", cleared), "")
+}
+
+// handleListConnections lists every connection with its address, connect time and roles
+func (s *Server) handleListConnections(client *Client, msg *protocol.Message) *protocol.Response {
+	return protocol.NewResponse(true, "Connections", s.describeConnections())
+}
+
+// describeConnections formats one line per connection, oldest first
+func (s *Server) describeConnections() string {
+	clients := s.snapshotClients()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].connectedAt.Before(clients[j].connectedAt) })
+
+	var result strings.Builder
+	for i, c := range clients {
+		if i > 0 {
+			result.WriteString("\n")
+		}
+		result.WriteString(fmt.Sprintf("%s %s connected %s (%s)",
+			c.Username(), c.RemoteAddr(), c.connectedAt.Format(time.RFC3339),
+			time.Since(c.connectedAt).Round(time.Second)))
+		result.WriteString(fmt.Sprintf(" via %s", c.Listener()))
+		if proxy := c.ProxyAddr(); proxy != nil {
+			result.WriteString(fmt.Sprintf(" proxy=%s", proxy))
+		}
+		if roles := c.Roles(); len(roles) > 0 {
+			result.WriteString(fmt.Sprintf(" roles=%v", roles))
+		}
+		if rtt := c.RTT(); rtt > 0 {
+			result.WriteString(fmt.Sprintf(" rtt=%s", rtt))
+		}
+	}
+	return result.String()
+}
+
+// snapshotClients returns the connected clients without holding the lock afterwards
+func (s *Server) snapshotClients() []*Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// kickUser disconnects every connection registered under username and forgets its
+// sessions waiting to be resumed, so none of them can come back with RESUME
+func (s *Server) kickUser(username, reason string) int {
+	kicked := 0
+	for _, c := range s.snapshotClients() {
+		if c.IsRegistered() && c.Username() == username {
+			s.kick(c, reason)
+			kicked++
+		}
+	}
+	for _, c := range s.parkedSessions(func(c *Client) bool { return c.Username() == username }) {
+		s.expireSession(c)
+		kicked++
+	}
+	return kicked
+}
+
+// kick tells a client why it is being disconnected, flushes its queue and closes it
+// The queue drains in the background so a slow client can't hold up the admin
+func (s *Server) kick(client *Client, reason string) {
+	client.endSession()
+	s.expireSession(client) // A kicked session that was waiting to be resumed is gone for good
+	if frame, err := client.codec.EncodeResponse(protocol.NewEvent(protocol.EventKicked, "", reason, "")); err == nil {
+		s.sendEvent(client, frame)
+	}
+	go func() {
+		client.closeOutbox()
+		client.conn.Close()
+	}()
+}
+
+// isMuted returns true if the user is currently muted
+func (s *Server) isMuted(username string) bool {
+	s.moderation.mu.Lock()
+	defer s.moderation.mu.Unlock()
+
+	until, ok := s.moderation.muted[username]
+	if !ok {
+		return false
+	}
+	if !until.IsZero() && time.Now().After(until) {
+		delete(s.moderation.muted, username) // Mute expired
+		return false
+	}
+	return true
+}
+
+// userBanReason returns the ban reason if the username is banned
+func (s *Server) userBanReason(username string) (string, bool) {
+	s.moderation.mu.RLock()
+	defer s.moderation.mu.RUnlock()
+	reason, banned := s.moderation.bannedUsers[username]
+	return reason, banned
+}
+
+// addrBanReason returns the ban reason if the address falls in a banned range
+func (s *Server) addrBanReason(remote net.Addr) (string, bool) {
+	addr, ok := addrOf(remote)
+	if !ok {
+		return "", false
+	}
+
+	s.moderation.mu.RLock()
+	defer s.moderation.mu.RUnlock()
+
+	for _, ban := range s.moderation.bannedNets {
+		if ban.prefix.Contains(addr) {
+			return ban.reason, true
+		}
+	}
+	return "", false
+}
+
+// parseBanPrefix parses a ban target as an IP address or CIDR range
+func parseBanPrefix(target string) (netip.Prefix, bool) {
+	if prefix, err := netip.ParsePrefix(target); err == nil {
+		return prefix.Masked(), true
+	}
+	if addr, err := netip.ParseAddr(target); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
+
+// addrOf extracts the IP address from a TCP address
+func addrOf(remote net.Addr) (netip.Addr, bool) {
+	tcp, ok := remote.(*net.TCPAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	addr, ok := netip.AddrFromSlice(tcp.IP)
+	return addr.Unmap(), ok
+}
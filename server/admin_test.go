@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+	"time"
+)
+
+func TestAdminCommandsRequireRole(t *testing.T) {
+	s := startTestServer(t, WithOperators(map[string]string{"root": "secret"}))
+	alice := dialTestServer(t, s)
+
+	if resp := alice.call(protocol.CmdListConnections, ""); resp.Code != protocol.CodeForbidden {
+		t.Fatalf("Expected FORBIDDEN before OPER, got %+v", resp)
+	}
+	if resp := alice.call(protocol.CmdOper, "root wrong"); resp.Code != protocol.CodeForbidden {
+		t.Fatalf("Expected FORBIDDEN for a bad password, got %+v", resp)
+	}
+	if resp := alice.call(protocol.CmdOper, "root secret"); !resp.Success {
+		t.Fatalf("OPER failed: %+v", resp)
+	}
+
+	resp := alice.call(protocol.CmdListConnections, "")
+	if !resp.Success || !strings.Contains(resp.Data, "roles=[admin]") {
+		t.Errorf("Unexpected LIST_CONNECTIONS response: %+v", resp)
+	}
+}
+
+func TestKickAndBan(t *testing.T) {
+	s := startTestServer(t, WithOperators(map[string]string{"root": "secret"}))
+	admin := dialTestServer(t, s)
+	admin.call(protocol.CmdOper, "root secret")
+
+	mallory := dialTestServer(t, s)
+	mallory.call(protocol.CmdRegister, "mallory")
+
+	if resp := admin.call(protocol.CmdBan, "mallory spamming"); !resp.Success {
+		t.Fatalf("BAN failed: %+v", resp)
+	}
+
+	if event := mallory.readEvent(protocol.EventKicked); event.Message != "spamming" {
+		t.Errorf("Expected kicked event, got %+v", event)
+	}
+	mallory.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := mallory.reader.ReadString('\n'); err != io.EOF {
+		t.Errorf("Expected connection to be closed, got %v", err)
+	}
+
+	// The banned name can't be registered again
+	again := dialTestServer(t, s)
+	if resp := again.call(protocol.CmdRegister, "mallory"); resp.Code != protocol.CodeForbidden {
+		t.Errorf("Expected banned username to be refused, got %+v", resp)
+	}
+}
+
+func TestMute(t *testing.T) {
+	s := startTestServer(t, WithOperators(map[string]string{"root": "secret"}))
+	admin := dialTestServer(t, s)
+	admin.call(protocol.CmdOper, "root secret")
+
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+	admin.call(protocol.CmdMute, "bob")
+
+	if resp := bob.call(protocol.CmdMessage, "hello"); resp.Code != protocol.CodeForbidden {
+		t.Errorf("Expected muted MESSAGE to be refused, got %+v", resp)
+	}
+
+	admin.call(protocol.CmdUnmute, "bob")
+	if resp := bob.call(protocol.CmdMessage, "hello"); !resp.Success {
+		t.Errorf("Expected MESSAGE after unmute to succeed, got %+v", resp)
+	}
+}
+
+func TestParseBanPrefix(t *testing.T) {
+	tests := []struct {
+		target string
+		addr   string
+		want   bool
+	}{
+		{target: "10.0.0.5", addr: "10.0.0.5", want: true},
+		{target: "10.0.0.0/8", addr: "10.1.2.3", want: true},
+		{target: "10.0.0.0/8", addr: "192.168.1.1", want: false},
+		{target: "alice", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			prefix, ok := parseBanPrefix(tt.target)
+			if tt.addr == "" {
+				if ok {
+					t.Errorf("parseBanPrefix(%q) parsed a username as an address", tt.target)
+				}
+				return
+			}
+
+			addr, _ := addrOf(&net.TCPAddr{IP: net.ParseIP(tt.addr)})
+			if got := ok && prefix.Contains(addr); got != tt.want {
+				t.Errorf("ban %s contains %s = %v, want %v", tt.target, tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperPasswordNotLogged(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewServer(":0", WithLogger(slog.New(slog.NewTextHandler(&buf, nil))), WithOperators(map[string]string{"root": "hunter2"}))
+
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+	client := &Client{conn: conn, username: "alice"}
+
+	s.dispatch(client, &protocol.Message{Command: protocol.CmdOper, Data: "root hunter2"})
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("OPER password was logged:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "data_len=12") {
+		t.Errorf("Expected the data length to be logged instead:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"tcp_server/protocol"
+	"time"
+)
+
+// maxAPIBody bounds the size of an HTTP API request body
+const maxAPIBody = 64 * 1024
+
+// apiListener is the listener HTTP API clients appear to come through
+var apiListener = &listener{name: "http", codec: protocol.JSONCodec}
+
+// apiCommands are the commands API clients may run, including through slash commands
+// API clients have no User and no send queue, so anything that needs a session is refused
+var apiCommands = map[string]bool{
+	protocol.CmdMessage:      true,
+	protocol.CmdListMessages: true,
+	protocol.CmdListUsers:    true,
+	protocol.CmdTime:         true,
+}
+
+// closedDone is the done channel of API clients: anything queued for them is dropped at once
+var closedDone = func() chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}()
+
+// apiConn stands in for the connection of a client served over HTTP
+// Only its addresses are used: API clients never receive frames
+type apiConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c apiConn) RemoteAddr() net.Addr { return c.remote }
+
+// apiAddr is a remote address that is not host:port
+type apiAddr string
+
+func (a apiAddr) Network() string { return "http" }
+func (a apiAddr) String() string  { return string(a) }
+
+// postMessageRequest is the body of POST /api/messages
+type postMessageRequest struct {
+	Room    string `json:"room,omitempty"`
+	Message string `json:"message"`
+}
+
+// SetBotTokens replaces the bearer tokens (token → bot name) accepted by the HTTP API
+func (s *Server) SetBotTokens(tokens map[string]string) {
+	s.moderation.mu.Lock()
+	defer s.moderation.mu.Unlock()
+
+	s.moderation.botTokens = make(map[string]string, len(tokens))
+	for token, name := range tokens {
+		s.moderation.botTokens[token] = name
+	}
+}
+
+// botForToken returns the bot authenticated by a bearer token
+func (s *Server) botForToken(token string) (string, bool) {
+	s.moderation.mu.RLock()
+	defer s.moderation.mu.RUnlock()
+
+	// Compare every token in constant time so none can be guessed byte by byte
+	var bot string
+	for candidate, name := range s.moderation.botTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			bot = name
+		}
+	}
+	return bot, token != "" && bot != ""
+}
+
+// APIHandler returns the HTTP/JSON API:
+//
+//	POST /api/messages          {"room": "ops", "message": "deploy done"}
+//	GET  /api/messages?room=ops recent history of a room (default: lobby)
+//	GET  /api/users[?status=1]  online users
+//	GET  /api/time              server time
+//	GET  /api/events            live Server-Sent Events (see handleEventStream)
+//
+// Requests authenticate with "Authorization: Bearer <token>" and run the same
+// command handlers and middleware as TCP clients; replies are protocol responses
+func (s *Server) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/messages", s.apiCommand(func(r *http.Request) (string, *protocol.Message, error) {
+		var req postMessageRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxAPIBody)).Decode(&req); err != nil {
+			return "", nil, err
+		}
+		return req.Room, protocol.NewMessage("", protocol.CmdMessage, req.Message), nil
+	}))
+	mux.HandleFunc("GET /api/messages", s.apiCommand(func(r *http.Request) (string, *protocol.Message, error) {
+		return r.URL.Query().Get("room"), protocol.NewMessage("", protocol.CmdListMessages, ""), nil
+	}))
+	mux.HandleFunc("GET /api/users", s.apiCommand(func(r *http.Request) (string, *protocol.Message, error) {
+		data := ""
+		if r.URL.Query().Has("status") {
+			data = protocol.ListUsersWithStatus
+		}
+		return "", protocol.NewMessage("", protocol.CmdListUsers, data), nil
+	}))
+	mux.HandleFunc("GET /api/events", s.handleEventStream)
+	mux.HandleFunc("GET /api/time", s.apiCommand(func(r *http.Request) (string, *protocol.Message, error) {
+		return "", protocol.NewMessage("", protocol.CmdTime, ""), nil
+	}))
+	return mux
+}
+
+// apiCommand authenticates a request, builds its command and runs it as the bot
+func (s *Server) apiCommand(build func(r *http.Request) (room string, msg *protocol.Message, err error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bot, ok := s.botForToken(requestToken(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="chat"`)
+			writeAPIResponse(w, protocol.NewErrorResponse(protocol.CodeAuthRequired, "Missing or invalid bot token"))
+			return
+		}
+		if reason, banned := s.userBanReason(bot); banned {
+			writeAPIResponse(w, protocol.NewErrorResponse(protocol.CodeForbidden, "You are banned: "+reason))
+			return
+		}
+
+		room, msg, err := build(r)
+		if err != nil {
+			writeAPIResponse(w, protocol.NewErrorResponse(protocol.CodeInvalidMessage, "Invalid request body"))
+			return
+		}
+		// Bots can't join rooms, so they may only use the lobby and rooms people have joined
+		if room = normalizeRoom(room); room == lobbyName {
+			room = ""
+		}
+		if room != "" && !validRoom(room) {
+			writeAPIResponse(w, protocol.NewErrorResponse(protocol.CodeValidation, "Invalid room name"))
+			return
+		}
+		if room != "" && !s.roomExists(room) {
+			writeAPIResponse(w, protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("No room %s", displayRoom(room))))
+			return
+		}
+
+		response, _ := s.execute(s.newAPIClient(bot, room, r), msg)
+		writeAPIResponse(w, response)
+	}
+}
+
+// newAPIClient creates a registered client for one HTTP request
+// It is not in the client list, so it never receives events, and it has no session:
+// it can only run apiCommands
+func (s *Server) newAPIClient(bot, room string, r *http.Request) *Client {
+	var remote net.Addr = apiAddr(r.RemoteAddr)
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		remote = net.TCPAddrFromAddrPort(addrPort)
+	}
+
+	now := time.Now()
+	return &Client{
+		conn:        apiConn{remote: remote},
+		listener:    apiListener,
+		codec:       apiListener.codec,
+		username:    bot,
+		registered:  true,
+		room:        room,
+		connectedAt: now,
+		lastActive:  now,
+		sessionless: true,
+		done:        closedDone,
+	}
+}
+
+// writeAPIResponse writes a protocol response with a matching HTTP status
+func writeAPIResponse(w http.ResponseWriter, response *protocol.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiStatus(response))
+	json.NewEncoder(w).Encode(response)
+}
+
+// apiStatus maps a response's error code to an HTTP status
+func apiStatus(response *protocol.Response) int {
+	if response.Success {
+		return http.StatusOK
+	}
+	switch response.Code {
+	case protocol.CodeAuthRequired:
+		return http.StatusUnauthorized
+	case protocol.CodeForbidden:
+		return http.StatusForbidden
+	case protocol.CodeNotFound, protocol.CodeUnknownCommand:
+		return http.StatusNotFound
+	case protocol.CodeRateLimited:
+		return http.StatusTooManyRequests
+	case protocol.CodeInvalidMessage, protocol.CodeValidation:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	s := startTestServer(t, WithBotTokens(map[string]string{"s3cret": "ci-bot"}))
+	alice := dialTestServer(t, s)
+	alice.call(protocol.CmdRegister, "alice")
+	alice.call(protocol.CmdJoinRoom, "ops")
+
+	api := httptest.NewServer(s.APIHandler())
+	t.Cleanup(api.Close)
+
+	call := func(method, path, token, body string) (int, *protocol.Response) {
+		t.Helper()
+		req, err := http.NewRequest(method, api.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("NewRequest() error = %v", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s error = %v", method, path, err)
+		}
+		defer resp.Body.Close()
+
+		var result protocol.Response
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		return resp.StatusCode, &result
+	}
+
+	if status, _ := call("GET", "/api/time", "", ""); status != http.StatusUnauthorized {
+		t.Errorf("GET /api/time without a token = %d, want 401", status)
+	}
+	if status, _ := call("GET", "/api/time", "wrong", ""); status != http.StatusUnauthorized {
+		t.Errorf("GET /api/time with a bad token = %d, want 401", status)
+	}
+	if status, resp := call("GET", "/api/time", "s3cret", ""); status != http.StatusOK || resp.Data == "" {
+		t.Errorf("GET /api/time = %d %+v", status, resp)
+	}
+
+	// A posted message reaches the room like one sent over TCP
+	if status, resp := call("POST", "/api/messages", "s3cret", `{"room":"#ops","message":"deploy done"}`); status != http.StatusOK {
+		t.Fatalf("POST /api/messages = %d %+v", status, resp)
+	}
+	if event := alice.readEvent(protocol.EventMessage); event.From != "ci-bot" || event.Data != "deploy done" || event.Room != "ops" {
+		t.Errorf("alice got %+v, want ci-bot's message in ops", event)
+	}
+	if _, resp := call("GET", "/api/messages?room=ops", "s3cret", ""); !strings.Contains(resp.Data, "deploy done") {
+		t.Errorf("GET /api/messages = %+v, want the posted message", resp)
+	}
+	if _, resp := call("GET", "/api/users", "s3cret", ""); !strings.Contains(resp.Data, "alice") {
+		t.Errorf("GET /api/users = %+v, want alice", resp)
+	}
+
+	// Handlers validate exactly as they do for TCP
+	if status, _ := call("POST", "/api/messages", "s3cret", `{"message":""}`); status != http.StatusBadRequest {
+		t.Errorf("POST /api/messages without text = %d, want 400", status)
+	}
+	if status, _ := call("POST", "/api/messages", "s3cret", `not json`); status != http.StatusBadRequest {
+		t.Errorf("POST /api/messages with a bad body = %d, want 400", status)
+	}
+
+	// Bots can't create rooms, and "lobby" is the lobby
+	if status, resp := call("POST", "/api/messages", "s3cret", `{"room":"nowhere","message":"hi"}`); status != http.StatusNotFound {
+		t.Errorf("POST to a room nobody joined = %d %+v, want 404", status, resp)
+	}
+	if status, resp := call("POST", "/api/messages", "s3cret", `{"room":"bad room","message":"hi"}`); status != http.StatusBadRequest {
+		t.Errorf("POST to an invalid room = %d %+v, want 400", status, resp)
+	}
+	if status, resp := call("POST", "/api/messages", "s3cret", `{"room":"lobby","message":"hello all"}`); status != http.StatusOK {
+		t.Fatalf("POST to the lobby = %d %+v", status, resp)
+	}
+	if event := alice.readEvent(protocol.EventMessage); event.Data != "hello all" || event.Room != "" {
+		t.Errorf("alice got %+v, want ci-bot's message in the lobby", event)
+	}
+
+	// Slash commands that need a session are refused, and the server keeps serving
+	for _, text := range []string{"/join ops", "/leave ops", "/nick x", "/reply 1 hi", "/search deploy", "/msg alice hi"} {
+		if status, resp := call("POST", "/api/messages", "s3cret", `{"message":"`+text+`"}`); status != http.StatusForbidden {
+			t.Errorf("POST %q = %d %+v, want 403", text, status, resp)
+		}
+	}
+	if status, resp := call("POST", "/api/messages", "s3cret", `{"room":"ops","message":"/me deploys"}`); status != http.StatusOK {
+		t.Fatalf("POST /me = %d %+v", status, resp)
+	}
+	if event := alice.readEvent(protocol.EventMessage); event.Message != "[#ops] * ci-bot deploys" {
+		t.Errorf("alice got %+v, want ci-bot's action", event)
+	}
+	if _, resp := call("GET", "/api/users", "s3cret", ""); strings.Contains(resp.Data, "x") {
+		t.Errorf("GET /api/users = %+v, want no user attached by /nick", resp)
+	}
+}
+
+func TestAPIClientHasNoSession(t *testing.T) {
+	s := NewServer(":0", WithLogger(slog.New(slog.DiscardHandler)))
+	client := s.newAPIClient("ci-bot", "", httptest.NewRequest("GET", "/api/time", nil))
+
+	for _, command := range []string{protocol.CmdSessions, protocol.CmdJoinRoom, protocol.CmdRegister, protocol.CmdStatus} {
+		if resp := s.processCommand(client, protocol.NewMessage("", command, "x")); resp.Code != protocol.CodeForbidden {
+			t.Errorf("%s over the API = %+v, want FORBIDDEN", command, resp)
+		}
+	}
+
+	// Frames for API clients are dropped instead of blocking
+	if client.enqueue([]byte("frame\n"), true) {
+		t.Error("Expected enqueue to an API client to fail")
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"tcp_server/protocol"
+	"time"
+)
+
+// registerBuiltinCommands registers the commands every server supports
+func (s *Server) registerBuiltinCommands() {
+	builtins := []CommandHandler{
+		{Name: protocol.CmdEcho, RequiresData: true, Handler: s.handleEcho},
+		{Name: protocol.CmdRegister, RequiresData: true, Handler: s.handleRegister},
+		{Name: protocol.CmdMessage, RequiresData: true, Handler: s.handleMessage},
+		{Name: protocol.CmdListUsers, Handler: s.handleListUsers},
+		{Name: protocol.CmdListMessages, Handler: s.handleListMessages},
+		{Name: protocol.CmdTime, Handler: s.handleTime},
+		{Name: protocol.CmdQuit, Handler: s.handleQuit},
+		{Name: protocol.CmdStatus, RequiresData: true, RequiresAuth: true, Handler: s.handleStatus},
+		{Name: protocol.CmdPrivateMessage, RequiresData: true, RequiresAuth: true, Handler: s.handlePrivateMessage},
+		{Name: protocol.CmdJoinRoom, RequiresData: true, RequiresAuth: true, Handler: s.handleJoinRoom},
+		{Name: protocol.CmdLeaveRoom, RequiresData: true, RequiresAuth: true, Handler: s.handleLeaveRoom},
+		{Name: protocol.CmdListRooms, Handler: s.handleListRooms},
+		{Name: protocol.CmdSessions, RequiresAuth: true, Handler: s.handleSessions},
+		{Name: protocol.CmdKillSession, RequiresData: true, RequiresAuth: true, Handler: s.handleKillSession},
+		{Name: protocol.CmdResume, RequiresData: true, Handler: s.handleResume},
+		{Name: protocol.CmdEdit, RequiresData: true, RequiresAuth: true, Handler: s.handleEdit},
+		{Name: protocol.CmdDelete, RequiresData: true, RequiresAuth: true, Handler: s.handleDelete},
+		{Name: protocol.CmdReact, RequiresData: true, RequiresAuth: true, Handler: s.handleReact},
+		{Name: protocol.CmdUnreact, RequiresData: true, RequiresAuth: true, Handler: s.handleUnreact},
+		{Name: protocol.CmdReply, RequiresData: true, RequiresAuth: true, Handler: s.handleReply},
+		{Name: protocol.CmdThread, RequiresData: true, RequiresAuth: true, Handler: s.handleThread},
+		{Name: protocol.CmdFollow, RequiresData: true, RequiresAuth: true, Handler: s.handleFollow},
+		{Name: protocol.CmdUnfollow, RequiresData: true, RequiresAuth: true, Handler: s.handleUnfollow},
+		{Name: protocol.CmdSearch, RequiresData: true, RequiresAuth: true, Handler: s.handleSearch},
+		{Name: protocol.CmdSay, RequiresData: true, RequiresAuth: true, Handler: s.handleSay},
+	}
+
+	for _, h := range builtins {
+		if err := s.commands.Register(h); err != nil {
+			// Built-in names are fixed, so a failure here is a programming error
+			panic(err)
+		}
+	}
+}
+
+// handleEcho sends back the data (useful for testing)
+func (s *Server) handleEcho(client *Client, msg *protocol.Message) *protocol.Response {
+	return protocol.NewResponse(true, "Echo response", msg.Data)
+}
+
+// handleRegister sets the client's username
+func (s *Server) handleRegister(client *Client, msg *protocol.Message) *protocol.Response {
+	name, key := splitArgs(msg.Data)
+	if reason, banned := s.userBanReason(name); banned {
+		return protocol.NewErrorResponse(protocol.CodeForbidden, fmt.Sprintf("Username %s is banned: %s", name, reason))
+	}
+
+	// Sessions registering the same username share one user, once they show its key
+	joined, left, err := s.attachUser(client, name, key)
+	if err != nil {
+		return protocol.NewErrorResponse(protocol.CodeForbidden,
+			fmt.Sprintf("Username %s is in use; add a session with the key from SESSIONS: REGISTER %s <key>", name, name))
+	}
+	s.clientLogger(client).Info("client registered", "session", client.sessionID)
+
+	// Tell everyone else who arrived (or who changed their name)
+	switch {
+	case joined && left != nil:
+		s.announceRename(left.name, name, client)
+	case left != nil:
+		s.announceLeave(left.name, client)
+	case joined:
+		s.announceJoin(name, client)
+	}
+
+	// Data carries the resume token when session resumption is enabled
+	client.mu.Lock()
+	token, u := client.resumeToken, client.user
+	client.mu.Unlock()
+	response := protocol.NewResponse(true, fmt.Sprintf("Registration successful. Welcome, %s!", name), token)
+	response.Key = u.key
+	return response
+}
+
+// handleMessage stores a chat message and sends it to the session's active room
+// In the lobby that is every connected client; text starting with "/" runs a slash
+// command instead ("//" sends a literal leading slash)
+func (s *Server) handleMessage(client *Client, msg *protocol.Message) *protocol.Response {
+	msg.From = client.Username()
+	if name, args, ok := parseSlash(msg.Data); ok {
+		return s.runSlash(client, name, args)
+	}
+	if s.isMuted(msg.From) {
+		return protocol.NewErrorResponse(protocol.CodeForbidden, "You are muted")
+	}
+
+	content := msg.Data
+	if strings.HasPrefix(strings.TrimSpace(content), "//") {
+		content = strings.TrimPrefix(strings.TrimSpace(content), "/")
+	}
+
+	// Store message in history and send it to the room
+	// Data carries the message's ID for EDIT, DELETE and REACT
+	id, failed := s.postMessage(StoredMessage{From: msg.From, Room: client.Room(), Content: content}, client)
+	if failed != nil {
+		return failed
+	}
+	return protocol.NewResponse(true, "Message broadcasted", strconv.FormatUint(id, 10))
+}
+
+// handleSay posts a chat message to one of the user's rooms ("lobby" for the lobby)
+// without changing the session's active room: "ops deploy done"
+func (s *Server) handleSay(client *Client, msg *protocol.Message) *protocol.Response {
+	target, text := splitArgs(msg.Data)
+	if text == "" {
+		return protocol.NewErrorResponse(protocol.CodeValidation, "Usage: SAY room message")
+	}
+	room := normalizeRoom(target)
+	if room == lobbyName {
+		room = ""
+	} else if !s.isMember(client.User(), room) {
+		return protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("You are not in %s", displayRoom(room)))
+	}
+
+	msg.From = client.Username()
+	if s.isMuted(msg.From) {
+		return protocol.NewErrorResponse(protocol.CodeForbidden, "You are muted")
+	}
+
+	id, failed := s.postMessage(StoredMessage{From: msg.From, Room: room, Content: text}, client)
+	if failed != nil {
+		return failed
+	}
+	return protocol.NewResponse(true, "Message broadcasted", strconv.FormatUint(id, 10))
+}
+
+// handleListUsers lists all connected users ("LIST_USERS status" adds status and idle time)
+func (s *Server) handleListUsers(client *Client, msg *protocol.Message) *protocol.Response {
+	if msg.Data == protocol.ListUsersWithStatus {
+		return protocol.NewResponse(true, "Online users", s.listUsersWithStatus())
+	}
+
+	users := s.getConnectedUsers()
+	return protocol.NewResponse(true, "Online users", strings.Join(users, ", "))
+}
+
+// handleListMessages lists recent messages
+func (s *Server) handleListMessages(client *Client, msg *protocol.Message) *protocol.Response {
+	messages := s.getRecentRoomMessages(client.Room(), 20) // Get last 20 messages of the active room
+	return protocol.NewResponse(true, "Recent messages", messages)
+}
+
+// handleTime returns the server time
+func (s *Server) handleTime(client *Client, msg *protocol.Message) *protocol.Response {
+	serverTime := time.Now().Format(time.RFC3339)
+	return protocol.NewResponse(true, "Server time", serverTime)
+}
+
+// handleQuit acknowledges a disconnect request (handleClient closes the connection)
+func (s *Server) handleQuit(client *Client, msg *protocol.Message) *protocol.Response {
+	client.endSession()
+	return protocol.NewResponse(true, "Goodbye!", "")
+}
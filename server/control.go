@@ -0,0 +1,253 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The control channel is a small line-based protocol for operators, kept off the chat port.
+//
+// Request:  one line, "COMMAND [args...]"
+// Response: "OK <summary>" or "ERR <message>", then zero or more body lines,
+//           then a line containing a single "." (body lines starting with "." are doubled)
+
+// controlPrefixTCP selects a loopback TCP control address instead of a Unix socket
+const controlPrefixTCP = "tcp:"
+
+// controlHelp lists the control commands
+const controlHelp = `STATS              Server statistics
+CLIENTS            List connections
+KICK user [reason] Disconnect a user
+DRAIN              Stop accepting new connections
+RELOAD             Reload configuration
+HISTORY [n]        Dump the last n messages (default all)
+HELP               Show this help
+QUIT               Close the control session`
+
+// ListenControl opens the control listener
+// address is a Unix socket path, or "tcp:host:port" which must be a loopback address
+func ListenControl(address string) (net.Listener, error) {
+	if tcpAddr, ok := strings.CutPrefix(address, controlPrefixTCP); ok {
+		host, _, err := net.SplitHostPort(tcpAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid control address: %w", err)
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("control address %s is not a loopback address", tcpAddr)
+		}
+		return net.Listen("tcp", tcpAddr)
+	}
+
+	// Only the owner may talk to the control socket
+	return listenUnix(address, 0o600)
+}
+
+// DialControl connects to a control listener opened by ListenControl
+func DialControl(address string) (net.Conn, error) {
+	if tcpAddr, ok := strings.CutPrefix(address, controlPrefixTCP); ok {
+		return net.Dial("tcp", tcpAddr)
+	}
+	return net.Dial("unix", address)
+}
+
+// ServeControl accepts control connections until the listener is closed
+func (s *Server) ServeControl(l net.Listener) error {
+	s.logger.Info("control channel started", "address", l.Addr().String())
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("control accept failed: %w", err)
+		}
+		go s.handleControl(conn)
+	}
+}
+
+// handleControl serves one control session
+func (s *Server) handleControl(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.logger.Warn("control read failed", "error", err)
+			}
+			return
+		}
+
+		command, args := splitArgs(line)
+		command = strings.ToUpper(command)
+		if command == "" {
+			continue
+		}
+		if command == "QUIT" {
+			writeControlReply(writer, nil, "bye", "")
+			writer.Flush()
+			return
+		}
+
+		s.logger.Info("control command", "command", command)
+		summary, body, err := s.runControl(command, args)
+		writeControlReply(writer, err, summary, body)
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// runControl executes a control command and returns its summary line and body
+func (s *Server) runControl(command, args string) (summary, body string, err error) {
+	switch command {
+	case "STATS":
+		return "stats", s.controlStats(), nil
+
+	case "CLIENTS":
+		clients := s.snapshotClients()
+		return fmt.Sprintf("%d client(s)", len(clients)), s.describeConnections(), nil
+
+	case "KICK":
+		username, reason := splitArgs(args)
+		if username == "" {
+			return "", "", errors.New("usage: KICK user [reason]")
+		}
+		if reason == "" {
+			reason = "Kicked by an operator"
+		}
+		kicked := s.kickUser(username, reason)
+		if kicked == 0 {
+			return "", "", fmt.Errorf("user %s is not connected", username)
+		}
+		return fmt.Sprintf("kicked %s (%d connection(s))", username, kicked), "", nil
+
+	case "DRAIN":
+		if err := s.Drain(); err != nil {
+			return "", "", err
+		}
+		return "draining: no new connections accepted", "", nil
+
+	case "RELOAD":
+		if s.reload == nil {
+			return "", "", errors.New("reload is not configured")
+		}
+		if err := s.reload(); err != nil {
+			return "", "", fmt.Errorf("reload failed: %w", err)
+		}
+		return "reloaded", "", nil
+
+	case "HISTORY":
+		count := historySize
+		if args != "" {
+			n, err := strconv.Atoi(args)
+			if err != nil || n <= 0 {
+				return "", "", errors.New("usage: HISTORY [n]")
+			}
+			count = n
+		}
+		return "history", s.getRecentMessages(count), nil
+
+	case "HELP":
+		return "commands", controlHelp, nil
+
+	default:
+		return "", "", fmt.Errorf("unknown command %s (try HELP)", command)
+	}
+}
+
+// controlStats formats server statistics, one "key: value" per line
+func (s *Server) controlStats() string {
+	s.mu.RLock()
+	clients := len(s.clients)
+	messages := len(s.messages)
+	s.mu.RUnlock()
+
+	uptime := time.Duration(0)
+	if !s.startedAt.IsZero() {
+		uptime = time.Since(s.startedAt).Round(time.Second)
+	}
+
+	lines := []string{
+		fmt.Sprintf("uptime: %s", uptime),
+		fmt.Sprintf("clients: %d", clients),
+		fmt.Sprintf("accepted: %d", s.metrics.accepted.Value()),
+		fmt.Sprintf("messages: %d", messages),
+		fmt.Sprintf("bytes_in: %d", s.metrics.bytesIn.Value()),
+		fmt.Sprintf("bytes_out: %d", s.metrics.bytesOut.Value()),
+		fmt.Sprintf("panics: %d", s.metrics.panics.Value()),
+		fmt.Sprintf("draining: %t", s.draining.Load()),
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeControlReply writes a status line, the dot-stuffed body and the terminator
+func writeControlReply(w *bufio.Writer, err error, summary, body string) {
+	if err != nil {
+		fmt.Fprintf(w, "ERR %s\n", err)
+	} else {
+		fmt.Fprintf(w, "OK %s\n", summary)
+	}
+
+	if body != "" {
+		for _, line := range strings.Split(body, "\n") {
+			if strings.HasPrefix(line, ".") {
+				line = "." + line
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	fmt.Fprintln(w, ".")
+}
+
+// ReadControlReply reads one reply from a control connection
+// It returns the body lines and an error if the server answered ERR
+func ReadControlReply(r *bufio.Reader) (summary string, body []string, err error) {
+	status, err := r.ReadString('\n')
+	if err != nil {
+		return "", nil, err
+	}
+	status = strings.TrimRight(status, "\r\n")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "." {
+			break
+		}
+		body = append(body, strings.TrimPrefix(line, "."))
+	}
+
+	if msg, ok := strings.CutPrefix(status, "ERR "); ok {
+		return "", body, errors.New(msg)
+	}
+	return strings.TrimPrefix(status, "OK "), body, nil
+}
+
+// Drain stops accepting new connections while existing clients stay connected
+func (s *Server) Drain() error {
+	if !s.draining.CompareAndSwap(false, true) {
+		return errors.New("server is already draining")
+	}
+	s.mu.RLock()
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	s.mu.RUnlock()
+	s.logger.Info("server draining")
+	return nil
+}
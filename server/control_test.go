@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+)
+
+// controlSession sends a control command and returns the reply
+func controlSession(t *testing.T, conn net.Conn, reader *bufio.Reader, command string) (string, []string, error) {
+	t.Helper()
+	if _, err := fmt.Fprintf(conn, "%s\n", command); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	return ReadControlReply(reader)
+}
+
+func TestControlChannel(t *testing.T) {
+	reloaded := false
+	s := startTestServer(t, WithReloadFunc(func() error {
+		reloaded = true
+		return nil
+	}))
+
+	socket := filepath.Join(t.TempDir(), "control.sock")
+	l, err := ListenControl(socket)
+	if err != nil {
+		t.Fatalf("ListenControl() error = %v", err)
+	}
+	defer l.Close()
+	go s.ServeControl(l)
+
+	conn, err := DialControl(socket)
+	if err != nil {
+		t.Fatalf("DialControl() error = %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	alice := dialTestServer(t, s)
+	alice.call(protocol.CmdRegister, "alice")
+	alice.call(protocol.CmdMessage, ".starts with a dot")
+
+	summary, body, err := controlSession(t, conn, reader, "CLIENTS")
+	if err != nil || summary != "1 client(s)" || !strings.HasPrefix(body[0], "alice ") {
+		t.Errorf("CLIENTS = %q %q %v", summary, body, err)
+	}
+
+	// Body lines starting with "." survive dot-stuffing
+	_, body, err = controlSession(t, conn, reader, "HISTORY 1")
+	if err != nil || !strings.HasSuffix(body[0], "alice: .starts with a dot") {
+		t.Errorf("HISTORY = %q %v", body, err)
+	}
+
+	if _, _, err := controlSession(t, conn, reader, "RELOAD"); err != nil || !reloaded {
+		t.Errorf("RELOAD error = %v, reloaded = %v", err, reloaded)
+	}
+
+	if _, _, err := controlSession(t, conn, reader, "KICK bob"); err == nil {
+		t.Error("Expected KICK of an unknown user to fail")
+	}
+
+	if _, _, err := controlSession(t, conn, reader, "DRAIN"); err != nil {
+		t.Errorf("DRAIN error = %v", err)
+	}
+	if _, err := net.Dial("tcp", s.Addrs()[0].String()); err == nil {
+		t.Error("Expected new connections to be refused after DRAIN")
+	}
+
+	// Existing clients keep working while draining
+	if resp := alice.call(protocol.CmdTime, ""); !resp.Success {
+		t.Errorf("Expected existing client to keep working, got %+v", resp)
+	}
+}
+
+func TestListenControlRejectsPublicTCP(t *testing.T) {
+	if _, err := ListenControl("tcp:0.0.0.0:0"); err == nil {
+		t.Error("Expected non-loopback control address to be refused")
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"strconv"
+	"tcp_server/protocol"
+	"time"
+)
+
+// heardFrom records that the peer sent something, so it is alive
+func (c *Client) heardFrom() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pingsMissed = 0
+}
+
+// RTT returns the round-trip time measured by the last answered ping (0 if none yet)
+func (c *Client) RTT() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rtt
+}
+
+// handleHeartbeat answers PING with a pong event and records PONG round trips
+// It returns false for every other command
+func (s *Server) handleHeartbeat(client *Client, msg *protocol.Message) bool {
+	switch msg.Command {
+	case protocol.CmdPing:
+		if frame, err := client.codec.EncodeResponse(protocol.NewEvent(protocol.EventPong, "", "pong", msg.Data)); err == nil {
+			client.enqueue(frame, true)
+		}
+		return true
+
+	case protocol.CmdPong:
+		client.mu.Lock()
+		if !client.pingSentAt.IsZero() && msg.Data == strconv.FormatInt(client.pingSentAt.UnixNano(), 10) {
+			client.rtt = time.Since(client.pingSentAt)
+		}
+		client.mu.Unlock()
+		return true
+
+	default:
+		return false
+	}
+}
+
+// heartbeatLoop pings every client each heartbeat interval
+// Connections that sent nothing for heartbeatMissed pings are closed, so a half-open
+// connection is noticed within seconds instead of waiting for the read deadline
+func (s *Server) heartbeatLoop() {
+	ticker := time.NewTicker(s.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+			for _, client := range s.snapshotClients() {
+				s.ping(client)
+			}
+		}
+	}
+}
+
+// ping sends one heartbeat, or closes the connection if too many went unanswered
+func (s *Server) ping(client *Client) {
+	client.mu.Lock()
+	dead := client.pingsMissed >= s.heartbeatMissed
+	client.pingsMissed++
+	client.pingSentAt = time.Now()
+	data := strconv.FormatInt(client.pingSentAt.UnixNano(), 10)
+	client.mu.Unlock()
+
+	if dead {
+		s.clientLogger(client).Warn("heartbeat timeout, closing connection", "missed", s.heartbeatMissed)
+		s.metrics.heartbeatTimeouts.Inc()
+		client.conn.Close() // handleClient cleans up (and may park the session for RESUME)
+		return
+	}
+
+	if frame, err := client.codec.EncodeResponse(protocol.NewEvent(protocol.EventPing, "", "ping", data)); err == nil {
+		s.sendEvent(client, frame)
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"tcp_server/protocol"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatReapsSilentClient(t *testing.T) {
+	s := startTestServer(t, WithHeartbeat(20*time.Millisecond, 2))
+	go s.heartbeatLoop()
+
+	// A peer that never answers is closed after two unanswered pings
+	silent := dialTestServer(t, s)
+	silent.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.Copy(io.Discard, silent.reader); err != nil {
+		t.Fatalf("Expected the server to close the connection, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	s.Metrics().WriteText(&buf)
+	if !bytes.Contains(buf.Bytes(), []byte("chat_heartbeat_timeouts_total 1")) {
+		t.Errorf("heartbeat timeout not counted:\n%s", buf.String())
+	}
+}
+
+func TestHeartbeatPingPong(t *testing.T) {
+	s := startTestServer(t, WithHeartbeat(20*time.Millisecond, 2))
+	go s.heartbeatLoop()
+
+	tc := dialTestServer(t, s)
+	for range 5 {
+		ping := tc.readEvent(protocol.EventPing)
+		tc.send(protocol.CmdPong, ping.Data)
+	}
+	if clients := s.snapshotClients(); len(clients) != 1 || clients[0].RTT() <= 0 {
+		t.Errorf("Expected an answering client to stay connected with an RTT")
+	}
+
+	// Client pings are answered with a pong event and no reply
+	tc.send(protocol.CmdPing, "42")
+	if pong := tc.readEvent(protocol.EventPong); pong.Data != "42" {
+		t.Errorf("Unexpected pong: %+v", pong)
+	}
+	if resp := tc.call(protocol.CmdEcho, "still here"); resp.Data != "still here" {
+		t.Errorf("Expected ECHO reply after PING, got %+v", resp)
+	}
+}
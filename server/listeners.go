@@ -0,0 +1,296 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"tcp_server/protocol"
+	"tcp_server/proxyproto"
+	"time"
+)
+
+// proxyHeaderTimeout bounds how long a trusted proxy may take to send its PROXY header
+const proxyHeaderTimeout = 5 * time.Second
+
+// defaultSocketMode is the permission of Unix socket files unless a listener sets Mode
+const defaultSocketMode os.FileMode = 0o660
+
+// Address prefixes selecting the listener network
+const (
+	schemeTCP  = "tcp://"
+	schemeUnix = "unix://"
+)
+
+// ListenerConfig describes one address the server accepts clients on and its policy
+// Clients of every listener share the same users, rooms and client list
+type ListenerConfig struct {
+	Address        string            // "host:port", "tcp://host:port" or "unix:///path/to/chat.sock"
+	Mode           os.FileMode       // Permissions of a Unix socket file (0 = 0660)
+	Name           string            // Shown in logs and the connection list (default: the address)
+	Codec          protocol.Codec    // Wire format (nil = JSON)
+	TLS            *tls.Config       // Serve TLS on this listener
+	RequireAuth    bool              // Only REGISTER, RESUME and QUIT before registering
+	MaxConnections int               // Concurrent connections on this listener (0 = unlimited)
+	RateLimit      *RateLimitProfile // Per-client command rate on this listener (nil = none)
+	TrustedProxies []netip.Prefix    // Load balancers that must send a PROXY v1/v2 header (nil = none)
+}
+
+// RateLimitProfile is a per-client command rate and burst
+type RateLimitProfile struct {
+	Rate  float64
+	Burst int
+}
+
+// listener is an open listener with its policy
+type listener struct {
+	net.Listener
+	name           string
+	codec          protocol.Codec
+	tls            *tls.Config
+	maxConnections int
+	trustedProxies []netip.Prefix
+	middleware     Middleware   // Listener policy run before the server middleware (nil = none)
+	active         atomic.Int64 // Connections currently accepted on this listener
+}
+
+// newListener opens the listener described by cfg
+func newListener(cfg ListenerConfig) (*listener, error) {
+	l, err := listen(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return configureListener(l, cfg), nil
+}
+
+// configureListener applies cfg's policy to an open listener
+func configureListener(l net.Listener, cfg ListenerConfig) *listener {
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Address
+	}
+	if name == "" {
+		name = l.Addr().String()
+	}
+	codec := cfg.Codec
+	if codec == nil {
+		codec = protocol.JSONCodec
+	}
+
+	var policy []Middleware
+	if cfg.RequireAuth {
+		policy = append(policy, RequireRegistration())
+	}
+	if cfg.RateLimit != nil {
+		policy = append(policy, RateLimit(cfg.RateLimit.Rate, cfg.RateLimit.Burst))
+	}
+
+	result := &listener{
+		Listener:       l,
+		name:           name,
+		codec:          codec,
+		tls:            cfg.TLS,
+		maxConnections: cfg.MaxConnections,
+		trustedProxies: cfg.TrustedProxies,
+	}
+	if len(policy) > 0 {
+		result.middleware = Chain(policy...)
+	}
+	return result
+}
+
+// ParseListenerConfig parses a listener spec: an address optionally followed by
+// URL-style policy parameters, e.g.
+//
+//	:8443?name=public&tls&cert=chat.pem&key=chat.key&auth&max=500&rate=5&burst=10
+//	:8080?proxy=10.0.0.0/8,192.168.1.5
+//	unix:///run/chat.sock?codec=text&mode=0600
+func ParseListenerConfig(spec string) (ListenerConfig, error) {
+	address, query, _ := strings.Cut(spec, "?")
+	cfg := ListenerConfig{Address: address, Name: address}
+	if address == "" {
+		return cfg, fmt.Errorf("listener %q: missing address", spec)
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return cfg, fmt.Errorf("listener %q: %w", spec, err)
+	}
+
+	var rate RateLimitProfile
+	var certFile, keyFile string
+	for key, values := range params {
+		value := values[len(values)-1]
+		switch key {
+		case "name":
+			cfg.Name = value
+		case "codec":
+			codec, ok := protocol.CodecByName(value)
+			if !ok {
+				return cfg, fmt.Errorf("listener %q: unknown codec %q", spec, value)
+			}
+			cfg.Codec = codec
+		case "auth":
+			cfg.RequireAuth = value == "" || value == "true"
+		case "max":
+			if cfg.MaxConnections, err = strconv.Atoi(value); err != nil || cfg.MaxConnections < 0 {
+				return cfg, fmt.Errorf("listener %q: invalid max %q", spec, value)
+			}
+		case "rate":
+			if rate.Rate, err = strconv.ParseFloat(value, 64); err != nil || rate.Rate <= 0 {
+				return cfg, fmt.Errorf("listener %q: invalid rate %q", spec, value)
+			}
+		case "burst":
+			if rate.Burst, err = strconv.Atoi(value); err != nil || rate.Burst <= 0 {
+				return cfg, fmt.Errorf("listener %q: invalid burst %q", spec, value)
+			}
+		case "mode":
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil {
+				return cfg, fmt.Errorf("listener %q: invalid mode %q", spec, value)
+			}
+			cfg.Mode = os.FileMode(mode)
+		case "proxy":
+			if cfg.TrustedProxies, err = proxyproto.ParsePrefixes(value); err != nil {
+				return cfg, fmt.Errorf("listener %q: %w", spec, err)
+			}
+		case "tls":
+			// Implied by cert and key
+		case "cert":
+			certFile = value
+		case "key":
+			keyFile = value
+		default:
+			return cfg, fmt.Errorf("listener %q: unknown parameter %q", spec, key)
+		}
+	}
+
+	if rate.Rate > 0 {
+		if rate.Burst == 0 {
+			rate.Burst = max(int(rate.Rate), 1)
+		}
+		cfg.RateLimit = &rate
+	} else if rate.Burst > 0 {
+		return cfg, fmt.Errorf("listener %q: burst needs a rate", spec)
+	}
+
+	if params.Has("tls") || certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return cfg, fmt.Errorf("listener %q: tls needs cert and key", spec)
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return cfg, fmt.Errorf("listener %q: %w", spec, err)
+		}
+		cfg.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	return cfg, nil
+}
+
+// WithListener adds an address to listen on besides the one passed to NewServer
+// Pass an empty address to NewServer to listen only on added listeners
+func WithListener(cfg ListenerConfig) Option {
+	return func(s *Server) {
+		s.listenerConfigs = append(s.listenerConfigs, cfg)
+	}
+}
+
+// splitAddress returns the network and address for a listen address
+// Addresses without a scheme are TCP
+func splitAddress(address string) (network, addr string) {
+	if path, ok := strings.CutPrefix(address, schemeUnix); ok {
+		return "unix", path
+	}
+	return "tcp", strings.TrimPrefix(address, schemeTCP)
+}
+
+// listen opens the listener described by cfg
+func listen(cfg ListenerConfig) (net.Listener, error) {
+	network, addr := splitAddress(cfg.Address)
+	if network == "unix" {
+		mode := cfg.Mode
+		if mode == 0 {
+			mode = defaultSocketMode
+		}
+		return listenUnix(addr, mode)
+	}
+	return net.Listen(network, addr)
+}
+
+// listenUnix listens on a Unix socket file with the given permissions
+// A socket file left behind by a crashed process is removed; one that still
+// accepts connections belongs to a running server and is left alone
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+// trackListener remembers a listener so Drain and Shutdown close it
+func (s *Server) trackListener(listener net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, l := range s.listeners {
+		if unwrapListener(l) == unwrapListener(listener) {
+			s.listeners[i] = listener // Keep the one carrying the policy
+			return
+		}
+	}
+	s.listeners = append(s.listeners, listener)
+}
+
+// unwrapListener returns the net.Listener underneath a listener's policy
+func unwrapListener(l net.Listener) net.Listener {
+	if pl, ok := l.(*listener); ok {
+		return pl.Listener
+	}
+	return l
+}
+
+// Addrs returns the addresses the server is listening on
+func (s *Server) Addrs() []net.Addr {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addrs := make([]net.Addr, len(s.listeners))
+	for i, l := range s.listeners {
+		addrs[i] = l.Addr()
+	}
+	return addrs
+}
+
+// Listener returns the name of the listener the client connected through
+func (c *Client) Listener() string {
+	if c.listener == nil {
+		return ""
+	}
+	return c.listener.name
+}
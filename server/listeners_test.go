@@ -0,0 +1,271 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+	"time"
+)
+
+func TestUnixAndTCPListeners(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.sock")
+
+	// A socket file left behind by a crashed server
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	s := NewServer("", WithLogger(slog.New(slog.DiscardHandler)),
+		WithListener(ListenerConfig{Address: "127.0.0.1:0"}),
+		WithListener(ListenerConfig{Address: "unix://" + path, Mode: 0o600}),
+	)
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	waitFor(t, func() bool { return len(s.Addrs()) == 2 })
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket permissions = %o, want 600", perm)
+	}
+
+	// A second server must not steal a socket that is in use
+	if _, err := listen(ListenerConfig{Address: "unix://" + path}); err == nil {
+		t.Error("Expected an error listening on a socket in use")
+	}
+
+	tcp := dialTestServer(t, s)
+	tcp.call(protocol.CmdRegister, "alice")
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial(unix) error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	sidecar := &testConn{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	sidecar.read()
+	sidecar.call(protocol.CmdRegister, "sidecar")
+
+	// Both listeners share one set of users
+	if event := tcp.readEvent(protocol.EventJoin); event.From != "sidecar" {
+		t.Errorf("Expected sidecar to join, got %+v", event)
+	}
+	if resp := sidecar.call(protocol.CmdPrivateMessage, "alice:hello from the socket"); !resp.Success {
+		t.Errorf("PM over the unix socket failed: %+v", resp)
+	}
+
+	s.Shutdown()
+	waitFor(t, func() bool {
+		_, err := os.Stat(path)
+		return os.IsNotExist(err)
+	})
+}
+
+func TestListenerPolicy(t *testing.T) {
+	s := NewServer("", WithLogger(slog.New(slog.DiscardHandler)),
+		WithListener(ListenerConfig{Address: "127.0.0.1:0", Name: "public", RequireAuth: true, MaxConnections: 1}),
+		WithListener(ListenerConfig{Address: "127.0.0.1:0", Name: "text", Codec: protocol.TextCodec}),
+	)
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	waitFor(t, func() bool { return len(s.Addrs()) == 2 })
+
+	// The public listener refuses commands before REGISTER
+	alice := dialTestServer(t, s)
+	if resp := alice.call(protocol.CmdListUsers, ""); resp.Code != protocol.CodeAuthRequired {
+		t.Errorf("LIST_USERS before REGISTER = %+v, want %s", resp, protocol.CodeAuthRequired)
+	}
+	alice.call(protocol.CmdRegister, "alice")
+
+	// ...and holds a single connection
+	conn, err := net.Dial("tcp", s.Addrs()[0].String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	full := &testConn{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	if resp := full.read(); resp.Code != protocol.CodeRejected {
+		t.Errorf("Second public connection got %+v, want rejection", resp)
+	}
+	conn.Close()
+
+	// A text client on the other listener talks to the JSON client
+	conn, err = net.Dial("tcp", s.Addrs()[1].String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	text := bufio.NewReader(conn)
+	readText := func(prefix string) string {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for {
+			line, err := text.ReadString('\n')
+			if err != nil {
+				t.Fatalf("ReadString() error = %v", err)
+			}
+			if strings.HasPrefix(line, prefix) {
+				return line
+			}
+		}
+	}
+	readText("OK ")
+
+	fmt.Fprintf(conn, "register bob\n")
+	readText("OK ")
+	if event := alice.readEvent(protocol.EventJoin); event.From != "bob" {
+		t.Errorf("Expected bob to join, got %+v", event)
+	}
+
+	alice.call(protocol.CmdMessage, "hi bob")
+	if line := readText("* "); !strings.Contains(line, "hi bob") {
+		t.Errorf("Text client got %q, want the message", line)
+	}
+
+	fmt.Fprintf(conn, "BOGUS\n")
+	if line := readText("ERR "); !strings.HasPrefix(line, "ERR "+protocol.CodeValidation) && !strings.HasPrefix(line, "ERR "+protocol.CodeUnknownCommand) {
+		t.Errorf("Unknown command got %q", line)
+	}
+
+	if list := s.describeConnections(); !strings.Contains(list, "via public") || !strings.Contains(list, "via text") {
+		t.Errorf("Connection list missing listener names:\n%s", list)
+	}
+}
+
+func TestTLSListener(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+	s := NewServer("", WithLogger(slog.New(slog.DiscardHandler)),
+		WithListener(ListenerConfig{Address: "127.0.0.1:0", TLS: &tls.Config{Certificates: []tls.Certificate{cert}}}),
+	)
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	waitFor(t, func() bool { return len(s.Addrs()) == 1 })
+
+	conn, err := tls.Dial("tcp", s.Addrs()[0].String(), &tls.Config{RootCAs: pool, ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("tls.Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	tc := &testConn{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	tc.read()
+	if resp := tc.call(protocol.CmdRegister, "alice"); !resp.Success {
+		t.Errorf("REGISTER over TLS failed: %+v", resp)
+	}
+}
+
+func TestParseListenerConfig(t *testing.T) {
+	cfg, err := ParseListenerConfig("unix:///tmp/chat.sock?name=ops&codec=text&auth&max=5&rate=2&mode=0600")
+	if err != nil {
+		t.Fatalf("ParseListenerConfig() error = %v", err)
+	}
+	if cfg.Address != "unix:///tmp/chat.sock" || cfg.Name != "ops" || cfg.Codec != protocol.TextCodec ||
+		!cfg.RequireAuth || cfg.MaxConnections != 5 || cfg.Mode != 0o600 {
+		t.Errorf("ParseListenerConfig() = %+v", cfg)
+	}
+	if cfg.RateLimit == nil || cfg.RateLimit.Rate != 2 || cfg.RateLimit.Burst != 2 {
+		t.Errorf("RateLimit = %+v, want rate 2 burst 2", cfg.RateLimit)
+	}
+
+	for _, spec := range []string{"", ":8080?codec=xml", ":8080?max=-1", ":8080?tls", ":8080?burst=3", ":8080?color=red"} {
+		if _, err := ParseListenerConfig(spec); err == nil {
+			t.Errorf("ParseListenerConfig(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+// selfSignedCert returns a certificate for localhost and a pool trusting it
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestProxyProtocol(t *testing.T) {
+	s := NewServer("", WithLogger(slog.New(slog.DiscardHandler)),
+		WithListener(ListenerConfig{Address: "127.0.0.1:0", TrustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}}),
+	)
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	waitFor(t, func() bool { return len(s.Addrs()) == 1 })
+
+	// The balancer passes on the real client address
+	conn, err := net.Dial("tcp", s.Addrs()[0].String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "PROXY TCP4 203.0.113.7 10.0.0.1 51234 8080\r\n")
+	tc := &testConn{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	tc.read()
+	tc.call(protocol.CmdRegister, "alice")
+
+	if list := s.describeConnections(); !strings.Contains(list, "203.0.113.7:51234") || !strings.Contains(list, "proxy=127.0.0.1") {
+		t.Errorf("Connection list = %q, want the proxied address", list)
+	}
+
+	// Address bans apply to the real client, not the balancer
+	s.moderation.bannedNets["203.0.113.0/24"] = bannedNet{prefix: netip.MustParsePrefix("203.0.113.0/24"), reason: "test"}
+	conn, err = net.Dial("tcp", s.Addrs()[0].String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "PROXY TCP4 203.0.113.8 10.0.0.1 51235 8080\r\n")
+	banned := &testConn{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	if resp := banned.read(); resp.Code != protocol.CodeRejected {
+		t.Errorf("Banned proxied client got %+v, want rejection", resp)
+	}
+
+	// A trusted source without a header is dropped
+	conn, err = net.Dial("tcp", s.Addrs()[0].String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "{\"command\":\"LIST_USERS\"}\n")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+		t.Error("Expected a connection without a PROXY header to be closed")
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"log/slog"
+	"tcp_server/protocol"
+	"time"
+)
+
+// secretCommands carry credentials or tokens, so their data is never logged
+var secretCommands = map[string]bool{
+	protocol.CmdOper:     true,
+	protocol.CmdRegister: true,
+	protocol.CmdResume:   true,
+}
+
+// clientLogger returns a logger carrying the client's connection context
+func (s *Server) clientLogger(client *Client) *slog.Logger {
+	return s.logger.With(
+		"remote_addr", client.RemoteAddr().String(),
+		"username", client.Username(),
+	)
+}
+
+// Logging returns middleware that logs every command with its outcome and latency
+func (s *Server) Logging() Middleware {
+	return func(next Handler) Handler {
+		return func(client *Client, msg *protocol.Message) *protocol.Response {
+			started := time.Now()
+			response := next(client, msg)
+			s.logCommand(client, msg, response, time.Since(started))
+			return response
+		}
+	}
+}
+
+// logCommand logs a handled command with its outcome and latency
+// Message bodies are replaced by their length when redaction is enabled, and always for secrets,
+// including slash commands typed into MESSAGE that carry them (e.g., "/nick alice key")
+func (s *Server) logCommand(client *Client, msg *protocol.Message, response *protocol.Response, latency time.Duration) {
+	attrs := []any{
+		"command", msg.Command,
+		"success", response.Success,
+		"latency", latency,
+	}
+	if response.Code != "" {
+		attrs = append(attrs, "code", response.Code)
+	}
+	secret := secretCommands[msg.Command] || msg.Command == protocol.CmdMessage && s.isSecretSlash(msg.Data)
+	if s.redact || secret {
+		attrs = append(attrs, "data_len", len(msg.Data))
+	} else {
+		attrs = append(attrs, "data", msg.Data)
+	}
+
+	s.clientLogger(client).Info("command handled", attrs...)
+}
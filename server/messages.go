@@ -0,0 +1,247 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"tcp_server/protocol"
+	"time"
+	"unicode"
+)
+
+// maxEmojiLength bounds a reaction so it stays an emoji or a short :shortcode:
+const maxEmojiLength = 32
+
+// Reaction is an emoji and the users who reacted with it
+type Reaction struct {
+	Emoji string
+	Users []string // In the order they reacted
+}
+
+// summary formats a message for LIST_MESSAGES, with its edit mark and reaction counts
+func (m StoredMessage) summary() string {
+	if m.Deleted {
+		return m.From + ": [deleted]"
+	}
+
+	text := m.line()
+	if !m.EditedAt.IsZero() {
+		text += " (edited)"
+	}
+	if len(m.Reactions) > 0 {
+		counts := make([]string, len(m.Reactions))
+		for i, r := range m.Reactions {
+			counts[i] = fmt.Sprintf("%s %d", r.Emoji, len(r.Users))
+		}
+		text += " [" + strings.Join(counts, ", ") + "]"
+	}
+	if m.Replies > 0 {
+		text += fmt.Sprintf(" (%d repl%s)", m.Replies, plural(m.Replies, "y", "ies"))
+	}
+	return text
+}
+
+// parseMessageID reads a message ID as shown by LIST_MESSAGES ("12", "(12)" or "#12")
+func parseMessageID(s string) (uint64, bool) {
+	s = strings.Trim(strings.TrimPrefix(s, "#"), "()")
+	id, err := strconv.ParseUint(s, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// plural picks the singular or plural ending for a count
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// messageLocked returns the stored message with an ID; the caller must hold s.mu
+func (s *Server) messageLocked(id uint64) (*StoredMessage, bool) {
+	// IDs increase along the history, so a binary search finds the message
+	i := sort.Search(len(s.messages), func(i int) bool { return s.messages[i].ID >= id })
+	if i == len(s.messages) || s.messages[i].ID != id {
+		return nil, false
+	}
+	return &s.messages[i], true
+}
+
+// findMessageLocked returns the stored message with an ID if the client may see it
+// Room messages are only visible to the room's members; the caller must hold s.mu
+func (s *Server) findMessageLocked(client *Client, id uint64) (*StoredMessage, bool) {
+	m, ok := s.messageLocked(id)
+	if !ok || m.Deleted {
+		return nil, false
+	}
+	if u := client.User(); m.Room != "" && (u == nil || !u.rooms[m.Room]) && !client.HasRole(RoleAdmin) {
+		return nil, false
+	}
+	return m, true
+}
+
+// updateMessage finds a message, applies a change and delivers the resulting event to its room
+// change returns the event to deliver, or an error response to stop without changing anything
+func (s *Server) updateMessage(client *Client, data string, change func(m *StoredMessage) (*protocol.Response, *protocol.Response)) *protocol.Response {
+	idText, _, _ := strings.Cut(data, " ")
+	id, ok := parseMessageID(idText)
+	if !ok {
+		return protocol.NewErrorResponse(protocol.CodeValidation, fmt.Sprintf("Invalid message ID: %s", idText))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopping {
+		return shuttingDown()
+	}
+	m, ok := s.findMessageLocked(client, id)
+	if !ok {
+		return protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("No message %d in the history", id))
+	}
+
+	event, failed := change(m)
+	if failed != nil {
+		return failed
+	}
+	event.Room = m.Room
+	event.ID = m.ID
+	if m.ReplyTo != 0 {
+		// Changes to a reply reach the same people the reply did
+		s.deliverLocked(event, s.followingLocked(m.ReplyTo, m.Room, client))
+	} else {
+		s.deliverLocked(event, inRoom(m.Room, client))
+	}
+	s.recordLocked(*m)
+	return nil
+}
+
+// canModify reports whether a client may edit or delete a message: its sender, or an admin
+func canModify(client *Client, m *StoredMessage) bool {
+	return m.From == client.Username() || client.HasRole(RoleAdmin)
+}
+
+// handleEdit replaces the text of one of the caller's messages ("id new text")
+// Admins may edit anyone's message
+func (s *Server) handleEdit(client *Client, msg *protocol.Message) *protocol.Response {
+	_, text, _ := strings.Cut(msg.Data, " ")
+	if text = strings.TrimSpace(text); text == "" {
+		return protocol.NewErrorResponse(protocol.CodeValidation, "Usage: EDIT id new text")
+	}
+
+	editor := client.Username()
+	if s.isMuted(editor) {
+		return protocol.NewErrorResponse(protocol.CodeForbidden, "You are muted")
+	}
+
+	var id uint64
+	if failed := s.updateMessage(client, msg.Data, func(m *StoredMessage) (*protocol.Response, *protocol.Response) {
+		if !canModify(client, m) {
+			return nil, protocol.NewErrorResponse(protocol.CodeForbidden, "You can only edit your own messages")
+		}
+		m.Content = text
+		m.EditedAt = time.Now()
+		id = m.ID
+		return protocol.NewEvent(protocol.EventEdit, editor,
+			fmt.Sprintf("%s %s edited message %d: %s", roomLabel(m.Room), editor, m.ID, text), text), nil
+	}); failed != nil {
+		return failed
+	}
+	return protocol.NewResponse(true, fmt.Sprintf("Message %d edited", id), "")
+}
+
+// handleDelete deletes one of the caller's messages ("id"); admins may delete anyone's
+func (s *Server) handleDelete(client *Client, msg *protocol.Message) *protocol.Response {
+	deleter := client.Username()
+
+	var id uint64
+	if failed := s.updateMessage(client, msg.Data, func(m *StoredMessage) (*protocol.Response, *protocol.Response) {
+		if !canModify(client, m) {
+			return nil, protocol.NewErrorResponse(protocol.CodeForbidden, "You can only delete your own messages")
+		}
+		m.Deleted = true
+		m.Content = ""
+		m.Reactions = nil
+		if parent, ok := s.messageLocked(m.ReplyTo); ok {
+			parent.Replies--
+		}
+		id = m.ID
+		return protocol.NewEvent(protocol.EventDelete, deleter,
+			fmt.Sprintf("%s %s deleted message %d", roomLabel(m.Room), deleter, m.ID), ""), nil
+	}); failed != nil {
+		return failed
+	}
+	return protocol.NewResponse(true, fmt.Sprintf("Message %d deleted", id), "")
+}
+
+// parseReaction splits "id emoji" and checks the emoji
+func parseReaction(data string) (string, *protocol.Response) {
+	_, emoji, _ := strings.Cut(data, " ")
+	emoji = strings.TrimSpace(emoji)
+	if emoji == "" || len(emoji) > maxEmojiLength || strings.IndexFunc(emoji, unicode.IsSpace) >= 0 {
+		return "", protocol.NewErrorResponse(protocol.CodeValidation, "Usage: REACT id emoji (a single emoji or :shortcode:)")
+	}
+	return emoji, nil
+}
+
+// handleReact adds the caller's emoji reaction to a message ("id emoji")
+func (s *Server) handleReact(client *Client, msg *protocol.Message) *protocol.Response {
+	emoji, failed := parseReaction(msg.Data)
+	if failed != nil {
+		return failed
+	}
+	user := client.Username()
+	if s.isMuted(user) {
+		return protocol.NewErrorResponse(protocol.CodeForbidden, "You are muted")
+	}
+
+	var count int
+	if failed := s.updateMessage(client, msg.Data, func(m *StoredMessage) (*protocol.Response, *protocol.Response) {
+		i := slices.IndexFunc(m.Reactions, func(r Reaction) bool { return r.Emoji == emoji })
+		if i < 0 {
+			m.Reactions = append(m.Reactions, Reaction{Emoji: emoji})
+			i = len(m.Reactions) - 1
+		}
+		if slices.Contains(m.Reactions[i].Users, user) {
+			return nil, protocol.NewErrorResponse(protocol.CodeValidation, fmt.Sprintf("You already reacted %s", emoji))
+		}
+		m.Reactions[i].Users = append(m.Reactions[i].Users, user)
+		count = len(m.Reactions[i].Users)
+		return protocol.NewEvent(protocol.EventReact, user,
+			fmt.Sprintf("%s %s reacted %s to message %d", roomLabel(m.Room), user, emoji, m.ID), emoji), nil
+	}); failed != nil {
+		return failed
+	}
+	return protocol.NewResponse(true, fmt.Sprintf("Reacted %s", emoji), strconv.Itoa(count))
+}
+
+// handleUnreact removes the caller's emoji reaction from a message ("id emoji")
+func (s *Server) handleUnreact(client *Client, msg *protocol.Message) *protocol.Response {
+	emoji, failed := parseReaction(msg.Data)
+	if failed != nil {
+		return failed
+	}
+	user := client.Username()
+
+	if failed := s.updateMessage(client, msg.Data, func(m *StoredMessage) (*protocol.Response, *protocol.Response) {
+		i := slices.IndexFunc(m.Reactions, func(r Reaction) bool { return r.Emoji == emoji })
+		j := -1
+		if i >= 0 {
+			j = slices.Index(m.Reactions[i].Users, user)
+		}
+		if j < 0 {
+			return nil, protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("You have not reacted %s", emoji))
+		}
+
+		m.Reactions[i].Users = slices.Delete(m.Reactions[i].Users, j, j+1)
+		if len(m.Reactions[i].Users) == 0 {
+			m.Reactions = slices.Delete(m.Reactions, i, i+1)
+		}
+		return protocol.NewEvent(protocol.EventUnreact, user,
+			fmt.Sprintf("%s %s removed %s from message %d", roomLabel(m.Room), user, emoji, m.ID), emoji), nil
+	}); failed != nil {
+		return failed
+	}
+	return protocol.NewResponse(true, fmt.Sprintf("Removed %s", emoji), "")
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+)
+
+func TestEditDeleteAndReactions(t *testing.T) {
+	s := startTestServer(t, WithOperators(map[string]string{"root": "hunter2"}))
+	alice := dialTestServer(t, s)
+	alice.call(protocol.CmdRegister, "alice")
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+
+	// MESSAGE replies with the new message's ID, which its event carries too
+	resp := alice.call(protocol.CmdMessage, "deploy at 5")
+	id := resp.Data
+	if event := bob.readEvent(protocol.EventMessage); id == "" || event.ID == 0 || id != formatID(event.ID) {
+		t.Fatalf("MESSAGE reply %+v, event %+v", resp, event)
+	}
+
+	// Only the sender may edit
+	if resp := bob.call(protocol.CmdEdit, id+" deploy at 6"); resp.Code != protocol.CodeForbidden {
+		t.Errorf("bob editing alice's message = %+v", resp)
+	}
+	if resp := alice.call(protocol.CmdEdit, id+" deploy at 6"); !resp.Success {
+		t.Fatalf("EDIT = %+v", resp)
+	}
+	if event := bob.readEvent(protocol.EventEdit); event.Data != "deploy at 6" || formatID(event.ID) != id {
+		t.Errorf("Edit event = %+v", event)
+	}
+
+	// Reactions are counted per emoji, once per user
+	bob.call(protocol.CmdReact, id+" 👍")
+	if resp := alice.call(protocol.CmdReact, id+" 👍"); resp.Data != "2" {
+		t.Errorf("REACT = %+v, want a count of 2", resp)
+	}
+	if event := bob.readEvent(protocol.EventReact); event.From != "alice" || event.Data != "👍" || formatID(event.ID) != id {
+		t.Errorf("React event = %+v", event)
+	}
+	alice.call(protocol.CmdReact, id+" 🎉")
+	if resp := bob.call(protocol.CmdReact, id+" 👍"); resp.Success {
+		t.Errorf("Reacting twice = %+v", resp)
+	}
+	history := bob.call(protocol.CmdListMessages, "").Data
+	if !strings.Contains(history, "alice: deploy at 6 (edited) [👍 2, 🎉 1]") {
+		t.Errorf("History after edit and reactions:\n%s", history)
+	}
+
+	alice.call(protocol.CmdUnreact, id+" 🎉")
+	if resp := alice.call(protocol.CmdUnreact, id+" 🎉"); resp.Code != protocol.CodeNotFound {
+		t.Errorf("Removing a missing reaction = %+v", resp)
+	}
+	if history := bob.call(protocol.CmdListMessages, "").Data; !strings.Contains(history, "[👍 2]") {
+		t.Errorf("History after unreact:\n%s", history)
+	}
+
+	// Room messages are invisible outside the room
+	alice.call(protocol.CmdJoinRoom, "ops")
+	roomID := alice.call(protocol.CmdMessage, "secret plan").Data
+	if resp := bob.call(protocol.CmdReact, roomID+" 👀"); resp.Code != protocol.CodeNotFound {
+		t.Errorf("Reacting to a room message from outside = %+v", resp)
+	}
+
+	// Admins may delete anyone's message
+	if resp := bob.call(protocol.CmdDelete, id); resp.Code != protocol.CodeForbidden {
+		t.Errorf("bob deleting alice's message = %+v", resp)
+	}
+	bob.call(protocol.CmdOper, "root hunter2")
+	if resp := bob.call(protocol.CmdDelete, id); !resp.Success {
+		t.Fatalf("Admin DELETE = %+v", resp)
+	}
+	if resp := bob.call(protocol.CmdDelete, id); resp.Code != protocol.CodeNotFound {
+		t.Errorf("Deleting twice = %+v", resp)
+	}
+	if history := bob.call(protocol.CmdListMessages, "").Data; !strings.Contains(history, "alice: [deleted]") || strings.Contains(history, "deploy") {
+		t.Errorf("History after delete:\n%s", history)
+	}
+
+	if resp := alice.call(protocol.CmdEdit, "x hi"); resp.Code != protocol.CodeValidation {
+		t.Errorf("EDIT with a bad ID = %+v", resp)
+	}
+}
+
+// formatID formats a message ID like the MESSAGE reply
+func formatID(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"tcp_server/metrics"
+	"tcp_server/protocol"
+	"time"
+)
+
+// serverMetrics holds the instruments updated while serving clients
+type serverMetrics struct {
+	registry *metrics.Registry
+	accepted *metrics.Counter      // Connections accepted
+	rejected *metrics.CounterVec   // Connections refused, by reason
+	commands *metrics.CounterVec   // Commands dispatched, by command
+	latency  *metrics.HistogramVec // Command handling time, by command
+	bytesIn  *metrics.Counter      // Bytes read from clients
+	bytesOut *metrics.Counter      // Bytes written to clients
+	fanout   *metrics.Histogram    // Recipients per broadcast
+	dropped  *metrics.Counter      // Events dropped because a send queue was full
+	errors   *metrics.CounterVec   // Error responses, by code
+	panics   *metrics.Counter      // Recovered panics
+
+	heartbeatTimeouts *metrics.Counter // Connections closed for missing heartbeats
+	storeDropped      *metrics.Counter // Message versions never written because the store queue was full or closed
+}
+
+// fanoutBuckets are upper bounds for the number of recipients per broadcast
+var fanoutBuckets = []float64{0, 1, 2, 5, 10, 25, 50, 100, 250, 500, 1000}
+
+// newServerMetrics registers the server's metrics, including gauges read at scrape time
+func newServerMetrics(s *Server) *serverMetrics {
+	r := metrics.NewRegistry()
+
+	r.NewGaugeFunc("chat_connected_clients", "Number of currently connected clients.", func() float64 {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return float64(len(s.clients))
+	})
+	r.NewGaugeFunc("chat_send_queue_depth", "Frames waiting in client send queues.", func() float64 {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		depth := 0
+		for _, client := range s.clients {
+			depth += len(client.out)
+		}
+		return float64(depth)
+	})
+
+	return &serverMetrics{
+		registry: r,
+		accepted: r.NewCounter("chat_connections_accepted_total", "Connections accepted."),
+		rejected: r.NewCounterVec("chat_connections_rejected_total", "Connections refused, by reason.", "reason"),
+		commands: r.NewCounterVec("chat_commands_total", "Commands dispatched, by command.", "command"),
+		latency: r.NewHistogramVec("chat_command_duration_seconds", "Time spent handling commands, by command.",
+			metrics.DefBuckets, "command"),
+		bytesIn:  r.NewCounter("chat_received_bytes_total", "Bytes read from clients."),
+		bytesOut: r.NewCounter("chat_sent_bytes_total", "Bytes written to clients."),
+		fanout:   r.NewHistogram("chat_broadcast_fanout", "Recipients per broadcast.", fanoutBuckets),
+		dropped:  r.NewCounter("chat_send_queue_dropped_total", "Events dropped because a client's send queue was full."),
+		errors:   r.NewCounterVec("chat_errors_total", "Error responses sent, by code.", "code"),
+		panics:   r.NewCounter("chat_panics_total", "Panics recovered while handling clients."),
+
+		heartbeatTimeouts: r.NewCounter("chat_heartbeat_timeouts_total", "Connections closed after missing heartbeats."),
+		storeDropped:      r.NewCounter("chat_store_dropped_total", "Message changes dropped because the store queue was full or closed."),
+	}
+}
+
+// CommandMetrics returns middleware that counts commands and records their latency
+func (s *Server) CommandMetrics() Middleware {
+	return func(next Handler) Handler {
+		return func(client *Client, msg *protocol.Message) *protocol.Response {
+			s.metrics.commands.WithLabelValues(msg.Command).Inc()
+			started := time.Now()
+			response := next(client, msg)
+			s.metrics.latency.WithLabelValues(msg.Command).Observe(time.Since(started).Seconds())
+			return response
+		}
+	}
+}
+
+// Metrics returns the server's metrics registry
+// It implements http.Handler, so it can be mounted directly at /metrics
+func (s *Server) Metrics() *metrics.Registry {
+	return s.metrics.registry
+}
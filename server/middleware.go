@@ -0,0 +1,109 @@
+package server
+
+import (
+	"fmt"
+	"tcp_server/protocol"
+	"time"
+)
+
+// Middleware wraps a Handler to add cross-cutting behavior
+// (logging, auth checks, rate limiting, metrics, panic recovery, tracing)
+type Middleware func(next Handler) Handler
+
+// Chain composes middleware into one; the first middleware is the outermost
+func Chain(middleware ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			next = middleware[i](next)
+		}
+		return next
+	}
+}
+
+// Use appends middleware to the chain wrapped around command dispatch
+// Call Use before Start; middleware runs in the order it was added
+// Logging, CommandMetrics and Recovery are always installed and run first,
+// so they also cover listener policy and middleware added here
+func (s *Server) Use(middleware ...Middleware) {
+	s.mwMu.Lock()
+	defer s.mwMu.Unlock()
+
+	s.middleware = append(s.middleware, middleware...)
+	s.handler = Chain(s.middleware...)(s.processCommand)
+}
+
+// dispatch runs a command through the middleware chain
+func (s *Server) dispatch(client *Client, msg *protocol.Message) *protocol.Response {
+	s.mwMu.RLock()
+	handler := s.handler
+	s.mwMu.RUnlock()
+
+	// The listener's own policy runs before the server-wide middleware
+	if client.listener != nil && client.listener.middleware != nil {
+		handler = client.listener.middleware(handler)
+	}
+	return s.builtin(handler)(client, msg)
+}
+
+// rateLimitKey is the client value key for a rate limiter's token bucket
+// Each RateLimit gets its own key so server-wide and listener limits keep separate buckets
+type rateLimitKey struct{ _ byte }
+
+// tokenBucket tracks how many commands a client may still send
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimit allows each client `rate` commands per second with bursts of up to `burst`
+// Commands over the limit are rejected without reaching the handler
+func RateLimit(rate float64, burst int) Middleware {
+	key := new(rateLimitKey)
+	return func(next Handler) Handler {
+		return func(client *Client, msg *protocol.Message) *protocol.Response {
+			now := time.Now()
+
+			client.mu.Lock()
+			bucket, _ := client.values[key].(*tokenBucket)
+			if bucket == nil {
+				bucket = &tokenBucket{tokens: float64(burst), last: now}
+				client.setValueLocked(key, bucket)
+			}
+
+			// Refill tokens for the time elapsed since the last command
+			bucket.tokens += now.Sub(bucket.last).Seconds() * rate
+			if bucket.tokens > float64(burst) {
+				bucket.tokens = float64(burst)
+			}
+			bucket.last = now
+
+			allowed := bucket.tokens >= 1
+			if allowed {
+				bucket.tokens--
+			}
+			client.mu.Unlock()
+
+			if !allowed {
+				return protocol.NewErrorResponse(protocol.CodeRateLimited, fmt.Sprintf("Rate limit exceeded for %s", msg.Command))
+			}
+			return next(client, msg)
+		}
+	}
+}
+
+// RequireRegistration rejects every command except REGISTER, RESUME and QUIT
+// until the client has registered
+func RequireRegistration() Middleware {
+	return func(next Handler) Handler {
+		return func(client *Client, msg *protocol.Message) *protocol.Response {
+			switch msg.Command {
+			case protocol.CmdRegister, protocol.CmdResume, protocol.CmdQuit:
+			default:
+				if !client.IsRegistered() {
+					return protocol.NewErrorResponse(protocol.CodeAuthRequired, fmt.Sprintf("Register before using %s on this listener", msg.Command))
+				}
+			}
+			return next(client, msg)
+		}
+	}
+}
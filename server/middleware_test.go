@@ -0,0 +1,94 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"tcp_server/protocol"
+	"testing"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(client *Client, msg *protocol.Message) *protocol.Response {
+				order = append(order, name)
+				return next(client, msg)
+			}
+		}
+	}
+
+	final := func(client *Client, msg *protocol.Message) *protocol.Response {
+		order = append(order, "handler")
+		return protocol.NewResponse(true, "ok", "")
+	}
+
+	handler := Chain(trace("first"), trace("second"))(final)
+	handler(&Client{}, &protocol.Message{Command: protocol.CmdTime})
+
+	want := []string{"first", "second", "handler"}
+	if len(order) != len(want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Errorf("order[%d] = %s, want %s", i, order[i], want[i])
+		}
+	}
+}
+
+func TestServerUse(t *testing.T) {
+	s := NewServer(":0", WithLogger(slog.New(slog.DiscardHandler)))
+	s.Use(func(next Handler) Handler {
+		return func(client *Client, msg *protocol.Message) *protocol.Response {
+			if msg.Command == protocol.CmdTime {
+				return protocol.NewResponse(false, "blocked", "")
+			}
+			return next(client, msg)
+		}
+	})
+
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+	client := &Client{conn: conn, username: "anonymous"}
+
+	if resp := s.dispatch(client, &protocol.Message{Command: protocol.CmdTime}); resp.Success {
+		t.Error("Expected middleware to block TIME")
+	}
+
+	resp := s.dispatch(client, &protocol.Message{Command: protocol.CmdEcho, Data: "hi"})
+	if !resp.Success || resp.Data != "hi" {
+		t.Errorf("Expected ECHO to reach handler, got %s", resp.String())
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	calls := 0
+	handler := RateLimit(0.001, 2)(func(client *Client, msg *protocol.Message) *protocol.Response {
+		calls++
+		return protocol.NewResponse(true, "ok", "")
+	})
+
+	client := &Client{}
+	msg := &protocol.Message{Command: protocol.CmdTime}
+
+	for i := 0; i < 2; i++ {
+		if resp := handler(client, msg); !resp.Success {
+			t.Fatalf("Command %d rejected within burst", i+1)
+		}
+	}
+
+	if resp := handler(client, msg); resp.Success {
+		t.Error("Expected command over the burst to be rejected")
+	}
+
+	// Limits are tracked per client
+	if resp := handler(&Client{}, msg); !resp.Success {
+		t.Error("Expected a different client to have its own budget")
+	}
+
+	if calls != 3 {
+		t.Errorf("handler called %d times, want 3", calls)
+	}
+}
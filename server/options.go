@@ -0,0 +1,128 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// Option configures optional server behavior
+type Option func(*Server)
+
+// WithLogger sets the structured logger used for server events (default slog.Default())
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithRedaction keeps message bodies out of the logs
+// Only the size of each command's data is logged, which is what production should use
+func WithRedaction(redact bool) Option {
+	return func(s *Server) {
+		s.redact = redact
+	}
+}
+
+// WithDisconnectOnPanic closes a client's connection after its command panics
+// By default the client gets an INTERNAL_ERROR response and stays connected
+func WithDisconnectOnPanic(disconnect bool) Option {
+	return func(s *Server) {
+		s.disconnectOnPanic = disconnect
+	}
+}
+
+// WithOperators sets the operator credentials (name → password) accepted by OPER
+// Authenticated operators get the admin role for the rest of their connection
+func WithOperators(operators map[string]string) Option {
+	return func(s *Server) {
+		s.SetOperators(operators)
+	}
+}
+
+// WithBotTokens sets the bearer tokens (token → bot name) accepted by the HTTP API
+func WithBotTokens(tokens map[string]string) Option {
+	return func(s *Server) {
+		s.SetBotTokens(tokens)
+	}
+}
+
+// WithMessageStore saves messages to store in the background and rebuilds the history,
+// threads and search index from it when the server starts
+func WithMessageStore(store MessageStore) Option {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// WithReloadFunc sets the function run by the control channel's RELOAD command
+func WithReloadFunc(reload func() error) Option {
+	return func(s *Server) {
+		s.reload = reload
+	}
+}
+
+// WithIdleTimeout marks registered users away after d without a command (0 = never)
+// They come back online automatically with their next command
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = d
+	}
+}
+
+// WithResumeWindow lets a dropped registered session be resumed within d (0 = disabled)
+// REGISTER then returns a resume token; RESUME restores the session and replays missed events
+func WithResumeWindow(d time.Duration) Option {
+	return func(s *Server) {
+		s.resumeWindow = d
+	}
+}
+
+// WithHeartbeat pings every client each interval and closes connections that
+// stay silent for missed pings in a row (interval 0 = disabled)
+func WithHeartbeat(interval time.Duration, missed int) Option {
+	return func(s *Server) {
+		s.heartbeat = interval
+		s.heartbeatMissed = max(missed, 1)
+	}
+}
+
+// WithKeepAlive sets TCP keepalive on accepted connections (Enable false turns it off)
+// Zero Idle, Interval or Count keep the OS defaults for that setting
+func WithKeepAlive(cfg net.KeepAliveConfig) Option {
+	return func(s *Server) {
+		s.socketOptions.KeepAlive = &cfg
+	}
+}
+
+// WithNoDelay sets TCP_NODELAY on accepted connections (false enables Nagle's algorithm)
+func WithNoDelay(noDelay bool) Option {
+	return func(s *Server) {
+		s.socketOptions.NoDelay = &noDelay
+	}
+}
+
+// WithSocketBuffers sets the receive and send buffer sizes in bytes (0 = OS default)
+func WithSocketBuffers(readBuffer, writeBuffer int) Option {
+	return func(s *Server) {
+		s.socketOptions.ReadBuffer = readBuffer
+		s.socketOptions.WriteBuffer = writeBuffer
+	}
+}
+
+// WithLinger sets SO_LINGER on accepted connections (0 discards unsent data on close)
+func WithLinger(d time.Duration) Option {
+	return func(s *Server) {
+		s.socketOptions.Linger = &d
+	}
+}
+
+// WithProxyProtocol expects a PROXY v1/v2 header on connections to the main address
+// from the trusted ranges, so clients behind a load balancer keep their real address
+// Connections from other sources are served as-is
+func WithProxyProtocol(trusted ...netip.Prefix) Option {
+	return func(s *Server) {
+		s.trustedProxies = trusted
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"net"
+	"tcp_server/protocol"
+	"time"
+)
+
+const (
+	sendQueueSize = 64               // Frames that may wait for a slow client before events are dropped
+	writeTimeout  = 10 * time.Second // Maximum time a single write may block
+)
+
+// newClient creates the server-side state for a connection accepted on l
+func newClient(conn net.Conn, l *listener) *Client {
+	return &Client{
+		conn:        conn,
+		listener:    l,
+		codec:       l.codec,
+		username:    "anonymous",
+		connectedAt: time.Now(),
+		lastActive:  time.Now(),
+		sessionID:   newSessionID(),
+		out:         make(chan []byte, sendQueueSize+replaySize), // Room for a whole RESUME replay
+		done:        make(chan struct{}),
+		writerDone:  make(chan struct{}),
+	}
+}
+
+// enqueue queues an encoded frame for the client's writer goroutine
+// With wait it blocks until there is room; otherwise a full queue drops the frame
+func (c *Client) enqueue(frame []byte, wait bool) bool {
+	if wait {
+		select {
+		case c.out <- frame:
+			return true
+		case <-c.done:
+			return false
+		}
+	}
+
+	// Frames beyond sendQueueSize are dropped; the rest of the queue is kept for replays
+	if len(c.out) >= sendQueueSize {
+		return false
+	}
+	return c.enqueueReplay(frame)
+}
+
+// enqueueReplay queues a replayed event without blocking
+// The queue has room for a full replay, so it only fails if the client is closed or stalled
+func (c *Client) enqueueReplay(frame []byte) bool {
+	select {
+	case c.out <- frame:
+		return true
+	case <-c.done:
+		return false
+	default:
+		return false
+	}
+}
+
+// closeOutbox stops the writer goroutine after it flushes queued frames
+func (c *Client) closeOutbox() {
+	c.closeOnce.Do(func() { close(c.done) })
+	<-c.writerDone
+}
+
+// writeLoop writes queued frames to the connection until the client is closed
+// A single writer per connection keeps responses and broadcasts from interleaving
+func (s *Server) writeLoop(client *Client) {
+	defer close(client.writerDone)
+
+	for {
+		select {
+		case frame := <-client.out:
+			s.writeFrame(client, frame)
+		case <-client.done:
+			// Flush whatever is still queued (e.g., the reply to QUIT)
+			for {
+				select {
+				case frame := <-client.out:
+					s.writeFrame(client, frame)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeFrame writes a single frame with a deadline so a stuck peer cannot block forever
+func (s *Server) writeFrame(client *Client, frame []byte) {
+	client.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	n, err := client.conn.Write(frame)
+	s.metrics.bytesOut.Add(uint64(n))
+	if err != nil {
+		s.clientLogger(client).Warn("write failed", "error", err)
+		// Closing the connection unblocks the reader so the client is cleaned up
+		client.conn.Close()
+	}
+}
+
+// sendEvent queues a server-initiated frame without blocking
+// It returns false if the client's queue is full and the event was dropped
+func (s *Server) sendEvent(client *Client, frame []byte) bool {
+	if client.enqueue(frame, false) {
+		return true
+	}
+	s.metrics.dropped.Inc()
+	return false
+}
+
+// broadcast sends an event to every connected client except the sender
+// It returns the number of clients the event was queued for
+func (s *Server) broadcast(event *protocol.Response, except *Client) int {
+	return s.deliver(event, func(c *Client) bool { return c != except })
+}
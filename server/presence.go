@@ -0,0 +1,190 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"tcp_server/protocol"
+	"time"
+)
+
+// Presence states a user can be in
+const (
+	StatusOnline = "online" // Active (the default)
+	StatusAway   = "away"   // Away, set by the user or after inactivity
+	StatusBusy   = "busy"   // Do not disturb
+	StatusCustom = "custom" // Free-form status text only
+)
+
+// Presence describes a user's status as shown to others
+type Presence struct {
+	Username string        // Who the presence belongs to
+	Status   string        // One of the Status* constants
+	Text     string        // Optional status text (e.g., "lunch")
+	Idle     time.Duration // Time since the user's last command in any session
+	Sessions int           // Number of connected sessions
+}
+
+// String formats the presence for LIST_USERS
+func (p Presence) String() string {
+	status := p.Status
+	if p.Text != "" {
+		status = fmt.Sprintf("%s (%s)", status, p.Text)
+	}
+	line := fmt.Sprintf("%s - %s, idle %s", p.Username, status, p.Idle.Round(time.Second))
+	if p.Sessions > 1 {
+		line += fmt.Sprintf(", %d sessions", p.Sessions)
+	}
+	return line
+}
+
+// parseStatus parses STATUS data: "online", "away [text]", "busy [text]" or any custom text
+func parseStatus(data string) (status, text string) {
+	word, rest := splitArgs(data)
+	switch strings.ToLower(word) {
+	case StatusOnline, StatusAway, StatusBusy:
+		return strings.ToLower(word), rest
+	default:
+		return StatusCustom, strings.TrimSpace(data)
+	}
+}
+
+// Presence returns the user's current presence (Sessions is filled in by the server)
+func (u *User) Presence() Presence {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return Presence{
+		Username: u.name,
+		Status:   u.status,
+		Text:     u.statusText,
+		Idle:     time.Since(u.lastActive),
+	}
+}
+
+// handleStatus sets the user's presence status and tells everyone
+func (s *Server) handleStatus(client *Client, msg *protocol.Message) *protocol.Response {
+	status, text := parseStatus(msg.Data)
+
+	u := client.User()
+	u.mu.Lock()
+	u.status = status
+	u.statusText = text
+	u.autoAway = false
+	u.mu.Unlock()
+
+	s.announceStatus(u, client)
+	return protocol.NewResponse(true, fmt.Sprintf("Status set to %s", status), "")
+}
+
+// listUsersWithStatus lists each user once with their status and idle time
+func (s *Server) listUsersWithStatus() string {
+	s.mu.RLock()
+	presences := make([]Presence, 0, len(s.users))
+	for _, u := range s.users {
+		p := u.Presence()
+		p.Sessions = len(u.sessions)
+		presences = append(presences, p)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(presences, func(i, j int) bool { return presences[i].Username < presences[j].Username })
+
+	lines := make([]string, len(presences))
+	for i, p := range presences {
+		lines[i] = p.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markActive records activity and brings an automatically-away user back online
+func (s *Server) markActive(client *Client) {
+	now := time.Now()
+
+	client.mu.Lock()
+	client.lastActive = now
+	u := client.user
+	client.mu.Unlock()
+
+	if u == nil {
+		return
+	}
+
+	u.mu.Lock()
+	u.lastActive = now
+	returned := u.autoAway
+	if returned {
+		u.autoAway = false
+		u.status = StatusOnline
+		u.statusText = ""
+	}
+	u.mu.Unlock()
+
+	if returned {
+		s.announceStatus(u, client)
+	}
+}
+
+// idleLoop marks users away after idleTimeout without a command in any session
+func (s *Server) idleLoop() {
+	// Check twice per timeout, but never so often that a tiny timeout spins the loop
+	interval := min(max(s.idleTimeout/2, 10*time.Millisecond), 30*time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+			s.mu.RLock()
+			users := make([]*User, 0, len(s.users))
+			for _, u := range s.users {
+				users = append(users, u)
+			}
+			s.mu.RUnlock()
+
+			for _, u := range users {
+				u.mu.Lock()
+				idle := u.status == StatusOnline && time.Since(u.lastActive) >= s.idleTimeout
+				if idle {
+					u.status = StatusAway
+					u.statusText = "idle"
+					u.autoAway = true
+				}
+				u.mu.Unlock()
+
+				if idle {
+					s.announceStatus(u, nil)
+				}
+			}
+		}
+	}
+}
+
+// announceJoin tells everyone else that a user's first session registered
+func (s *Server) announceJoin(name string, except *Client) {
+	s.broadcast(protocol.NewEvent(protocol.EventJoin, name, fmt.Sprintf("→ %s joined", name), ""), except)
+}
+
+// announceLeave tells everyone that a user's last session disconnected
+func (s *Server) announceLeave(name string, except *Client) {
+	s.broadcast(protocol.NewEvent(protocol.EventLeave, name, fmt.Sprintf("← %s left", name), ""), except)
+}
+
+// announceRename tells everyone that a user changed their name
+func (s *Server) announceRename(oldName, name string, except *Client) {
+	s.broadcast(protocol.NewEvent(protocol.EventRename, name,
+		fmt.Sprintf("%s is now known as %s", oldName, name), oldName), except)
+}
+
+// announceStatus tells everyone (except the session that made the change) about a user's status
+func (s *Server) announceStatus(u *User, except *Client) {
+	p := u.Presence()
+	data := p.Status
+	if p.Text != "" {
+		data += " " + p.Text
+	}
+	s.broadcast(protocol.NewEvent(protocol.EventStatus, p.Username,
+		fmt.Sprintf("%s is %s", p.Username, data), data), except)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+	"time"
+)
+
+func TestPresenceEvents(t *testing.T) {
+	s := startTestServer(t)
+	alice := dialTestServer(t, s)
+	alice.call(protocol.CmdRegister, "alice")
+
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+	if event := alice.readEvent(protocol.EventJoin); event.From != "bob" {
+		t.Errorf("Expected join from bob, got %+v", event)
+	}
+
+	bob.call(protocol.CmdStatus, "away lunch")
+	if event := alice.readEvent(protocol.EventStatus); event.From != "bob" || event.Data != "away lunch" {
+		t.Errorf("Unexpected status event: %+v", event)
+	}
+
+	resp := alice.call(protocol.CmdListUsers, protocol.ListUsersWithStatus)
+	if !strings.Contains(resp.Data, "bob - away (lunch), idle") {
+		t.Errorf("LIST_USERS status missing bob's status:\n%s", resp.Data)
+	}
+
+	bob.call(protocol.CmdRegister, "robert")
+	if event := alice.readEvent(protocol.EventRename); event.From != "robert" || event.Data != "bob" {
+		t.Errorf("Unexpected rename event: %+v", event)
+	}
+
+	bob.call(protocol.CmdQuit, "")
+	if event := alice.readEvent(protocol.EventLeave); event.From != "robert" {
+		t.Errorf("Expected leave from robert, got %+v", event)
+	}
+}
+
+func TestIdleAway(t *testing.T) {
+	s := startTestServer(t, WithIdleTimeout(50*time.Millisecond))
+	go s.idleLoop()
+
+	alice := dialTestServer(t, s)
+	alice.call(protocol.CmdRegister, "alice")
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+
+	// Both go idle; alice hears about bob (and herself)
+	if event := readStatusOf(alice, "bob"); event.Data != "away idle" {
+		t.Fatalf("Expected bob to go away, got %+v", event)
+	}
+
+	// Any command brings bob back online
+	bob.call(protocol.CmdTime, "")
+	if event := readStatusOf(alice, "bob"); event.Data != StatusOnline {
+		t.Errorf("Expected bob back online, got %+v", event)
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		data       string
+		wantStatus string
+		wantText   string
+	}{
+		{data: "online", wantStatus: StatusOnline},
+		{data: "Away brb", wantStatus: StatusAway, wantText: "brb"},
+		{data: "busy in a meeting", wantStatus: StatusBusy, wantText: "in a meeting"},
+		{data: "On vacation", wantStatus: StatusCustom, wantText: "On vacation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			status, text := parseStatus(tt.data)
+			if status != tt.wantStatus || text != tt.wantText {
+				t.Errorf("parseStatus(%q) = %q, %q; want %q, %q", tt.data, status, text, tt.wantStatus, tt.wantText)
+			}
+		})
+	}
+}
+
+// readStatusOf returns the next status event about username
+func readStatusOf(tc *testConn, username string) *protocol.Response {
+	for {
+		if event := tc.readEvent(protocol.EventStatus); event.From == username {
+			return event
+		}
+	}
+}
+
+func TestTinyIdleTimeout(t *testing.T) {
+	// A timeout below 2ns used to give the ticker a zero interval and panic
+	s := startTestServer(t, WithIdleTimeout(time.Nanosecond))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.idleLoop()
+	}()
+	s.Shutdown()
+	<-done
+}
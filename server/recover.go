@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"runtime/debug"
+	"tcp_server/protocol"
+)
+
+// Recovery returns middleware that converts a handler panic into an INTERNAL_ERROR response
+// The panic is logged and counted, and the client is flagged so the connection can be dropped
+func (s *Server) Recovery() Middleware {
+	return func(next Handler) Handler {
+		return func(client *Client, msg *protocol.Message) (response *protocol.Response) {
+			defer func() {
+				if r := recover(); r != nil {
+					s.recordPanic(client, msg.Command, r)
+					client.panicked.Store(true)
+					response = protocol.NewErrorResponse(protocol.CodeInternal, "Internal server error")
+				}
+			}()
+			return next(client, msg)
+		}
+	}
+}
+
+// safeDispatch runs a command through the middleware chain, Recovery included
+// panicked reports whether the handler panicked so the caller can drop the connection
+func (s *Server) safeDispatch(client *Client, msg *protocol.Message) (response *protocol.Response, panicked bool) {
+	response = s.dispatch(client, msg)
+	return response, client.panicked.Swap(false)
+}
+
+// recordPanic logs a recovered panic with its connection context and counts it
+func (s *Server) recordPanic(client *Client, command string, r any) {
+	s.metrics.panics.Inc()
+	s.clientLogger(client).Error("recovered from panic",
+		"command", command, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+}
+
+// PanicCount returns how many panics the server has recovered from
+func (s *Server) PanicCount() uint64 {
+	return s.metrics.panics.Value()
+}
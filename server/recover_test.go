@@ -0,0 +1,66 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"tcp_server/protocol"
+	"testing"
+)
+
+func TestSafeDispatchRecoversPanic(t *testing.T) {
+	s := NewServer(":0", WithLogger(slog.New(slog.DiscardHandler)))
+	err := s.Handle(CommandHandler{
+		Name: "BOOM",
+		Handler: func(client *Client, msg *protocol.Message) *protocol.Response {
+			panic("handler exploded")
+		},
+	})
+	if err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+	client := &Client{conn: conn, username: "alice"}
+
+	resp, panicked := s.safeDispatch(client, &protocol.Message{Command: "BOOM"})
+	if !panicked {
+		t.Fatal("Expected panic to be reported")
+	}
+	if resp.Success || resp.Code != protocol.CodeInternal {
+		t.Errorf("Expected INTERNAL_ERROR response, got %s (code %s)", resp.String(), resp.Code)
+	}
+	if got := s.PanicCount(); got != 1 {
+		t.Errorf("PanicCount() = %d, want 1", got)
+	}
+
+	// The server keeps serving other commands after the panic
+	resp, panicked = s.safeDispatch(client, &protocol.Message{Command: protocol.CmdEcho, Data: "still here"})
+	if panicked || resp.Data != "still here" {
+		t.Errorf("Expected ECHO to succeed after panic, got %s", resp.String())
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	s := NewServer(":0", WithLogger(slog.New(slog.DiscardHandler)))
+	handler := Chain(s.CommandMetrics(), s.Recovery())(func(client *Client, msg *protocol.Message) *protocol.Response {
+		panic("handler exploded")
+	})
+
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+	client := &Client{conn: conn, username: "alice"}
+
+	resp := handler(client, &protocol.Message{Command: "BOOM"})
+	if resp.Code != protocol.CodeInternal {
+		t.Errorf("Expected INTERNAL_ERROR response, got %s (code %s)", resp.String(), resp.Code)
+	}
+	if !client.panicked.Load() {
+		t.Error("Expected the client to be flagged after the panic")
+	}
+	if got := s.metrics.commands.WithLabelValues("BOOM").Value(); got != 1 {
+		t.Errorf("commands[BOOM] = %d, want 1", got)
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tcp_server/protocol"
+)
+
+// Handler processes a single command from a client and returns the response
+type Handler func(client *Client, msg *protocol.Message) *protocol.Response
+
+// CommandHandler declares a command and how the server handles it
+type CommandHandler struct {
+	Name         string  // Command name as sent on the wire (e.g., "ECHO")
+	RequiresData bool    // Reject the command if Data is empty
+	RequiresAuth bool    // Only registered clients may use the command
+	RequiresRole Role    // Only clients with this role may use the command (empty = anyone)
+	Handler      Handler // Function that processes the command
+}
+
+// Registry maps command names to their handlers
+// It implements protocol.CommandSet so message validation uses the same table
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]CommandHandler
+}
+
+// NewRegistry creates an empty command registry
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: make(map[string]CommandHandler),
+	}
+}
+
+// Register adds a command handler to the registry
+func (r *Registry) Register(h CommandHandler) error {
+	if h.Name == "" {
+		return fmt.Errorf("command name cannot be empty")
+	}
+	if h.Handler == nil {
+		return fmt.Errorf("command %s has no handler", h.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.handlers[h.Name]; exists {
+		return fmt.Errorf("command %s is already registered", h.Name)
+	}
+	r.handlers[h.Name] = h
+	return nil
+}
+
+// Get returns the handler registered for a command
+func (r *Registry) Get(name string) (CommandHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.handlers[name]
+	return h, ok
+}
+
+// Lookup returns the protocol spec for a command (implements protocol.CommandSet)
+func (r *Registry) Lookup(name string) (protocol.CommandSpec, bool) {
+	h, ok := r.Get(name)
+	if !ok {
+		return protocol.CommandSpec{}, false
+	}
+	return protocol.CommandSpec{Name: h.Name, RequiresData: h.RequiresData}, true
+}
+
+// Names returns the registered command names in sorted order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
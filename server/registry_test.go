@@ -0,0 +1,69 @@
+package server
+
+import (
+	"log/slog"
+	"tcp_server/protocol"
+	"testing"
+)
+
+func TestRegistryRegister(t *testing.T) {
+	r := NewRegistry()
+	echo := func(client *Client, msg *protocol.Message) *protocol.Response {
+		return protocol.NewResponse(true, "ok", msg.Data)
+	}
+
+	if err := r.Register(CommandHandler{Name: "PRIVATE", RequiresData: true, Handler: echo}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		handler CommandHandler
+	}{
+		{name: "Duplicate name", handler: CommandHandler{Name: "PRIVATE", Handler: echo}},
+		{name: "Empty name", handler: CommandHandler{Handler: echo}},
+		{name: "Nil handler", handler: CommandHandler{Name: "NOOP"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.Register(tt.handler); err == nil {
+				t.Error("Register() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestRegistryValidation(t *testing.T) {
+	s := NewServer(":0", WithLogger(slog.New(slog.DiscardHandler)))
+	err := s.Handle(CommandHandler{
+		Name:         "PRIVATE",
+		RequiresData: true,
+		Handler: func(client *Client, msg *protocol.Message) *protocol.Response {
+			return protocol.NewResponse(true, "private", msg.Data)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		msg     protocol.Message
+		wantErr bool
+	}{
+		{name: "Built-in command", msg: protocol.Message{Command: protocol.CmdTime}},
+		{name: "Private command", msg: protocol.Message{Command: "PRIVATE", Data: "x"}},
+		{name: "Private command without data", msg: protocol.Message{Command: "PRIVATE"}, wantErr: true},
+		{name: "Unknown command", msg: protocol.Message{Command: "OTHER"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.msg.ValidateWith(s.commands)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateWith() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
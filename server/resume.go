@@ -0,0 +1,188 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"tcp_server/protocol"
+	"time"
+)
+
+// replaySize is how many recent events each session keeps for RESUME
+const replaySize = 256
+
+// replayEvent is a delivered event with its sequence number
+// It is encoded on replay, since the resuming connection may use another codec
+type replayEvent struct {
+	seq   uint64
+	event *protocol.Response
+}
+
+// newResumeToken returns a random secret identifying a resumable session
+func newResumeToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recordEvent remembers a delivered event so it can be replayed after a reconnect
+func (c *Client) recordEvent(event *protocol.Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.replay) == replaySize {
+		c.replayLost = c.replay[0].seq
+		c.replay = append(c.replay[:0], c.replay[1:]...)
+	}
+	c.replay = append(c.replay, replayEvent{seq: event.Seq, event: event})
+}
+
+// endSession marks a session that ended on purpose so it is not kept for RESUME
+func (c *Client) endSession() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ended = true
+}
+
+// parkLocked keeps a dropped registered session resumable for resumeWindow
+// The caller must hold s.mu; it returns false if the session cannot be resumed
+func (s *Server) parkLocked(client *Client) bool {
+	client.mu.Lock()
+	token, ended := client.resumeToken, client.ended
+	client.mu.Unlock()
+
+	if s.resumeWindow <= 0 || token == "" || ended {
+		return false
+	}
+
+	s.parked[token] = client
+	time.AfterFunc(s.resumeWindow, func() { s.expireSession(client) })
+	s.clientLogger(client).Info("session parked", "window", s.resumeWindow)
+	return true
+}
+
+// isParked reports whether a session is waiting to be resumed
+func (s *Server) isParked(client *Client) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client.mu.Lock()
+	token := client.resumeToken
+	client.mu.Unlock()
+	return token != "" && s.parked[token] == client
+}
+
+// expireSession forgets a parked session; the user leaves if it was their last session
+// It does nothing if the session is not parked (e.g., it was resumed in time)
+func (s *Server) expireSession(client *Client) {
+	client.mu.Lock()
+	token, u := client.resumeToken, client.user
+	client.mu.Unlock()
+
+	s.mu.Lock()
+	if token == "" || s.parked[token] != client {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.parked, token)
+	left := s.detachLocked(client, u)
+	s.mu.Unlock()
+
+	s.clientLogger(client).Info("parked session expired")
+	if left != nil {
+		s.announceLeave(left.name, nil)
+	}
+}
+
+// parkedSessions returns the parked sessions for which match is true
+func (s *Server) parkedSessions(match func(*Client) bool) []*Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []*Client
+	for _, c := range s.parked {
+		if match(c) {
+			sessions = append(sessions, c)
+		}
+	}
+	return sessions
+}
+
+// handleResume lets a fresh connection take over a dropped session: "token lastSeq"
+// Events after lastSeq are replayed before the reply
+func (s *Server) handleResume(client *Client, msg *protocol.Message) *protocol.Response {
+	token, seqText := splitArgs(msg.Data)
+	var lastSeq uint64
+	if seqText != "" {
+		n, err := strconv.ParseUint(strings.TrimSpace(seqText), 10, 64)
+		if err != nil {
+			return protocol.NewErrorResponse(protocol.CodeValidation, "Usage: RESUME token [lastSeq]")
+		}
+		lastSeq = n
+	}
+	if client.IsRegistered() {
+		return protocol.NewErrorResponse(protocol.CodeValidation, "Only a new connection can resume a session")
+	}
+
+	s.mu.Lock()
+	old, ok := s.parked[token]
+	if !ok {
+		s.mu.Unlock()
+		return protocol.NewErrorResponse(protocol.CodeNotFound, "Session expired or unknown")
+	}
+	if reason, banned := s.userBanReason(old.Username()); banned {
+		s.mu.Unlock()
+		s.expireSession(old) // The user was banned while away, so the session is gone for good
+		return protocol.NewErrorResponse(protocol.CodeForbidden, fmt.Sprintf("Username %s is banned: %s", old.Username(), reason))
+	}
+	delete(s.parked, token)
+
+	// The new connection takes the old session's place in its user
+	old.mu.Lock()
+	u, name, room, roles := old.user, old.username, old.room, old.roles
+	replay, replayLost := old.replay, old.replayLost
+	old.mu.Unlock()
+
+	delete(u.sessions, old)
+	u.sessions[client] = struct{}{}
+
+	newToken := newResumeToken()
+	client.mu.Lock()
+	client.user = u
+	client.username = name
+	client.registered = true
+	client.room = room
+	client.roles = roles
+	client.replay = replay
+	client.replayLost = replayLost
+	client.resumeToken = newToken
+	client.mu.Unlock()
+
+	// Replay while holding s.mu so no new event overtakes a missed one
+	// The queue never blocks here, so a peer that doesn't read can't stall other clients
+	replayed, dropped := 0, 0
+	for _, e := range replay {
+		if e.seq <= lastSeq {
+			continue
+		}
+		frame, err := client.codec.EncodeResponse(e.event)
+		if err == nil && client.enqueueReplay(frame) {
+			replayed++
+		} else {
+			dropped++
+		}
+	}
+	s.mu.Unlock()
+
+	s.clientLogger(client).Info("session resumed", "session", client.sessionID, "replayed", replayed, "dropped", dropped)
+
+	text := fmt.Sprintf("Resumed session as %s, replayed %d event(s)", name, replayed)
+	if lastSeq < replayLost || dropped > 0 {
+		text += " (older events were lost)"
+	}
+	response := protocol.NewResponse(true, text, newToken)
+	response.Key = u.key
+	return response
+}
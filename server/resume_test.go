@@ -0,0 +1,178 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+	"time"
+)
+
+func TestResumeSession(t *testing.T) {
+	s := startTestServer(t, WithResumeWindow(time.Minute))
+	alice := dialTestServer(t, s)
+	token := alice.call(protocol.CmdRegister, "alice").Data
+	if token == "" {
+		t.Fatal("Expected a resume token from REGISTER")
+	}
+	alice.call(protocol.CmdJoinRoom, "ops")
+
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+	bob.call(protocol.CmdJoinRoom, "ops")
+	bob.call(protocol.CmdMessage, "one")
+	acked := alice.readEvent(protocol.EventMessage).Seq
+
+	// Alice's connection drops; bob keeps talking and sees no leave
+	alice.conn.Close()
+	waitFor(t, func() bool { return s.isParkedUser("alice") })
+	bob.call(protocol.CmdMessage, "two")
+	bob.call(protocol.CmdMessage, "three")
+
+	resumed := dialTestServer(t, s)
+	resumed.send(protocol.CmdResume, fmt.Sprintf("%s %d", token, acked))
+	for _, want := range []string{"two", "three"} {
+		if event := resumed.readEvent(protocol.EventMessage); event.Data != want || event.Room != "ops" {
+			t.Errorf("Expected replayed %q in ops, got %+v", want, event)
+		}
+	}
+	resp := resumed.read()
+	if !resp.Success || !strings.Contains(resp.Message, "replayed 2 event(s)") || resp.Data == token {
+		t.Fatalf("Unexpected RESUME reply: %+v", resp)
+	}
+
+	// The session is alice again, still in ops
+	if resp := resumed.call(protocol.CmdMessage, "back"); !resp.Success {
+		t.Fatalf("MESSAGE after resume failed: %+v", resp)
+	}
+	if event := bob.readEvent(protocol.EventMessage); event.From != "alice" || event.Room != "ops" {
+		t.Errorf("Unexpected message after resume: %+v", event)
+	}
+
+	// A token works only once
+	if resp := dialTestServer(t, s).call(protocol.CmdResume, token); resp.Code != protocol.CodeNotFound {
+		t.Errorf("Expected NOT_FOUND for a used token, got %+v", resp)
+	}
+}
+
+func TestResumeWindowExpires(t *testing.T) {
+	s := startTestServer(t, WithResumeWindow(50*time.Millisecond))
+	alice := dialTestServer(t, s)
+	token := alice.call(protocol.CmdRegister, "alice").Data
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+
+	alice.conn.Close()
+	if event := bob.readEvent(protocol.EventLeave); event.From != "alice" {
+		t.Errorf("Expected alice to leave after the window, got %+v", event)
+	}
+	if resp := dialTestServer(t, s).call(protocol.CmdResume, token); resp.Code != protocol.CodeNotFound {
+		t.Errorf("Expected NOT_FOUND after the window, got %+v", resp)
+	}
+}
+
+func TestQuitIsNotResumable(t *testing.T) {
+	s := startTestServer(t, WithResumeWindow(time.Minute))
+	alice := dialTestServer(t, s)
+	token := alice.call(protocol.CmdRegister, "alice").Data
+	alice.call(protocol.CmdQuit, "")
+
+	waitFor(t, func() bool {
+		_, online := s.lookupUser("alice")
+		return !online
+	})
+	if resp := dialTestServer(t, s).call(protocol.CmdResume, token); resp.Code != protocol.CodeNotFound {
+		t.Errorf("Expected NOT_FOUND after QUIT, got %+v", resp)
+	}
+}
+
+func TestBannedSessionsCannotResume(t *testing.T) {
+	s := startTestServer(t, WithResumeWindow(time.Minute), WithOperators(map[string]string{"root": "secret"}))
+	admin := dialTestServer(t, s)
+	admin.call(protocol.CmdOper, "root secret")
+
+	// BAN and KICK also forget sessions waiting to be resumed
+	for _, command := range []string{protocol.CmdBan, protocol.CmdKick} {
+		mallory := dialTestServer(t, s)
+		token := mallory.call(protocol.CmdRegister, "mallory").Data
+		mallory.conn.Close()
+		waitFor(t, func() bool { return s.isParkedUser("mallory") })
+
+		if resp := admin.call(command, "mallory spamming"); !resp.Success {
+			t.Fatalf("%s of a parked session failed: %+v", command, resp)
+		}
+		if resp := dialTestServer(t, s).call(protocol.CmdResume, token); resp.Code != protocol.CodeNotFound {
+			t.Errorf("RESUME after %s = %+v, want NOT_FOUND", command, resp)
+		}
+		admin.call(protocol.CmdUnban, "mallory")
+	}
+
+	// A session parked before its user was banned is refused too
+	eve := dialTestServer(t, s)
+	token := eve.call(protocol.CmdRegister, "eve").Data
+	eve.conn.Close()
+	waitFor(t, func() bool { return s.isParkedUser("eve") })
+	s.moderation.mu.Lock()
+	s.moderation.bannedUsers["eve"] = "spamming"
+	s.moderation.mu.Unlock()
+	if resp := dialTestServer(t, s).call(protocol.CmdResume, token); resp.Code != protocol.CodeForbidden {
+		t.Errorf("RESUME of a banned user = %+v, want FORBIDDEN", resp)
+	}
+	if s.isParkedUser("eve") {
+		t.Error("Banned session is still parked")
+	}
+}
+
+// isParkedUser reports whether any of the user's sessions is waiting to be resumed
+func (s *Server) isParkedUser(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.parked {
+		if c.Username() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResumeDoesNotBlockOthers(t *testing.T) {
+	s := startTestServer(t, WithResumeWindow(time.Minute))
+	alice := dialTestServer(t, s)
+	token := alice.call(protocol.CmdRegister, "alice").Data
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+
+	alice.conn.Close()
+	waitFor(t, func() bool { return s.isParkedUser("alice") })
+
+	// Enough missed events to fill both the send queue and the socket buffers
+	big := strings.Repeat("x", 64*1024)
+	for i := 0; i < replaySize; i++ {
+		bob.call(protocol.CmdMessage, big)
+	}
+
+	// The resuming peer never reads its replay
+	stalled := dialTestServer(t, s)
+	started := time.Now()
+	stalled.send(protocol.CmdResume, token)
+	waitFor(t, func() bool { return !s.isParkedUser("alice") })
+
+	if resp := bob.call(protocol.CmdMessage, "still here"); !resp.Success {
+		t.Errorf("Expected other clients to keep working during a replay, got %+v", resp)
+	}
+	if elapsed := time.Since(started); elapsed > writeTimeout/2 {
+		t.Errorf("MESSAGE took %s while a replay was stalled", elapsed)
+	}
+}
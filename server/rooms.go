@@ -0,0 +1,279 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"tcp_server/protocol"
+)
+
+// Rooms are named channels joined per user. The lobby (room "") is everyone:
+// messages sent there reach every connection, as before rooms existed.
+
+// normalizeRoom turns "#Ops" or "ops" into "ops"
+func normalizeRoom(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+}
+
+// lobbyName is how people refer to the lobby; it cannot be used as a room name
+const lobbyName = "lobby"
+
+// displayRoom formats a room name for people ("#ops", or "lobby" for the lobby)
+func displayRoom(room string) string {
+	if room == "" {
+		return lobbyName
+	}
+	return "#" + room
+}
+
+// validRoom reports whether a normalized room name is acceptable
+func validRoom(room string) bool {
+	return room != "" && !strings.ContainsAny(room, " \t:#")
+}
+
+// Room returns the room the session's MESSAGE commands go to ("" = lobby)
+func (c *Client) Room() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.room
+}
+
+// deliver queues an event for every connection accepted by the filter
+// It returns the number of connections the event was queued for
+func (s *Server) deliver(event *protocol.Response, accept func(c *Client) bool) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.deliverLocked(event, accept)
+}
+
+// deliverLocked is deliver for callers that already hold s.mu
+func (s *Server) deliverLocked(event *protocol.Response, accept func(c *Client) bool) int {
+	// Numbering and queueing happen together so every session sees events in sequence order
+	s.deliverMu.Lock()
+	defer s.deliverMu.Unlock()
+
+	event.Seq = s.eventSeq.Add(1)
+
+	// Each listener codec encodes the event once
+	frames := make(map[protocol.Codec][]byte)
+	recipients := 0
+	for _, client := range s.clients {
+		if !accept(client) {
+			continue
+		}
+		client.recordEvent(event)
+		frame, ok := frames[client.codec]
+		if !ok {
+			var err error
+			if frame, err = client.codec.EncodeResponse(event); err != nil {
+				s.logger.Error("encode event failed", "event", event.Event, "codec", client.codec.Name(), "error", err)
+				continue
+			}
+			frames[client.codec] = frame
+		}
+		if s.sendEvent(client, frame) {
+			recipients++
+		}
+	}
+
+	// Dropped sessions keep collecting events until they are resumed or expire
+	for _, client := range s.parked {
+		if accept(client) {
+			client.recordEvent(event)
+		}
+	}
+
+	// Subscribers see every event, in sequence order
+	for _, fn := range s.subscribers {
+		fn(event)
+	}
+	s.recordStreamedLocked(event)
+
+	s.metrics.fanout.Observe(float64(recipients))
+	return recipients
+}
+
+// deliverToRoom sends an event to every session of every member of a room
+// The lobby ("") reaches every connection
+func (s *Server) deliverToRoom(room string, event *protocol.Response, except *Client) int {
+	event.Room = room
+	return s.deliver(event, inRoom(room, except))
+}
+
+// inRoom accepts the sessions of a room's members except one; s.mu must be held
+func inRoom(room string, except *Client) func(c *Client) bool {
+	return func(c *Client) bool {
+		if c == except {
+			return false
+		}
+		if room == "" {
+			return true
+		}
+		u := c.User()
+		return u != nil && u.rooms[room]
+	}
+}
+
+// deliverToUsers sends an event to every session of the named users
+func (s *Server) deliverToUsers(names []string, event *protocol.Response, except *Client) int {
+	return s.deliver(event, func(c *Client) bool {
+		if c == except || !c.IsRegistered() {
+			return false
+		}
+		name := c.Username()
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// handleJoinRoom adds the caller's user to a room and makes it the session's active room
+// "JOIN_ROOM lobby" switches the session back to the lobby without leaving any room
+func (s *Server) handleJoinRoom(client *Client, msg *protocol.Message) *protocol.Response {
+	room := normalizeRoom(msg.Data)
+	if room == lobbyName {
+		client.mu.Lock()
+		client.room = ""
+		client.mu.Unlock()
+		return protocol.NewResponse(true, "Back in the lobby", "")
+	}
+	if !validRoom(room) {
+		return protocol.NewErrorResponse(protocol.CodeValidation, fmt.Sprintf("Invalid room name: %s", msg.Data))
+	}
+
+	u := client.User()
+	if u == nil {
+		return protocol.NewErrorResponse(protocol.CodeAuthRequired, "Register before joining a room")
+	}
+	alreadyMember := s.setMember(u, room, true)
+
+	client.mu.Lock()
+	client.room = room
+	client.mu.Unlock()
+
+	if !alreadyMember {
+		s.deliverToRoom(room, protocol.NewEvent(protocol.EventJoin, u.name,
+			fmt.Sprintf("→ %s joined %s", u.name, displayRoom(room)), ""), client)
+	}
+	return protocol.NewResponse(true, fmt.Sprintf("Joined %s", displayRoom(room)), room)
+}
+
+// handleLeaveRoom removes the caller's user from a room
+// Sessions that had it as their active room go back to the lobby
+func (s *Server) handleLeaveRoom(client *Client, msg *protocol.Message) *protocol.Response {
+	room := normalizeRoom(msg.Data)
+
+	u := client.User()
+	if u == nil {
+		return protocol.NewErrorResponse(protocol.CodeAuthRequired, "Register before leaving a room")
+	}
+	member := s.setMember(u, room, false)
+
+	if !member {
+		return protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("You are not in %s", displayRoom(room)))
+	}
+
+	for _, c := range s.sessionsOf(u) {
+		c.mu.Lock()
+		if c.room == room {
+			c.room = ""
+		}
+		c.mu.Unlock()
+	}
+
+	s.deliverToRoom(room, protocol.NewEvent(protocol.EventLeave, u.name,
+		fmt.Sprintf("← %s left %s", u.name, displayRoom(room)), ""), client)
+	return protocol.NewResponse(true, fmt.Sprintf("Left %s", displayRoom(room)), room)
+}
+
+// isMember reports whether a user is in a room
+func (s *Server) isMember(u *User, room string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return u != nil && u.rooms[room]
+}
+
+// setMember adds a user to a room or removes them, returning whether they were a member
+func (s *Server) setMember(u *User, room string, member bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	was := u.rooms[room]
+	if member {
+		u.rooms[room] = true
+	} else {
+		delete(u.rooms, room)
+	}
+	return was
+}
+
+// roomExists reports whether any user is a member of room
+func (s *Server) roomExists(room string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.rooms[room] {
+			return true
+		}
+	}
+	return false
+}
+
+// handleListRooms lists rooms with their member counts, marking the caller's rooms
+func (s *Server) handleListRooms(client *Client, msg *protocol.Message) *protocol.Response {
+	s.mu.RLock()
+	members := make(map[string]int)
+	for _, u := range s.users {
+		for room := range u.rooms {
+			members[room]++
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(members) == 0 {
+		return protocol.NewResponse(true, "Rooms", "No rooms yet")
+	}
+
+	rooms := make([]string, 0, len(members))
+	for room := range members {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+
+	active := client.Room()
+	lines := make([]string, len(rooms))
+	for i, room := range rooms {
+		lines[i] = fmt.Sprintf("%s (%d member(s))", displayRoom(room), members[room])
+		if room == active {
+			lines[i] += " *"
+		}
+	}
+	return protocol.NewResponse(true, "Rooms", strings.Join(lines, "\n"))
+}
+
+// handlePrivateMessage delivers "username:message" to every session of the recipient
+// The sender's other sessions get a copy so conversations stay in sync
+func (s *Server) handlePrivateMessage(client *Client, msg *protocol.Message) *protocol.Response {
+	to, text, ok := strings.Cut(msg.Data, ":")
+	to, text = strings.TrimSpace(to), strings.TrimSpace(text)
+	if !ok || to == "" || text == "" {
+		return protocol.NewErrorResponse(protocol.CodeValidation, "Usage: PM username:message")
+	}
+
+	from := client.Username()
+	if s.isMuted(from) {
+		return protocol.NewErrorResponse(protocol.CodeForbidden, "You are muted")
+	}
+	if _, online := s.lookupUser(to); !online {
+		return protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("User %s is not online", to))
+	}
+
+	event := protocol.NewEvent(protocol.EventPrivateMessage, from, fmt.Sprintf("[PM] %s: %s", from, text), text)
+	event.To = to
+	s.deliverToUsers([]string{to, from}, event, client)
+	return protocol.NewResponse(true, fmt.Sprintf("Message sent to %s", to), "")
+}
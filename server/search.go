@@ -0,0 +1,150 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"tcp_server/protocol"
+	"tcp_server/search"
+	"time"
+)
+
+// searchPageSize is how many results SEARCH returns per page
+const searchPageSize = 10
+
+// document converts a message for the search index
+func (m StoredMessage) document() search.Document {
+	return search.Document{ID: m.ID, From: m.From, Room: m.Room, Time: m.Timestamp, Text: m.Content}
+}
+
+// recordLocked brings the search index up to date with a message and queues it for the store
+// The caller must hold s.mu so versions reach the store in order
+func (s *Server) recordLocked(m StoredMessage) {
+	if m.Deleted {
+		s.index.Remove(m.ID)
+	} else {
+		s.index.Add(m.document())
+	}
+
+	if s.saves != nil {
+		s.saves.save(m)
+	}
+}
+
+// loadMessages rebuilds the history, reply counts, thread followers and search index from the store
+// The store is then compacted to the latest version of every message
+func (s *Server) loadMessages() error {
+	if s.store == nil {
+		return nil
+	}
+	messages, err := s.store.Load()
+	if err != nil {
+		return fmt.Errorf("load messages: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	replies := make(map[uint64]int)
+	for i := range messages {
+		m := &messages[i]
+		m.Seq = 0 // Event numbers start over, so old ones must not be replayed
+		s.messageID = max(s.messageID, m.ID)
+		if m.Deleted {
+			continue
+		}
+
+		s.index.Add(m.document())
+		if m.ReplyTo != 0 {
+			replies[m.ReplyTo]++
+			s.followLocked(m.ReplyTo, m.From)
+		}
+	}
+
+	// Only the most recent messages stay in memory; the index keeps them all
+	s.messages = append(s.messages[:0], messages[max(len(messages)-historySize, 0):]...)
+	for i := range s.messages {
+		m := &s.messages[i]
+		m.Replies = replies[m.ID]
+		if m.Replies > 0 {
+			s.followLocked(m.ID, m.From)
+		}
+	}
+	for thread := range s.followers {
+		if _, ok := s.messageLocked(thread); !ok {
+			delete(s.followers, thread)
+		}
+	}
+
+	// Superseded versions (edits, deletes, reactions) are dropped; every message is kept
+	if err := s.store.Compact(messages); err != nil {
+		return fmt.Errorf("compact messages: %w", err)
+	}
+	s.logger.Info("messages loaded", "messages", len(messages), "indexed", s.index.Len())
+	return nil
+}
+
+// handleSearch searches every message the caller can see
+// Data is a search query; "page:n" picks a page of results
+func (s *Server) handleSearch(client *Client, msg *protocol.Message) *protocol.Response {
+	page := 1
+	var text []string
+	for _, field := range strings.Fields(msg.Data) {
+		if value, ok := strings.CutPrefix(field, "page:"); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return protocol.NewErrorResponse(protocol.CodeValidation, fmt.Sprintf("Invalid page: %s", value))
+			}
+			page = n
+			continue
+		}
+		text = append(text, field)
+	}
+
+	query, err := search.ParseQuery(strings.Join(text, " "), time.Now())
+	if err != nil {
+		return protocol.NewErrorResponse(protocol.CodeValidation, fmt.Sprintf("Invalid search: %v", err))
+	}
+
+	// Room messages are only found by the room's members (and admins)
+	room := normalizeRoom(query.Room)
+	if room == lobbyName {
+		room = ""
+	}
+	admin := client.HasRole(RoleAdmin)
+	rooms := make(map[string]bool)
+	s.mu.RLock()
+	if u := client.User(); u != nil {
+		for r := range u.rooms {
+			rooms[r] = true
+		}
+	}
+	s.mu.RUnlock()
+
+	results := s.index.Search(query, func(doc search.Document) bool {
+		if query.Room != "" && doc.Room != room {
+			return false
+		}
+		return doc.Room == "" || rooms[doc.Room] || admin
+	})
+	if len(results) == 0 {
+		return protocol.NewResponse(true, "No results", "")
+	}
+
+	total := len(results)
+	pages := (total + searchPageSize - 1) / searchPageSize
+	if page > pages {
+		return protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("Only %d page(s) of results", pages))
+	}
+	results = results[(page-1)*searchPageSize : min(page*searchPageSize, len(results))]
+
+	lines := make([]string, len(results))
+	for i, doc := range results {
+		where := ""
+		if doc.Room != "" {
+			where = displayRoom(doc.Room) + " "
+		}
+		lines[i] = fmt.Sprintf("[%s] (%d) %s%s: %s", doc.Time.Format("2006-01-02 15:04"), doc.ID, where, doc.From, query.Snippet(doc.Text))
+	}
+	return protocol.NewResponse(true, fmt.Sprintf("%d result(s) (page %d of %d)", total, page, pages), strings.Join(lines, "\n"))
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	s := startTestServer(t)
+	alice := dialTestServer(t, s)
+	alice.call(protocol.CmdRegister, "alice")
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+
+	alice.call(protocol.CmdMessage, "the deploy was rolled back")
+	edited := bob.call(protocol.CmdMessage, "deploy looks fine").Data
+	alice.call(protocol.CmdJoinRoom, "ops")
+	alice.call(protocol.CmdMessage, "ops deploy secret")
+
+	// Terms, phrases and sender filters, with highlighted snippets
+	resp := bob.call(protocol.CmdSearch, `deploy "rolled back"`)
+	if resp.Message != "1 result(s) (page 1 of 1)" || !strings.Contains(resp.Data, "alice: the **deploy** was **rolled** **back**") {
+		t.Errorf("Phrase search = %s\n%s", resp.Message, resp.Data)
+	}
+	if resp := bob.call(protocol.CmdSearch, "deploy from:bob"); !strings.Contains(resp.Data, "("+edited+") bob: **deploy** looks fine") {
+		t.Errorf("Sender search = %s\n%s", resp.Message, resp.Data)
+	}
+
+	// Room messages are only found by members, and in: scopes the search
+	if resp := bob.call(protocol.CmdSearch, "secret"); resp.Message != "No results" {
+		t.Errorf("bob found a room message: %+v", resp)
+	}
+	if resp := alice.call(protocol.CmdSearch, "deploy in:lobby"); resp.Message != "2 result(s) (page 1 of 1)" {
+		t.Errorf("Lobby search = %s\n%s", resp.Message, resp.Data)
+	}
+	if resp := alice.call(protocol.CmdSearch, "deploy in:#ops"); !strings.Contains(resp.Data, "#ops alice: ops **deploy** secret") {
+		t.Errorf("Room search = %s\n%s", resp.Message, resp.Data)
+	}
+
+	// Edits and deletions update the index
+	bob.call(protocol.CmdEdit, edited+" all good")
+	if resp := bob.call(protocol.CmdSearch, "fine"); resp.Message != "No results" {
+		t.Errorf("Search found the old text of an edit: %+v", resp)
+	}
+	bob.call(protocol.CmdDelete, edited)
+	if resp := bob.call(protocol.CmdSearch, "good"); resp.Message != "No results" {
+		t.Errorf("Search found a deleted message: %+v", resp)
+	}
+
+	// Results are paginated, newest first
+	for i := range searchPageSize + 2 {
+		bob.call(protocol.CmdMessage, fmt.Sprintf("status update %d", i))
+	}
+	if resp := bob.call(protocol.CmdSearch, "status page:2"); resp.Message != "12 result(s) (page 2 of 2)" || !strings.HasSuffix(resp.Data, "**status** update 0") {
+		t.Errorf("Page 2 = %s\n%s", resp.Message, resp.Data)
+	}
+	if resp := bob.call(protocol.CmdSearch, `"unterminated`); resp.Code != protocol.CodeValidation {
+		t.Errorf("Bad query = %+v", resp)
+	}
+}
+
+func TestMessageStoreRebuild(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	open := func() *FileMessageStore {
+		store, err := OpenFileMessageStore(path)
+		if err != nil {
+			t.Fatalf("OpenFileMessageStore() error = %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	}
+
+	first := startTestServer(t, WithMessageStore(open()))
+	alice := dialTestServer(t, first)
+	alice.call(protocol.CmdRegister, "alice")
+	root := alice.call(protocol.CmdMessage, "kernel upgrade tonight").Data
+	alice.call(protocol.CmdReply, root+" postponed to friday")
+	typo := alice.call(protocol.CmdMessage, "maintenance windw").Data
+	alice.call(protocol.CmdEdit, typo+" maintenance window")
+	gone := alice.call(protocol.CmdMessage, "wrong channel").Data
+	alice.call(protocol.CmdDelete, gone)
+	first.Shutdown()
+
+	// A new server rebuilds history, threads and the index from the same file
+	second := startTestServer(t, WithMessageStore(open()))
+	if err := second.loadMessages(); err != nil {
+		t.Fatalf("loadMessages() error = %v", err)
+	}
+	bob := dialTestServer(t, second)
+	bob.call(protocol.CmdRegister, "bob")
+
+	// Loading compacted the log to one line per message
+	if data, err := os.ReadFile(path); err != nil || strings.Count(string(data), "\n") != 4 {
+		t.Errorf("Compacted log (error %v):\n%s", err, data)
+	}
+
+	history := bob.call(protocol.CmdListMessages, "").Data
+	if !strings.Contains(history, "kernel upgrade tonight (1 reply)") || !strings.Contains(history, "maintenance window (edited)") || !strings.Contains(history, "alice: [deleted]") {
+		t.Errorf("Rebuilt history:\n%s", history)
+	}
+	if resp := bob.call(protocol.CmdSearch, "friday"); !strings.Contains(resp.Data, "postponed to **friday**") {
+		t.Errorf("Search after restart = %s\n%s", resp.Message, resp.Data)
+	}
+	for _, stale := range []string{"windw", "channel"} {
+		if resp := bob.call(protocol.CmdSearch, stale); resp.Message != "No results" {
+			t.Errorf("Search for %q found stale text: %s\n%s", stale, resp.Message, resp.Data)
+		}
+	}
+
+	// IDs continue after the loaded ones
+	if id := bob.call(protocol.CmdMessage, "hello again").Data; id != formatID(5) {
+		t.Errorf("New message ID = %s, want 5", id)
+	}
+}
+
+func TestSearchCoversHistory(t *testing.T) {
+	s := startTestServer(t)
+	alice := dialTestServer(t, s)
+	alice.call(protocol.CmdRegister, "alice")
+
+	oldest := alice.call(protocol.CmdMessage, "oldest note").Data
+	for i := 0; i < historySize; i++ {
+		alice.call(protocol.CmdMessage, fmt.Sprintf("filler %d", i))
+	}
+
+	// Messages that left the history are still found, but can no longer be edited
+	if resp := alice.call(protocol.CmdSearch, "oldest"); !strings.Contains(resp.Data, "**oldest** note") {
+		t.Errorf("Search for an evicted message = %s\n%s", resp.Message, resp.Data)
+	}
+	if resp := alice.call(protocol.CmdEdit, oldest+" newest note"); resp.Code != protocol.CodeNotFound {
+		t.Errorf("Edit of an evicted message = %+v", resp)
+	}
+}
+
+// stuckStore blocks every save until release is closed
+type stuckStore struct {
+	release chan struct{}
+	saved   []uint64
+}
+
+func (s *stuckStore) Save(m StoredMessage) error {
+	<-s.release
+	s.saved = append(s.saved, m.ID)
+	return nil
+}
+func (s *stuckStore) Load() ([]StoredMessage, error) { return nil, nil }
+func (s *stuckStore) Compact([]StoredMessage) error  { return nil }
+func (s *stuckStore) Clear() error                   { return nil }
+
+func TestStoreQueueBoundedAndStopsOnShutdown(t *testing.T) {
+	store := &stuckStore{release: make(chan struct{})}
+	s := NewServer("127.0.0.1:0", WithMessageStore(store), WithLogger(slog.New(slog.DiscardHandler)))
+
+	// One change is being written, storeQueueSize wait, and the rest are dropped
+	for i := 0; i < storeQueueSize+3; i++ {
+		if _, failed := s.postMessage(StoredMessage{From: "alice", Content: "hi"}, nil); failed != nil {
+			t.Fatalf("postMessage() = %+v", failed)
+		}
+		if i == 0 {
+			waitFor(t, func() bool {
+				s.saves.mu.Lock()
+				defer s.saves.mu.Unlock()
+				return len(s.saves.ops) == 0
+			})
+		}
+	}
+	if dropped := s.metrics.storeDropped.Value(); dropped != 2 {
+		t.Errorf("Dropped = %d, want 2", dropped)
+	}
+
+	close(store.release)
+	s.Shutdown()
+	if len(store.saved) != storeQueueSize+1 {
+		t.Errorf("Saved %d messages, want %d", len(store.saved), storeQueueSize+1)
+	}
+
+	// Nothing is taken once shutdown has started, so nothing acknowledged is lost
+	if _, failed := s.postMessage(StoredMessage{From: "alice", Content: "late"}, nil); failed == nil || failed.Code != protocol.CodeRejected {
+		t.Errorf("postMessage() after Shutdown = %+v", failed)
+	}
+	if dropped := s.metrics.storeDropped.Value(); dropped != 2 {
+		t.Errorf("Dropped after Shutdown = %d, want 2", dropped)
+	}
+}
@@ -2,115 +2,435 @@ package server
 
 import (
 	"bufio"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net"
+	"net/netip"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"tcp_server/protocol"
+	"tcp_server/proxyproto"
+	"tcp_server/search"
+	"tcp_server/sockopt"
 	"time"
 )
 
+// historySize is how many messages the server keeps in memory
+const historySize = 100
+
 // Server represents a TCP server that handles multiple clients
 type Server struct {
-	address  string               // Address to listen on (e.g., ":8080")
-	listener net.Listener         // TCP listener
-	clients  map[net.Conn]*Client // Connected clients
-	messages []StoredMessage      // Message history
-	mu       sync.RWMutex         // Mutex for thread-safe client map access
-	quit     chan struct{}        // Channel to signal server shutdown
+	address      string               // Address to listen on (e.g., ":8080")
+	listeners    []net.Listener       // Listeners accepting clients (TCP and Unix sockets)
+	clients      map[net.Conn]*Client // Connected clients
+	users        map[string]*User     // Registered users by name (each with one or more sessions)
+	parked       map[string]*Client   // Dropped sessions waiting to be resumed, by resume token
+	messages     []StoredMessage      // Message history
+	messageID    uint64               // Last assigned message ID (guarded by mu)
+	commands     *Registry            // Registered command handlers
+	mu           sync.RWMutex         // Mutex for thread-safe client map access
+	quit         chan struct{}        // Channel to signal server shutdown
+	shutdownOnce sync.Once            // Guards closing quit
+
+	builtin    Middleware   // Logging, metrics and panic recovery around every command
+	middleware []Middleware // Middleware wrapped around command dispatch
+	handler    Handler      // processCommand wrapped in the middleware chain
+	mwMu       sync.RWMutex // Mutex for the middleware chain
+
+	slashCommands map[string]SlashCommand // Slash commands typed into MESSAGE, by name
+	slashMu       sync.RWMutex            // Mutex for slashCommands
+
+	followers map[uint64]map[string]bool // Users following each thread, by thread ID (guarded by mu)
+	index     *search.Index              // Full-text index of every message, including those evicted from messages
+	store     MessageStore               // Durable message log (nil = messages are lost on restart)
+	saves     *storeQueue                // Writes to store in the background
+	stopping  bool                       // Set by Shutdown; no messages are taken after it (guarded by mu)
+
+	logger            *slog.Logger                        // Structured logger for server events
+	redact            bool                                // Keep message bodies out of the logs
+	disconnectOnPanic bool                                // Close a client's connection after its command panics
+	moderation        *moderation                         // Operators, bans and mutes
+	reload            func() error                        // Called by the control channel's RELOAD command
+	startedAt         time.Time                           // When Start was called
+	draining          atomic.Bool                         // Set once Drain stops accepting connections
+	idleTimeout       time.Duration                       // Mark registered clients away after this long without a command
+	resumeWindow      time.Duration                       // How long a dropped session can be resumed (0 = disabled)
+	eventSeq          atomic.Uint64                       // Sequence number of the last delivered event
+	deliverMu         sync.Mutex                          // Keeps event numbering and queueing in the same order
+	subscribers       map[uint64]func(*protocol.Response) // Event observers by ID (guarded by deliverMu)
+	streamed          []*protocol.Response                // Recent event stream events for Last-Event-ID (guarded by deliverMu)
+	nextSubscriber    uint64
+	heartbeat         time.Duration    // Interval between server pings (0 = disabled)
+	heartbeatMissed   int              // Close connections after this many unanswered pings
+	socketOptions     sockopt.Options  // TCP options applied to accepted connections
+	listenerConfigs   []ListenerConfig // Extra addresses to listen on besides address
+	trustedProxies    []netip.Prefix   // Sources whose PROXY headers are trusted on address
+	metrics           *serverMetrics   // Counters, gauges and histograms for the metrics endpoint
 }
 
 // StoredMessage represents a stored chat message
 type StoredMessage struct {
-	From      string    // Username of sender
-	Content   string    // Message content
-	Timestamp time.Time // When the message was sent
+	ID        uint64     // Unique, increasing ID that EDIT, DELETE and REACT refer to
+	From      string     // Username of sender
+	Room      string     // Room the message was sent to ("" = lobby)
+	Content   string     // Message content
+	Timestamp time.Time  // When the message was sent
+	Seq       uint64     // Sequence number of the message's event
+	Action    bool       // Sent with /me: shown as "* alice waves"
+	ReplyTo   uint64     // ID of the thread's first message if this is a reply (0 = not a reply)
+	Replies   int        // Replies in this message's thread, not counting deleted ones
+	EditedAt  time.Time  // When the content was last edited (zero = never)
+	Deleted   bool       // Deleted by its sender or an admin; Content is cleared
+	Reactions []Reaction // Emoji reactions in the order they were first added
+}
+
+// event rebuilds the message event that was delivered for the message
+func (m StoredMessage) event() *protocol.Response {
+	event := protocol.NewEvent(protocol.EventMessage, m.From, m.text(), m.Content)
+	event.Room = m.Room
+	event.Seq = m.Seq
+	event.ID = m.ID
+	if m.ReplyTo != 0 {
+		event.Event = protocol.EventReply
+		event.ReplyTo = m.ReplyTo
+	}
+	return event
+}
+
+// text formats the message event for people
+func (m StoredMessage) text() string {
+	if m.ReplyTo != 0 {
+		return fmt.Sprintf("%s ↪%d %s", roomLabel(m.Room), m.ReplyTo, m.line())
+	}
+	return roomLabel(m.Room) + " " + m.line()
+}
+
+// roomLabel prefixes events for people: "[Broadcast]" in the lobby, "[#ops]" in a room
+func roomLabel(room string) string {
+	if room == "" {
+		return "[Broadcast]"
+	}
+	return "[" + displayRoom(room) + "]"
+}
+
+// line formats the sender and content ("alice: hi", or "* alice waves" for an action)
+func (m StoredMessage) line() string {
+	if m.Action {
+		return fmt.Sprintf("* %s %s", m.From, m.Content)
+	}
+	return fmt.Sprintf("%s: %s", m.From, m.Content)
 }
 
 // Client represents a connected client with metadata
 type Client struct {
-	conn     net.Conn   // TCP connection
-	username string     // Client's username (set via REGISTER command)
-	mu       sync.Mutex // Mutex for thread-safe client access
+	conn        net.Conn       // TCP connection
+	username    string         // Client's username (set via REGISTER command)
+	registered  bool           // Whether the client has registered a username
+	values      map[any]any    // Per-connection state attached by middleware
+	roles       map[Role]bool  // Roles granted to the client (e.g., admin via OPER)
+	connectedAt time.Time      // When the connection was accepted
+	lastActive  time.Time      // When the client last sent a command
+	user        *User          // Identity shared with the user's other sessions (nil until REGISTER)
+	sessionID   string         // Identifies this connection among its user's sessions
+	room        string         // Room MESSAGE goes to ("" = lobby)
+	resumeToken string         // Secret that lets a new connection take over this session
+	replay      []replayEvent  // Recently delivered events, replayed on RESUME
+	replayLost  uint64         // Highest sequence number evicted from replay
+	ended       bool           // Session ended on purpose (QUIT or kick) and must not be parked
+	pingsMissed int            // Pings sent since the peer last sent anything
+	pingSentAt  time.Time      // When the last ping was sent
+	rtt         time.Duration  // Round-trip time measured by the last answered ping
+	listener    *listener      // Listener the client connected through
+	proxyAddr   net.Addr       // Load balancer that sent a PROXY header (nil = direct)
+	codec       protocol.Codec // Wire format of the client's listener
+	sessionless bool           // HTTP API client without a User or send queue (see apiCommands)
+	mu          sync.Mutex     // Mutex for thread-safe client access
+
+	out        chan []byte   // Encoded frames waiting to be written
+	done       chan struct{} // Closed when the client is being torn down
+	writerDone chan struct{} // Closed when the writer goroutine exits
+	closeOnce  sync.Once     // Guards closing done
+
+	panicked atomic.Bool // Set by Recovery when the last command panicked
+}
+
+// Username returns the client's current username
+func (c *Client) Username() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.username
+}
+
+// IsRegistered returns true once the client has registered a username
+func (c *Client) IsRegistered() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.registered
+}
+
+// Value returns per-connection state stored under key (nil if unset)
+func (c *Client) Value(key any) any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+// SetValue stores per-connection state under key for the lifetime of the connection
+// Middleware uses this to keep state such as rate limiters or trace IDs
+func (c *Client) SetValue(key, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setValueLocked(key, value)
+}
+
+// setValueLocked stores a value; the caller must hold c.mu
+func (c *Client) setValueLocked(key, value any) {
+	if c.values == nil {
+		c.values = make(map[any]any)
+	}
+	c.values[key] = value
+}
+
+// RemoteAddr returns the client's remote network address
+// Behind a trusted proxy this is the address from the PROXY header
+func (c *Client) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ProxyAddr returns the load balancer the client connected through (nil if direct)
+func (c *Client) ProxyAddr() net.Addr {
+	return c.proxyAddr
 }
 
 // NewServer creates a new TCP server
-func NewServer(address string) *Server {
-	return &Server{
-		address:  address,
-		clients:  make(map[net.Conn]*Client),
-		messages: make([]StoredMessage, 0, 100), // Preallocate for 100 messages
-		quit:     make(chan struct{}),
+func NewServer(address string, opts ...Option) *Server {
+	s := &Server{
+		address:       address,
+		clients:       make(map[net.Conn]*Client),
+		users:         make(map[string]*User),
+		parked:        make(map[string]*Client),
+		messages:      make([]StoredMessage, 0, historySize), // Preallocate the history
+		commands:      NewRegistry(),
+		slashCommands: make(map[string]SlashCommand),
+		followers:     make(map[uint64]map[string]bool),
+		index:         search.NewIndex(),
+		quit:          make(chan struct{}),
+		logger:        slog.Default(),
+	}
+	s.handler = s.processCommand
+	s.builtin = Chain(s.Logging(), s.CommandMetrics(), s.Recovery())
+	s.metrics = newServerMetrics(s)
+	s.moderation = newModeration()
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.store != nil {
+		s.saves = newStoreQueue(s.store, s.logger, s.metrics.storeDropped)
 	}
+	s.registerBuiltinCommands()
+	s.registerAdminCommands()
+	s.registerSlashCommands()
+	return s
 }
 
-// Start begins listening for connections and accepts clients
+// Start opens the server's address and every listener added with WithListener,
+// accepts clients on all of them and blocks until Shutdown
 func (s *Server) Start() error {
-	// Create TCP listener
-	listener, err := net.Listen("tcp", s.address)
-	if err != nil {
+	configs := s.listenerConfigs
+	if s.address != "" {
+		configs = append([]ListenerConfig{{Address: s.address, TrustedProxies: s.trustedProxies}}, configs...)
+	}
+	if len(configs) == 0 {
+		return fmt.Errorf("failed to start server: no address to listen on")
+	}
+
+	// Rebuild the history and search index from the message store
+	if err := s.loadMessages(); err != nil {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
-	s.listener = listener
 
-	log.Printf("🚀 TCP Server started on %s", s.address)
-	log.Println("📖 Educational TCP/IP Server - Ready to accept connections")
-	log.Println("-----------------------------------------------------------")
+	// Open every listener first so a bad address fails the whole start
+	listeners := make([]*listener, 0, len(configs))
+	for _, cfg := range configs {
+		l, err := newListener(cfg)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return fmt.Errorf("failed to start server: %w", err)
+		}
+		listeners = append(listeners, l)
+	}
+	s.startedAt = time.Now()
 
-	// Accept connections in a loop
-	go s.acceptConnections()
+	// Accept connections on every listener
+	for _, l := range listeners {
+		s.trackListener(l)
+		go s.serve(l)
+	}
+
+	// Mark idle users away
+	if s.idleTimeout > 0 {
+		go s.idleLoop()
+	}
+
+	// Ping clients and reap dead connections
+	if s.heartbeat > 0 {
+		go s.heartbeatLoop()
+	}
 
 	// Wait for shutdown signal
 	<-s.quit
 	return nil
 }
 
-// acceptConnections continuously accepts new client connections
-func (s *Server) acceptConnections() {
+// Serve accepts clients on a listener with the default policy until it is closed
+// All listeners share the same users, rooms and client list
+func (s *Server) Serve(l net.Listener) error {
+	return s.serve(&listener{Listener: l, name: l.Addr().String(), codec: protocol.JSONCodec})
+}
+
+// serve accepts clients on a listener until it is closed
+func (s *Server) serve(listener *listener) error {
+	s.trackListener(listener)
+	s.logger.Info("server started", "address", listener.Addr().String(), "network", listener.Addr().Network(),
+		"listener", listener.name, "codec", listener.codec.Name(), "tls", listener.tls != nil)
+
 	for {
 		// Accept() blocks until a new connection arrives
-		conn, err := s.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			select {
 			case <-s.quit:
 				// Server is shutting down
-				return
+				return nil
 			default:
-				log.Printf("❌ Error accepting connection: %v", err)
+				if s.draining.Load() || errors.Is(err, net.ErrClosed) {
+					// Drain closed the listener; existing clients keep running
+					return nil
+				}
+				s.logger.Error("accept failed", "error", err)
 				continue
 			}
 		}
 
-		log.Printf("✅ New connection from %s", conn.RemoteAddr())
+		s.accept(listener, conn)
+	}
+}
 
-		// Create client object
-		client := &Client{
-			conn:     conn,
-			username: "anonymous",
-		}
+// accept admits a new connection and starts handling it
+func (s *Server) accept(l *listener, conn net.Conn) {
+	// Socket options apply to the TCP connection underneath any PROXY or TLS layer
+	if err := s.socketOptions.Apply(conn); err != nil {
+		s.logger.Warn("failed to set socket options", "remote_addr", conn.RemoteAddr().String(), "error", err)
+	}
 
-		// Add client to map
-		s.mu.Lock()
-		s.clients[conn] = client
+	// Connections from a trusted load balancer start with the real client's address
+	// The header is read off the accept loop so a slow proxy can't stall other clients
+	if proxyproto.Trusted(conn.RemoteAddr(), l.trustedProxies) {
+		go s.acceptProxied(l, conn)
+		return
+	}
+	s.admit(l, conn, nil)
+}
+
+// acceptProxied reads the PROXY header of a connection from a trusted proxy
+func (s *Server) acceptProxied(l *listener, conn net.Conn) {
+	proxied, err := proxyproto.Accept(conn, proxyHeaderTimeout)
+	if err != nil {
+		s.metrics.rejected.WithLabelValues("proxy_header").Inc()
+		s.logger.Warn("connection rejected", "remote_addr", conn.RemoteAddr().String(), "reason", "proxy_header", "error", err)
+		conn.Close()
+		return
+	}
+	s.admit(l, proxied, proxied.ProxyAddr())
+}
+
+// admit runs the listener and server checks on a connection and starts handling it
+// proxy is the load balancer that forwarded the connection (nil if it came directly)
+func (s *Server) admit(l *listener, conn net.Conn, proxy net.Addr) {
+	if l.tls != nil {
+		conn = tls.Server(conn, l.tls)
+	}
+
+	// Refuse banned addresses before doing any other work
+	if reason, banned := s.addrBanReason(conn.RemoteAddr()); banned {
+		s.rejectConnection(conn, l.codec, "banned", fmt.Sprintf("You are banned: %s", reason))
+		return
+	}
+
+	// Refuse the connection if this listener is full
+	s.mu.Lock()
+	if l.maxConnections > 0 && l.active.Load() >= int64(l.maxConnections) {
 		s.mu.Unlock()
+		s.rejectConnection(conn, l.codec, "listener_max_connections", "Server is full, try again later")
+		return
+	}
+
+	// Create client object and add it to the map
+	client := newClient(conn, l)
+	client.proxyAddr = proxy
+	s.clients[conn] = client
+	l.active.Add(1)
+	s.mu.Unlock()
 
-		// Handle client in a separate goroutine (concurrent handling)
-		// This is KEY: each client gets their own goroutine
-		go s.handleClient(client)
+	s.metrics.accepted.Inc()
+	if proxy != nil {
+		s.logger.Info("connection accepted", "remote_addr", conn.RemoteAddr().String(), "proxy_addr", proxy.String())
+	} else {
+		s.logger.Info("connection accepted", "remote_addr", conn.RemoteAddr().String())
 	}
+
+	// Handle client in a separate goroutine (concurrent handling)
+	// This is KEY: each client gets their own goroutine
+	go s.handleClient(client)
+}
+
+// rejectConnection tells a client why it was refused and closes the connection
+func (s *Server) rejectConnection(conn net.Conn, codec protocol.Codec, reason, message string) {
+	s.metrics.rejected.WithLabelValues(reason).Inc()
+	s.logger.Warn("connection rejected", "remote_addr", conn.RemoteAddr().String(), "reason", reason)
+
+	if data, err := codec.EncodeResponse(protocol.NewErrorResponse(protocol.CodeRejected, message)); err == nil {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		conn.Write(data)
+	}
+	conn.Close()
 }
 
 // handleClient processes messages from a single client
 func (s *Server) handleClient(client *Client) {
+	// Responses and broadcasts are written by a dedicated goroutine
+	go s.writeLoop(client)
+
 	defer func() {
-		// Cleanup when client disconnects
-		log.Printf("👋 Client %s (%s) disconnected", client.conn.RemoteAddr(), client.username)
-		client.conn.Close()
+		// A panic outside command dispatch must not take down the whole server
+		if r := recover(); r != nil {
+			s.recordPanic(client, "", r)
+		}
 
+		// Cleanup when client disconnects: stop broadcasts, flush the queue, then close
 		s.mu.Lock()
 		delete(s.clients, client.conn)
+		client.listener.active.Add(-1)
+		var left *User
+		if u := client.User(); u != nil && !s.parkLocked(client) {
+			left = s.detachLocked(client, u)
+		}
 		s.mu.Unlock()
+
+		client.closeOutbox()
+		client.conn.Close()
+		s.clientLogger(client).Info("client disconnected")
+
+		// Only the user's last session leaving is announced
+		if left != nil {
+			s.announceLeave(left.name, client)
+		}
 	}()
 
 	// Create buffered reader for efficient reading
@@ -129,35 +449,36 @@ func (s *Server) handleClient(client *Client) {
 		line, err := reader.ReadString('\n')
 		if err != nil {
 			// Connection closed or error
-			if err.Error() != "EOF" {
-				log.Printf("⚠️  Error reading from %s: %v", client.conn.RemoteAddr(), err)
+			if !errors.Is(err, io.EOF) {
+				s.clientLogger(client).Warn("read failed", "error", err)
 			}
 			return
 		}
+		s.metrics.bytesIn.Add(uint64(len(line)))
+		client.heardFrom()
 
-		// Parse message
-		var msg protocol.Message
-		if v := msg.FromJSON([]byte(line)); err != nil {
-			log.Printf("❌ Invalid message from %s: %v", client.conn.RemoteAddr(), v)
-			response := protocol.NewResponse(false, "Invalid message format", "")
+		// Parse message in the listener's wire format
+		msg, err := client.codec.DecodeMessage([]byte(line))
+		if err != nil {
+			s.clientLogger(client).Warn("invalid message", "error", err)
+			response := protocol.NewErrorResponse(protocol.CodeInvalidMessage, "Invalid message format")
 			s.sendResponse(client, response)
 			continue
 		}
 
-		// Validate message
-		if err := msg.Validate(); err != nil {
-			log.Printf("❌ Invalid message from %s: %v", client.conn.RemoteAddr(), err)
-			response := protocol.NewResponse(false, fmt.Sprintf("Validation error: %v", err), "")
-			s.sendResponse(client, response)
+		// Heartbeats are answered here, without a reply and without counting as activity
+		if s.handleHeartbeat(client, msg) {
 			continue
 		}
 
-		log.Printf("📨 Received from %s (%s): %s", client.conn.RemoteAddr(), client.username, msg.String())
-
-		// Process the command
-		response := s.processCommand(client, &msg)
+		response, panicked := s.execute(client, msg)
 		s.sendResponse(client, response)
 
+		if panicked && s.disconnectOnPanic {
+			s.clientLogger(client).Warn("disconnecting client after panic")
+			return
+		}
+
 		// Handle QUIT command
 		if msg.Command == protocol.CmdQuit {
 			return
@@ -165,151 +486,192 @@ func (s *Server) handleClient(client *Client) {
 	}
 }
 
-// processCommand handles different command types
+// processCommand dispatches a command to its registered handler
 func (s *Server) processCommand(client *Client, msg *protocol.Message) *protocol.Response {
-	switch msg.Command {
-	case protocol.CmdEcho:
-		// Simple echo - send back the data
-		return protocol.NewResponse(true, "Echo response", msg.Data)
-
-	case protocol.CmdRegister:
-		// Register username
-		client.mu.Lock()
-		client.username = msg.Data
-		client.mu.Unlock()
-		log.Printf("✏️  Client %s registered as '%s'", client.conn.RemoteAddr(), msg.Data)
-		return protocol.NewResponse(true, fmt.Sprintf("Registration successful. Welcome, %s!", msg.Data), "")
-
-	case protocol.CmdMessage:
-		// Broadcast message to all clients
-		client.mu.Lock()
-		msg.From = client.username
-		client.mu.Unlock()
-
-		// Store message in history
-		s.storeMessage(msg.From, msg.Data)
-		return protocol.NewResponse(true, "Message broadcasted", "")
-
-	case protocol.CmdListUsers:
-		// List all connected users
-		users := s.getConnectedUsers()
-		return protocol.NewResponse(true, "Online users", strings.Join(users, ", "))
-
-	case protocol.CmdListMessages:
-		// List recent messages
-		messages := s.getRecentMessages(20) // Get last 20 messages
-		return protocol.NewResponse(true, "Recent messages", messages)
-
-	case protocol.CmdTime:
-		// Return server time
-		serverTime := time.Now().Format(time.RFC3339)
-		return protocol.NewResponse(true, "Server time", serverTime)
-
-	case protocol.CmdQuit:
-		// Client wants to disconnect
-		return protocol.NewResponse(true, "Goodbye!", "")
-
-	default:
-		return protocol.NewResponse(false, "Unknown command", "")
-	}
-}
-
-// sendResponse sends a response to a client
-func (s *Server) sendResponse(client *Client, response *protocol.Response) {
-	data, err := response.ToJSON()
-	if err != nil {
-		log.Printf("❌ Error marshaling response: %v", err)
-		return
+	h, ok := s.commands.Get(msg.Command)
+	if !ok {
+		return protocol.NewErrorResponse(protocol.CodeUnknownCommand, "Unknown command")
 	}
 
-	_, err = client.conn.Write(data)
-	if err != nil {
-		log.Printf("❌ Error sending response to %s: %v", client.conn.RemoteAddr(), err)
+	if client.sessionless && !apiCommands[msg.Command] {
+		return protocol.NewErrorResponse(protocol.CodeForbidden, fmt.Sprintf("Command %s needs a chat session and is not available over the HTTP API", msg.Command))
 	}
+
+	if h.RequiresAuth && !client.IsRegistered() {
+		return protocol.NewErrorResponse(protocol.CodeAuthRequired, fmt.Sprintf("Command %s requires registration", msg.Command))
+	}
+
+	if h.RequiresRole != "" && !client.HasRole(h.RequiresRole) {
+		return protocol.NewErrorResponse(protocol.CodeForbidden, fmt.Sprintf("Command %s requires the %s role", msg.Command, h.RequiresRole))
+	}
+
+	return h.Handler(client, msg)
 }
 
-// getConnectedUsers returns a list of connected usernames
-func (s *Server) getConnectedUsers() []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// execute validates a command and runs it through the middleware chain
+// Every transport (TCP, WebSocket, HTTP) goes through here so behavior is identical
+func (s *Server) execute(client *Client, msg *protocol.Message) (response *protocol.Response, panicked bool) {
+	// Validate message against the server's command registry
+	if err := msg.ValidateWith(s.commands); err != nil {
+		s.clientLogger(client).Warn("invalid message", "command", msg.Command, "error", err)
+		return protocol.NewErrorResponse(protocol.CodeValidation, fmt.Sprintf("Validation error: %v", err)), false
+	}
 
-	users := make([]string, 0, len(s.clients))
-	for _, client := range s.clients {
-		client.mu.Lock()
-		users = append(users, client.username)
-		client.mu.Unlock()
+	s.markActive(client)
+
+	// Process the command through the middleware chain
+	return s.safeDispatch(client, msg)
+}
+
+// Handle registers a custom command handler with the server
+// Private commands are validated and dispatched exactly like built-in ones
+func (s *Server) Handle(h CommandHandler) error {
+	return s.commands.Register(h)
+}
+
+// sendResponse queues a response for a client
+func (s *Server) sendResponse(client *Client, response *protocol.Response) {
+	if !response.Success && response.Code != "" {
+		s.metrics.errors.WithLabelValues(response.Code).Inc()
+	}
+
+	data, err := client.codec.EncodeResponse(response)
+	if err != nil {
+		s.clientLogger(client).Error("marshal response failed", "error", err)
+		return
+	}
+
+	// Responses wait for room in the queue; only broadcasts are dropped
+	if !client.enqueue(data, true) {
+		s.clientLogger(client).Warn("send response failed", "error", "client is closed")
 	}
-	return users
 }
 
-// storeMessage stores a message in the server's history
-func (s *Server) storeMessage(from, content string) {
+// postMessage stores a chat message in the history and delivers it to its room
+// A reply is delivered to the thread's followers instead and counted on its first message
+// The event is delivered under the same lock, so the history entry carries its sequence number
+// It returns the message's ID
+func (s *Server) postMessage(msg StoredMessage, except *Client) (uint64, *protocol.Response) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	msg := StoredMessage{
-		From:      from,
-		Content:   content,
-		Timestamp: time.Now(),
+	if s.stopping {
+		return 0, shuttingDown()
+	}
+
+	s.messageID++
+	msg.ID = s.messageID
+	event := msg.event()
+	if msg.ReplyTo != 0 {
+		s.addReplyLocked(msg)
+		s.deliverLocked(event, s.followingLocked(msg.ReplyTo, msg.Room, except))
+	} else {
+		s.deliverLocked(event, inRoom(msg.Room, except))
 	}
+	msg.Timestamp = time.Now()
+	msg.Seq = event.Seq
+	s.recordLocked(msg)
 
 	s.messages = append(s.messages, msg)
 
-	// Keep only last 100 messages to prevent unlimited growth
-	if len(s.messages) > 100 {
-		s.messages = s.messages[len(s.messages)-100:]
+	// Keep only the last historySize messages to prevent unlimited growth
+	if len(s.messages) > historySize {
+		for _, evicted := range s.messages[:len(s.messages)-historySize] {
+			delete(s.followers, evicted.ID)
+		}
+		s.messages = s.messages[len(s.messages)-historySize:]
 	}
 
-	log.Printf("💾 Stored message from %s (total: %d)", from, len(s.messages))
+	s.logger.Debug("message stored", "from", msg.From, "id", msg.ID, "total", len(s.messages))
+	return msg.ID, nil
+}
+
+// shuttingDown refuses a change that could no longer be saved
+func shuttingDown() *protocol.Response {
+	return protocol.NewErrorResponse(protocol.CodeRejected, "Server is shutting down")
 }
 
-// getRecentMessages returns the last N messages formatted as a string
+// getRecentMessages returns the last N messages of every room formatted as a string
 func (s *Server) getRecentMessages(count int) string {
+	return s.formatMessages(count, func(StoredMessage) bool { return true })
+}
+
+// getRecentRoomMessages returns the last N messages sent to a room ("" = lobby), leaving out
+// thread replies
+func (s *Server) getRecentRoomMessages(room string, count int) string {
+	return s.formatMessages(count, func(msg StoredMessage) bool { return msg.Room == room && msg.ReplyTo == 0 })
+}
+
+// formatMessages formats the last N messages accepted by the filter, oldest first
+func (s *Server) formatMessages(count int, accept func(StoredMessage) bool) string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if len(s.messages) == 0 {
-		return "No messages yet"
+	// Walk backwards to collect the last N matching messages
+	var recentMessages []StoredMessage
+	for i := len(s.messages) - 1; i >= 0 && len(recentMessages) < count; i-- {
+		if accept(s.messages[i]) {
+			recentMessages = append(recentMessages, s.messages[i])
+		}
 	}
 
-	// Get the last N messages
-	start := 0
-	if len(s.messages) > count {
-		start = len(s.messages) - count
+	if len(recentMessages) == 0 {
+		return "No messages yet"
 	}
 
-	recentMessages := s.messages[start:]
-
 	// Format messages as a string
 	var result strings.Builder
-	for i, msg := range recentMessages {
-		if i > 0 {
+	for i := len(recentMessages) - 1; i >= 0; i-- {
+		if i < len(recentMessages)-1 {
 			result.WriteString("\n")
 		}
-		result.WriteString(fmt.Sprintf("[%s] %s: %s",
-			msg.Timestamp.Format("15:04:05"),
-			msg.From,
-			msg.Content))
+		result.WriteString(recentMessages[i].historyLine())
 	}
 
 	return result.String()
 }
 
-// Shutdown gracefully shuts down the server
-func (s *Server) Shutdown() {
-	log.Println("🛑 Shutting down server...")
-	close(s.quit)
+// historyLine formats a message as one line of LIST_MESSAGES or THREAD output
+func (m StoredMessage) historyLine() string {
+	var line strings.Builder
+	line.WriteString(fmt.Sprintf("[%s] (%d) ", m.Timestamp.Format("15:04:05"), m.ID))
+	if m.Room != "" {
+		line.WriteString(displayRoom(m.Room) + " ")
+	}
+	if m.ReplyTo != 0 {
+		line.WriteString(fmt.Sprintf("↪%d ", m.ReplyTo))
+	}
+	line.WriteString(m.summary())
+	return line.String()
+}
 
-	if s.listener != nil {
-		s.listener.Close()
+// Shutdown gracefully shuts down the server; calling it again does nothing
+func (s *Server) Shutdown() {
+	closed := false
+	s.shutdownOnce.Do(func() {
+		close(s.quit)
+		closed = true
+	})
+	if !closed {
+		return
 	}
+	s.logger.Info("server shutting down")
 
-	// Close all client connections
+	// Stop taking messages, then close all listeners and client connections
 	s.mu.Lock()
+	s.stopping = true
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
 	for conn := range s.clients {
 		conn.Close()
 	}
 	s.mu.Unlock()
 
-	log.Println("✅ Server shutdown complete")
+	// Write out messages still queued for the store; nothing is queued after stopping
+	if s.saves != nil {
+		s.saves.close()
+	}
+
+	s.logger.Info("server shutdown complete")
 }
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"log/slog"
+	"net"
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+	"time"
+)
+
+// startTestServer starts a server on a random loopback port
+func startTestServer(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+
+	opts = append([]Option{WithLogger(slog.New(slog.DiscardHandler))}, opts...)
+	s := NewServer("127.0.0.1:0", opts...)
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	s.trackListener(listener)
+	go s.Serve(listener)
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+// testConn is a raw protocol connection used to drive the server in tests
+type testConn struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialTestServer connects to the server and consumes the welcome message
+func dialTestServer(t *testing.T, s *Server) *testConn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", s.Addrs()[0].String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	tc := &testConn{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	tc.read()
+	return tc
+}
+
+// send writes a command to the server
+func (tc *testConn) send(command, data string) {
+	tc.t.Helper()
+
+	frame, err := protocol.NewMessage("", command, data).ToJSON()
+	if err != nil {
+		tc.t.Fatalf("ToJSON() error = %v", err)
+	}
+	if _, err := tc.conn.Write(frame); err != nil {
+		tc.t.Fatalf("Write() error = %v", err)
+	}
+}
+
+// read reads the next frame (reply or event) from the server
+func (tc *testConn) read() *protocol.Response {
+	tc.t.Helper()
+
+	tc.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := tc.reader.ReadString('\n')
+	if err != nil {
+		tc.t.Fatalf("ReadString() error = %v", err)
+	}
+
+	var resp protocol.Response
+	if err := resp.FromJSON([]byte(line)); err != nil {
+		tc.t.Fatalf("FromJSON() error = %v", err)
+	}
+	return &resp
+}
+
+// call sends a command and returns its reply, skipping any events in between
+func (tc *testConn) call(command, data string) *protocol.Response {
+	tc.t.Helper()
+	tc.send(command, data)
+	for {
+		if resp := tc.read(); !resp.IsEvent() {
+			return resp
+		}
+	}
+}
+
+// readEvent returns the next event of the given type, skipping other frames
+func (tc *testConn) readEvent(event string) *protocol.Response {
+	tc.t.Helper()
+	for {
+		if resp := tc.read(); resp.Event == event {
+			return resp
+		}
+	}
+}
+
+func TestBroadcastAndMetrics(t *testing.T) {
+	s := startTestServer(t)
+	alice := dialTestServer(t, s)
+	bob := dialTestServer(t, s)
+
+	alice.call(protocol.CmdRegister, "alice")
+	if resp := alice.call(protocol.CmdMessage, "hello"); !resp.Success {
+		t.Fatalf("MESSAGE failed: %s", resp.String())
+	}
+
+	event := bob.readEvent(protocol.EventMessage)
+	if event.Event != protocol.EventMessage || event.From != "alice" || event.Data != "hello" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+
+	if resp := alice.call("NOPE", ""); resp.Code != protocol.CodeValidation {
+		t.Errorf("Expected VALIDATION error, got %+v", resp)
+	}
+
+	var buf bytes.Buffer
+	s.Metrics().WriteText(&buf)
+	out := buf.String()
+
+	want := []string{
+		"chat_connected_clients 2",
+		"chat_connections_accepted_total 2",
+		`chat_commands_total{command="MESSAGE"} 1`,
+		`chat_errors_total{code="VALIDATION"} 1`,
+		`chat_broadcast_fanout_bucket{le="0"} 0`,
+		`chat_broadcast_fanout_count 2`, // alice's join and her message
+	}
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("Metrics missing %q\n%s", w, out)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"tcp_server/protocol"
+)
+
+// SlashCommand is a command typed into a chat message, e.g. "/join ops"
+// MESSAGE runs it instead of posting the text
+type SlashCommand struct {
+	Name         string  // Name without the slash (e.g., "join"), case-insensitive
+	Usage        string  // Arguments shown in help and usage errors (e.g., "<room>")
+	Help         string  // One-line description
+	RequiresArgs bool    // Answer with the usage if no arguments are given
+	Secret       bool    // Arguments carry credentials (e.g., a session key), so they are never logged
+	Handler      Handler // Called with the arguments in msg.Data
+}
+
+// usage formats the command with its arguments, e.g. "/join <room>"
+func (c SlashCommand) usage() string {
+	if c.Usage == "" {
+		return "/" + c.Name
+	}
+	return "/" + c.Name + " " + c.Usage
+}
+
+// HandleSlash registers a custom slash command
+func (s *Server) HandleSlash(cmd SlashCommand) error {
+	cmd.Name = strings.ToLower(strings.TrimPrefix(cmd.Name, "/"))
+	if cmd.Name == "" || strings.ContainsAny(cmd.Name, " \t") {
+		return fmt.Errorf("invalid slash command name %q", cmd.Name)
+	}
+	if cmd.Handler == nil {
+		return fmt.Errorf("slash command /%s has no handler", cmd.Name)
+	}
+
+	s.slashMu.Lock()
+	defer s.slashMu.Unlock()
+
+	if _, exists := s.slashCommands[cmd.Name]; exists {
+		return fmt.Errorf("slash command /%s is already registered", cmd.Name)
+	}
+	s.slashCommands[cmd.Name] = cmd
+	return nil
+}
+
+// registerSlashCommands registers the slash commands every server supports
+func (s *Server) registerSlashCommands() {
+	builtins := []SlashCommand{
+		{Name: "me", Usage: "<action>", Help: "Describe what you are doing", RequiresArgs: true, Handler: s.handleMe},
+		{Name: "nick", Usage: "<name> [key]", Help: "Change your username", RequiresArgs: true, Secret: true, Handler: s.routeTo(protocol.CmdRegister)},
+		{Name: "join", Usage: "<room>", Help: "Join a room and send your messages there (\"lobby\" to go back)", RequiresArgs: true, Handler: s.routeTo(protocol.CmdJoinRoom)},
+		{Name: "leave", Usage: "<room>", Help: "Leave a room", RequiresArgs: true, Handler: s.routeTo(protocol.CmdLeaveRoom)},
+		{Name: "reply", Usage: "<id> <message>", Help: "Reply in a message's thread", RequiresArgs: true, Handler: s.routeTo(protocol.CmdReply)},
+		{Name: "msg", Usage: "<user> <message>", Help: "Send a private message", RequiresArgs: true, Handler: s.handleMsg},
+		{Name: "search", Usage: "<query>", Help: "Search the message history (try from:, in:, after:, before:, page:)", RequiresArgs: true, Handler: s.routeTo(protocol.CmdSearch)},
+		{Name: "who", Usage: "[room]", Help: "List the users in a room (default: where you are)", Handler: s.handleWho},
+		{Name: "help", Help: "List slash commands", Handler: s.handleSlashHelp},
+	}
+
+	for _, cmd := range builtins {
+		if err := s.HandleSlash(cmd); err != nil {
+			// Built-in names are fixed, so a failure here is a programming error
+			panic(err)
+		}
+	}
+}
+
+// parseSlash splits "/join ops" into its command name and arguments
+// Text that is not a slash command, including "//" which escapes a leading slash, is not ok
+func parseSlash(text string) (name, args string, ok bool) {
+	rest, found := strings.CutPrefix(strings.TrimSpace(text), "/")
+	if !found || rest == "" || strings.HasPrefix(rest, "/") {
+		return "", "", false
+	}
+	name, args, _ = strings.Cut(rest, " ")
+	if name == "" {
+		return "", "", false
+	}
+	return strings.ToLower(name), strings.TrimSpace(args), true
+}
+
+// isSecretSlash reports whether a MESSAGE's text runs a slash command whose arguments
+// must not be logged
+func (s *Server) isSecretSlash(text string) bool {
+	name, _, ok := parseSlash(text)
+	if !ok {
+		return false
+	}
+
+	s.slashMu.RLock()
+	defer s.slashMu.RUnlock()
+	return s.slashCommands[name].Secret
+}
+
+// runSlash runs a slash command typed into a MESSAGE
+func (s *Server) runSlash(client *Client, name, args string) *protocol.Response {
+	s.slashMu.RLock()
+	cmd, ok := s.slashCommands[name]
+	s.slashMu.RUnlock()
+
+	if !ok {
+		response := protocol.NewErrorResponse(protocol.CodeUnknownCommand, fmt.Sprintf("Unknown command /%s, try /help", name))
+		response.Data = s.slashHelp()
+		return response
+	}
+	if cmd.RequiresArgs && args == "" {
+		return protocol.NewErrorResponse(protocol.CodeValidation, "Usage: "+cmd.usage())
+	}
+
+	return cmd.Handler(client, protocol.NewMessage(client.Username(), "/"+cmd.Name, args))
+}
+
+// routeTo makes a slash command run a protocol command with its arguments as data
+// The command's own registration and role requirements still apply
+func (s *Server) routeTo(command string) Handler {
+	return func(client *Client, msg *protocol.Message) *protocol.Response {
+		return s.processCommand(client, protocol.NewMessage(msg.From, command, msg.Data))
+	}
+}
+
+// handleMe posts an action message: "/me waves" shows as "* alice waves"
+func (s *Server) handleMe(client *Client, msg *protocol.Message) *protocol.Response {
+	if s.isMuted(msg.From) {
+		return protocol.NewErrorResponse(protocol.CodeForbidden, "You are muted")
+	}
+
+	id, failed := s.postMessage(StoredMessage{From: msg.From, Room: client.Room(), Content: msg.Data, Action: true}, client)
+	if failed != nil {
+		return failed
+	}
+	return protocol.NewResponse(true, "Message broadcasted", strconv.FormatUint(id, 10))
+}
+
+// handleMsg sends "/msg bob hi" as a private message
+func (s *Server) handleMsg(client *Client, msg *protocol.Message) *protocol.Response {
+	to, text, _ := strings.Cut(msg.Data, " ")
+	return s.processCommand(client, protocol.NewMessage(msg.From, protocol.CmdPrivateMessage, to+":"+text))
+}
+
+// handleWho lists the members of a room, or everyone online for the lobby
+func (s *Server) handleWho(client *Client, msg *protocol.Message) *protocol.Response {
+	room := client.Room()
+	if msg.Data != "" {
+		if room = normalizeRoom(msg.Data); room == lobbyName {
+			room = ""
+		}
+	}
+	if room == "" {
+		return protocol.NewResponse(true, "Users in the lobby", strings.Join(s.getConnectedUsers(), ", "))
+	}
+
+	s.mu.RLock()
+	var members []string
+	for name, u := range s.users {
+		if u.rooms[room] {
+			members = append(members, name)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(members) == 0 {
+		return protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("Nobody is in %s", displayRoom(room)))
+	}
+	sort.Strings(members)
+	return protocol.NewResponse(true, fmt.Sprintf("Users in %s", displayRoom(room)), strings.Join(members, ", "))
+}
+
+// handleSlashHelp lists the slash commands
+func (s *Server) handleSlashHelp(client *Client, msg *protocol.Message) *protocol.Response {
+	return protocol.NewResponse(true, "Slash commands", s.slashHelp())
+}
+
+// slashHelp formats every slash command with its usage, one per line
+func (s *Server) slashHelp() string {
+	s.slashMu.RLock()
+	defer s.slashMu.RUnlock()
+
+	names := make([]string, 0, len(s.slashCommands))
+	for name := range s.slashCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		cmd := s.slashCommands[name]
+		lines[i] = fmt.Sprintf("%s - %s", cmd.usage(), cmd.Help)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+)
+
+func TestSlashCommands(t *testing.T) {
+	s := startTestServer(t)
+	alice := dialTestServer(t, s)
+	alice.call(protocol.CmdRegister, "alice")
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+
+	// /join and /who route to the room handlers
+	if resp := alice.call(protocol.CmdMessage, "/join #ops"); !resp.Success || resp.Data != "ops" {
+		t.Fatalf("/join = %+v", resp)
+	}
+	bob.call(protocol.CmdMessage, "/JOIN ops")
+	if resp := alice.call(protocol.CmdMessage, "/who"); resp.Data != "alice, bob" {
+		t.Errorf("/who = %+v", resp)
+	}
+
+	// /me posts an action to the active room
+	alice.call(protocol.CmdMessage, "/me deploys v2")
+	event := bob.readEvent(protocol.EventMessage)
+	if event.Room != "ops" || event.Data != "deploys v2" || !strings.Contains(event.Message, "* alice deploys v2") {
+		t.Errorf("/me event = %+v", event)
+	}
+
+	// "//" escapes a leading slash
+	alice.call(protocol.CmdMessage, "//etc/hosts is wrong")
+	if event := bob.readEvent(protocol.EventMessage); event.Data != "/etc/hosts is wrong" {
+		t.Errorf("Escaped message = %+v", event)
+	}
+	if resp := bob.call(protocol.CmdListMessages, ""); !strings.Contains(resp.Data, "* alice deploys v2") || !strings.Contains(resp.Data, "alice: /etc/hosts") {
+		t.Errorf("History:\n%s", resp.Data)
+	}
+
+	// /nick renames through REGISTER
+	if resp := alice.call(protocol.CmdMessage, "/nick alicia"); !resp.Success {
+		t.Fatalf("/nick = %+v", resp)
+	}
+	if event := bob.readEvent(protocol.EventRename); event.From != "alicia" {
+		t.Errorf("Rename event = %+v", event)
+	}
+
+	// Missing arguments and unknown commands answer with help
+	if resp := alice.call(protocol.CmdMessage, "/join"); resp.Code != protocol.CodeValidation || resp.Message != "Usage: /join <room>" {
+		t.Errorf("/join without a room = %+v", resp)
+	}
+	resp := alice.call(protocol.CmdMessage, "/dance")
+	if resp.Code != protocol.CodeUnknownCommand || !strings.Contains(resp.Data, "/me <action>") {
+		t.Errorf("/dance = %+v", resp)
+	}
+
+	// Custom commands are listed in the help and run like built-in ones
+	err := s.HandleSlash(SlashCommand{Name: "shrug", Help: "Shrug", Handler: func(client *Client, msg *protocol.Message) *protocol.Response {
+		return protocol.NewResponse(true, "Shrugged", msg.From+` ¯\_(ツ)_/¯ `+msg.Data)
+	}})
+	if err != nil {
+		t.Fatalf("HandleSlash() error = %v", err)
+	}
+	if err := s.HandleSlash(SlashCommand{Name: "/Shrug", Handler: func(*Client, *protocol.Message) *protocol.Response { return nil }}); err == nil {
+		t.Error("Expected an error registering /shrug twice")
+	}
+	if resp := alice.call(protocol.CmdMessage, "/shrug whatever"); resp.Data != `alicia ¯\_(ツ)_/¯ whatever` {
+		t.Errorf("/shrug = %+v", resp)
+	}
+	if resp := alice.call(protocol.CmdMessage, "/help"); !strings.Contains(resp.Data, "/shrug - Shrug") {
+		t.Errorf("/help = %+v", resp)
+	}
+}
+
+func TestSlashSecretsNotLogged(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewServer(":0", WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+	client := &Client{conn: conn}
+
+	// /nick runs REGISTER, whose key must stay out of the logs like REGISTER's own
+	s.dispatch(client, &protocol.Message{Command: protocol.CmdMessage, Data: "/nick alice hunter2"})
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("/nick key was logged:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "data_len=19") {
+		t.Errorf("Expected the data length to be logged instead:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"tcp_server/protocol"
+	"time"
+)
+
+const (
+	sseKeepAlive = 15 * time.Second // Comment lines keep idle streams open through proxies
+	sseBuffer    = 256              // Events waiting for a slow stream before it is cut off
+)
+
+// sseEvents are the event types streamed to dashboards
+var sseEvents = map[string]bool{
+	protocol.EventMessage: true,
+	protocol.EventJoin:    true,
+	protocol.EventLeave:   true,
+}
+
+// handleEventStream streams messages, joins and leaves as Server-Sent Events:
+//
+//	GET /api/events?room=ops&user=alice
+//
+// Each event's id is its sequence number; a reconnecting EventSource sends it back as
+// Last-Event-ID and gets the events it missed before live ones (the last streamReplaySize,
+// and older messages from the history)
+// Browsers can't set headers on EventSource, so the bot token may also be ?token=
+func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if _, ok := s.botForToken(token); !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chat"`)
+		writeAPIResponse(w, protocol.NewErrorResponse(protocol.CodeAuthRequired, "Missing or invalid bot token"))
+		return
+	}
+
+	// Filters: a room ("lobby" for the lobby) and/or a user
+	query := r.URL.Query()
+	roomFilter, hasRoom := query.Get("room"), query.Has("room")
+	if roomFilter = normalizeRoom(roomFilter); roomFilter == lobbyName {
+		roomFilter = ""
+	}
+	userFilter := query.Get("user")
+	match := func(room, from string) bool {
+		return (!hasRoom || room == roomFilter) && (userFilter == "" || from == userFilter)
+	}
+
+	var lastSeq uint64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			writeAPIResponse(w, protocol.NewErrorResponse(protocol.CodeValidation, "Invalid Last-Event-ID"))
+			return
+		}
+		lastSeq = n
+	}
+
+	// Subscribe before reading the history so no event falls in between
+	events := make(chan *protocol.Response, sseBuffer)
+	overflow := make(chan struct{})
+	var overflowOnce sync.Once
+	cancel := s.Subscribe(func(event *protocol.Response) {
+		if !sseEvents[event.Event] || !match(event.Room, event.From) {
+			return
+		}
+		select {
+		case events <- event:
+		default:
+			overflowOnce.Do(func() { close(overflow) })
+		}
+	})
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sent := lastSeq
+	if lastSeq > 0 {
+		for _, event := range s.streamedSince(lastSeq, match) {
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+			sent = event.Seq
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		s.logger.Warn("event stream unsupported", "error", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.quit:
+			return
+		case <-overflow:
+			// The client reconnects with Last-Event-ID and catches up
+			s.logger.Warn("event stream too slow, closing", "remote_addr", r.RemoteAddr)
+			return
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case event := <-events:
+			if event.Seq <= sent {
+				continue // Already replayed
+			}
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+			sent = event.Seq
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeSSE writes an event as one Server-Sent Event with the protocol JSON as data
+func writeSSE(w io.Writer, event *protocol.Response) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Event, data)
+	return err
+}
+
+// requestToken returns the bearer token of a request ("" if none)
+func requestToken(r *http.Request) string {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return strings.TrimSpace(token)
+}
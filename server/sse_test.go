@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+)
+
+// sseEvent is one parsed Server-Sent Event
+type sseEvent struct {
+	id    string
+	event *protocol.Response
+}
+
+// readSSE reads the next event from a stream, skipping comments
+func readSSE(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var ev sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() error = %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && ev.event != nil:
+			return ev
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.event = &protocol.Response{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), ev.event); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	s := startTestServer(t, WithBotTokens(map[string]string{"s3cret": "dashboard"}))
+	api := httptest.NewServer(s.APIHandler())
+	t.Cleanup(api.Close)
+
+	open := func(query, lastID string) *bufio.Reader {
+		t.Helper()
+		req, _ := http.NewRequest("GET", api.URL+"/api/events?token=s3cret&"+query, nil)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /api/events error = %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("GET /api/events = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		return bufio.NewReader(resp.Body)
+	}
+
+	if resp, err := http.Get(api.URL + "/api/events"); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("GET /api/events without a token = %v %v, want 401", resp.StatusCode, err)
+	}
+
+	ops := open("room=ops", "")
+	alice := dialTestServer(t, s)
+	alice.call(protocol.CmdRegister, "alice")
+	alice.call(protocol.CmdJoinRoom, "ops")
+	if ev := readSSE(t, ops); ev.event.Event != protocol.EventJoin || ev.event.From != "alice" {
+		t.Errorf("First ops event = %+v, want alice joining", ev.event)
+	}
+
+	alice.call(protocol.CmdMessage, "first")
+	first := readSSE(t, ops)
+	if first.event.Event != protocol.EventMessage || first.event.Data != "first" || first.event.Room != "ops" {
+		t.Errorf("Message event = %+v", first.event)
+	}
+	alice.call(protocol.CmdMessage, "second")
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+	bob.call(protocol.CmdJoinRoom, "ops")
+	alice.call(protocol.CmdMessage, "third")
+
+	// Resuming after the first message replays everything missed, joins included
+	resumed := open("room=ops", first.id)
+	for _, want := range []string{"message second", "join bob", "message third"} {
+		ev := readSSE(t, resumed)
+		got := ev.event.Event + " " + ev.event.Data
+		if ev.event.Event == protocol.EventJoin {
+			got = ev.event.Event + " " + ev.event.From
+		}
+		if got != want {
+			t.Errorf("Replayed %+v, want %q", ev.event, want)
+		}
+	}
+
+	// ...and then continues live
+	alice.call(protocol.CmdMessage, "fourth")
+	if ev := readSSE(t, resumed); ev.event.Data != "fourth" {
+		t.Errorf("Live event after replay = %+v, want fourth", ev.event)
+	}
+
+	// Before the replay buffer, only messages can be replayed, from the history
+	s.deliverMu.Lock()
+	s.streamed = s.streamed[len(s.streamed)-1:]
+	s.deliverMu.Unlock()
+	var replayed []string
+	for _, event := range s.streamedSince(0, func(room, from string) bool { return room == "ops" }) {
+		replayed = append(replayed, event.Data)
+	}
+	if got := strings.Join(replayed, ","); got != "first,second,third,fourth" {
+		t.Errorf("Replayed from the history and buffer: %s", got)
+	}
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"tcp_server/metrics"
+)
+
+// MessageStore keeps messages durably so history and the search index survive restarts
+// The server saves from a single background goroutine, in the order changes happened
+type MessageStore interface {
+	Save(msg StoredMessage) error           // Record a new message or a new version of one (edit, delete, reaction)
+	Load() ([]StoredMessage, error)         // The latest version of every message, oldest first
+	Compact(messages []StoredMessage) error // Replace everything stored with these messages
+	Clear() error                           // Forget every message
+}
+
+// syncer is implemented by stores that can flush saved messages to stable storage
+type syncer interface {
+	Sync() error
+}
+
+// FileMessageStore is a MessageStore appending one JSON line per saved version to a file
+type FileMessageStore struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// OpenFileMessageStore opens (or creates) a message log file
+func OpenFileMessageStore(path string) (*FileMessageStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileMessageStore{path: path, file: file}, nil
+}
+
+// Save appends a message version
+func (f *FileMessageStore) Save(msg StoredMessage) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.file.Write(append(line, '\n'))
+	return err
+}
+
+// Load reads the log, keeping the last version of each message
+func (f *FileMessageStore) Load() ([]StoredMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	latest := make(map[uint64]StoredMessage)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var msg StoredMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", f.path, line, err)
+		}
+		latest[msg.ID] = msg
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	messages := make([]StoredMessage, 0, len(latest))
+	for _, msg := range latest {
+		messages = append(messages, msg)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages, nil
+}
+
+// Compact rewrites the log with one line per message, replacing the file atomically
+func (f *FileMessageStore) Compact(messages []StoredMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".compact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+
+	w := bufio.NewWriter(tmp)
+	for _, msg := range messages {
+		line, err := json.Marshal(msg)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+
+	// Appends go to the new file from now on
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	f.file.Close()
+	f.file = file
+	return nil
+}
+
+// Sync flushes the log to disk
+func (f *FileMessageStore) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Sync()
+}
+
+// Clear truncates the log
+func (f *FileMessageStore) Clear() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Truncate(0)
+}
+
+// Close closes the log file
+func (f *FileMessageStore) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// storeOp is a queued change for the message store
+type storeOp struct {
+	msg   StoredMessage
+	clear bool // Forget every message instead of saving msg
+}
+
+// storeQueueSize is how many changes may wait for a slow store before new ones are dropped
+const storeQueueSize = 4096
+
+// storeQueue saves messages in the background so disk I/O never runs under s.mu
+// Changes are queued under s.mu, so they reach the store in the order they happened
+type storeQueue struct {
+	store   MessageStore
+	logger  *slog.Logger
+	dropped *metrics.Counter
+
+	mu     sync.Mutex
+	ops    []storeOp
+	lost   int // Changes dropped since the writer last logged them
+	closed bool
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+// newStoreQueue starts saving to store, counting changes it has to drop in dropped
+func newStoreQueue(store MessageStore, logger *slog.Logger, dropped *metrics.Counter) *storeQueue {
+	q := &storeQueue{store: store, logger: logger, dropped: dropped, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go q.run()
+	return q
+}
+
+// save queues a message version
+func (q *storeQueue) save(msg StoredMessage) {
+	q.push(storeOp{msg: msg})
+}
+
+// clear queues forgetting every message
+func (q *storeQueue) clear() {
+	q.push(storeOp{clear: true})
+}
+
+// push queues op, dropping it if the queue is full or already closed
+func (q *storeQueue) push(op storeOp) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch {
+	case q.closed:
+		// The writer has stopped, so nobody would log the loss later
+		q.dropped.Inc()
+		q.logger.Error("message store closed, change dropped", "id", op.msg.ID, "clear", op.clear)
+		return
+	case len(q.ops) >= storeQueueSize:
+		q.dropped.Inc()
+		q.lost++
+	default:
+		q.ops = append(q.ops, op)
+	}
+	q.signal()
+}
+
+func (q *storeQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close writes everything still queued and stops the writer
+func (q *storeQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.signal()
+	<-q.done
+}
+
+// run applies queued changes in batches, syncing after each batch
+func (q *storeQueue) run() {
+	defer close(q.done)
+
+	for range q.wake {
+		q.mu.Lock()
+		ops, lost, closed := q.ops, q.lost, q.closed
+		q.ops, q.lost = nil, 0
+		q.mu.Unlock()
+
+		if lost > 0 {
+			q.logger.Error("message store queue full, changes dropped", "dropped", lost)
+		}
+		for _, op := range ops {
+			if op.clear {
+				if err := q.store.Clear(); err != nil {
+					q.logger.Error("clear message store failed", "error", err)
+				}
+			} else if err := q.store.Save(op.msg); err != nil {
+				q.logger.Error("save message failed", "id", op.msg.ID, "error", err)
+			}
+		}
+		if s, ok := q.store.(syncer); ok && len(ops) > 0 {
+			if err := s.Sync(); err != nil {
+				q.logger.Error("sync message store failed", "error", err)
+			}
+		}
+		if closed {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"slices"
+	"tcp_server/protocol"
+)
+
+// streamReplaySize is how many recent event stream events are kept for reconnecting streams
+const streamReplaySize = 1024
+
+// Subscribe calls fn with every event delivered to sessions (messages, joins, leaves,
+// presence, private messages...) in sequence order, until cancel is called
+// fn runs while events are being delivered: it must not block or call back into the
+// server, and must not modify the event
+func (s *Server) Subscribe(fn func(event *protocol.Response)) (cancel func()) {
+	s.deliverMu.Lock()
+	defer s.deliverMu.Unlock()
+
+	if s.subscribers == nil {
+		s.subscribers = make(map[uint64]func(*protocol.Response))
+	}
+	s.nextSubscriber++
+	id := s.nextSubscriber
+	s.subscribers[id] = fn
+
+	return func() {
+		s.deliverMu.Lock()
+		defer s.deliverMu.Unlock()
+		delete(s.subscribers, id)
+	}
+}
+
+// messagesSince returns stored messages with events numbered after seq, oldest first
+// Deleted messages are left out
+func (s *Server) messagesSince(seq uint64, accept func(StoredMessage) bool) []StoredMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []StoredMessage
+	for _, msg := range s.messages {
+		if msg.Seq > seq && !msg.Deleted && accept(msg) {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// recordStreamedLocked keeps an event stream event for streams that reconnect with Last-Event-ID
+// The caller must hold deliverMu
+func (s *Server) recordStreamedLocked(event *protocol.Response) {
+	if !sseEvents[event.Event] {
+		return
+	}
+	if len(s.streamed) == streamReplaySize {
+		s.streamed = append(s.streamed[:0], s.streamed[1:]...)
+	}
+	s.streamed = append(s.streamed, event)
+}
+
+// streamedSince returns the event stream events numbered after seq, oldest first
+// Messages older than the replay buffer come from the history, so only joins and leaves
+// that long ago are lost
+func (s *Server) streamedSince(seq uint64, accept func(room, from string) bool) []*protocol.Response {
+	s.deliverMu.Lock()
+	recent := slices.Clone(s.streamed)
+	s.deliverMu.Unlock()
+
+	var events []*protocol.Response
+	if len(recent) == 0 || recent[0].Seq > seq+1 {
+		for _, msg := range s.messagesSince(seq, func(m StoredMessage) bool {
+			return (len(recent) == 0 || m.Seq < recent[0].Seq) && accept(m.Room, m.From)
+		}) {
+			events = append(events, msg.event())
+		}
+	}
+	for _, event := range recent {
+		if event.Seq > seq && accept(event.Room, event.From) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
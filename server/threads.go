@@ -0,0 +1,163 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"tcp_server/protocol"
+)
+
+// threadPageSize is how many replies THREAD returns per page
+const threadPageSize = 20
+
+// addReplyLocked counts a reply on its thread's first message and makes its sender a follower
+// The caller must hold s.mu
+func (s *Server) addReplyLocked(reply StoredMessage) {
+	if parent, ok := s.messageLocked(reply.ReplyTo); ok {
+		parent.Replies++
+	}
+	s.followLocked(reply.ReplyTo, reply.From)
+}
+
+// followLocked makes a user follow a thread; the caller must hold s.mu
+func (s *Server) followLocked(thread uint64, user string) {
+	if s.followers[thread] == nil {
+		s.followers[thread] = make(map[string]bool)
+	}
+	s.followers[thread][user] = true
+}
+
+// followingLocked accepts the sessions of a thread's followers who can see its room, except one
+// The caller must hold s.mu
+func (s *Server) followingLocked(thread uint64, room string, except *Client) func(c *Client) bool {
+	followers := s.followers[thread]
+	visible := inRoom(room, except)
+	return func(c *Client) bool {
+		u := c.User()
+		return u != nil && followers[u.name] && visible(c)
+	}
+}
+
+// threadRootLocked returns the first message of the thread a visible message belongs to
+// The caller must hold s.mu
+func (s *Server) threadRootLocked(client *Client, data string) (*StoredMessage, *protocol.Response) {
+	idText, _, _ := strings.Cut(data, " ")
+	id, ok := parseMessageID(idText)
+	if !ok {
+		return nil, protocol.NewErrorResponse(protocol.CodeValidation, fmt.Sprintf("Invalid message ID: %s", idText))
+	}
+
+	m, ok := s.findMessageLocked(client, id)
+	if ok && m.ReplyTo != 0 {
+		// Replies to a reply go to the same thread
+		m, ok = s.findMessageLocked(client, m.ReplyTo)
+	}
+	if !ok {
+		return nil, protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("No message %d in the history", id))
+	}
+	return m, nil
+}
+
+// handleReply posts a reply in a message's thread ("id text")
+// The thread's author and everyone who replies follow it; replies reach only its followers
+func (s *Server) handleReply(client *Client, msg *protocol.Message) *protocol.Response {
+	_, text, _ := strings.Cut(msg.Data, " ")
+	if text = strings.TrimSpace(text); text == "" {
+		return protocol.NewErrorResponse(protocol.CodeValidation, "Usage: REPLY id text")
+	}
+
+	from := client.Username()
+	if s.isMuted(from) {
+		return protocol.NewErrorResponse(protocol.CodeForbidden, "You are muted")
+	}
+
+	s.mu.Lock()
+	root, failed := s.threadRootLocked(client, msg.Data)
+	var thread uint64
+	var room string
+	if failed == nil {
+		thread, room = root.ID, root.Room
+		s.followLocked(thread, root.From)
+	}
+	s.mu.Unlock()
+	if failed != nil {
+		return failed
+	}
+
+	id, failed := s.postMessage(StoredMessage{From: from, Room: room, Content: text, ReplyTo: thread}, client)
+	if failed != nil {
+		return failed
+	}
+	return protocol.NewResponse(true, fmt.Sprintf("Replied in thread %d", thread), strconv.FormatUint(id, 10))
+}
+
+// handleThread lists a thread's first message and one page of its replies ("id [page]")
+func (s *Server) handleThread(client *Client, msg *protocol.Message) *protocol.Response {
+	page := 1
+	if _, pageText, ok := strings.Cut(msg.Data, " "); ok {
+		n, err := strconv.Atoi(strings.TrimSpace(pageText))
+		if err != nil || n < 1 {
+			return protocol.NewErrorResponse(protocol.CodeValidation, "Usage: THREAD id [page]")
+		}
+		page = n
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	root, failed := s.threadRootLocked(client, msg.Data)
+	if failed != nil {
+		return failed
+	}
+
+	var replies []StoredMessage
+	for _, m := range s.messages {
+		if m.ReplyTo == root.ID {
+			replies = append(replies, m)
+		}
+	}
+
+	pages := max((len(replies)+threadPageSize-1)/threadPageSize, 1)
+	if page > pages {
+		return protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("Thread %d has %d page(s)", root.ID, pages))
+	}
+	start := (page - 1) * threadPageSize
+	end := min(start+threadPageSize, len(replies))
+
+	lines := []string{root.historyLine()}
+	for _, m := range replies[start:end] {
+		lines = append(lines, "  "+m.historyLine())
+	}
+	return protocol.NewResponse(true,
+		fmt.Sprintf("Thread %d: %d repl%s (page %d of %d)", root.ID, len(replies), plural(len(replies), "y", "ies"), page, pages),
+		strings.Join(lines, "\n"))
+}
+
+// handleFollow makes the caller receive a thread's replies as events ("id")
+func (s *Server) handleFollow(client *Client, msg *protocol.Message) *protocol.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	root, failed := s.threadRootLocked(client, msg.Data)
+	if failed != nil {
+		return failed
+	}
+	s.followLocked(root.ID, client.Username())
+	return protocol.NewResponse(true, fmt.Sprintf("Following thread %d", root.ID), "")
+}
+
+// handleUnfollow stops the caller receiving a thread's replies ("id")
+func (s *Server) handleUnfollow(client *Client, msg *protocol.Message) *protocol.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	root, failed := s.threadRootLocked(client, msg.Data)
+	if failed != nil {
+		return failed
+	}
+	if !s.followers[root.ID][client.Username()] {
+		return protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("You are not following thread %d", root.ID))
+	}
+	delete(s.followers[root.ID], client.Username())
+	return protocol.NewResponse(true, fmt.Sprintf("Stopped following thread %d", root.ID), "")
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+)
+
+func TestThreads(t *testing.T) {
+	s := startTestServer(t)
+	alice := dialTestServer(t, s)
+	alice.call(protocol.CmdRegister, "alice")
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+	carol := dialTestServer(t, s)
+	carol.call(protocol.CmdRegister, "carol")
+
+	root := alice.call(protocol.CmdMessage, "release notes?").Data
+
+	// A reply reaches the thread's author but not the rest of the room
+	resp := bob.call(protocol.CmdReply, root+" drafting them now")
+	if !resp.Success {
+		t.Fatalf("REPLY = %+v", resp)
+	}
+	event := alice.readEvent(protocol.EventReply)
+	if event.Data != "drafting them now" || formatID(event.ReplyTo) != root || event.ID == 0 {
+		t.Errorf("Reply event = %+v", event)
+	}
+
+	// Carol follows; a reply to a reply stays in the same thread
+	if resp := carol.call(protocol.CmdFollow, resp.Data); !resp.Success {
+		t.Fatalf("FOLLOW = %+v", resp)
+	}
+	alice.call(protocol.CmdReply, resp.Data+" thanks")
+	for _, tc := range []*testConn{bob, carol} {
+		if event := tc.readEvent(protocol.EventReply); event.Data != "thanks" || formatID(event.ReplyTo) != root {
+			t.Errorf("Reply event = %+v", event)
+		}
+	}
+	carol.call(protocol.CmdUnfollow, root)
+
+	// The main history hides replies and counts them
+	alice.call(protocol.CmdMessage, "lunch?")
+	if event := carol.readEvent(protocol.EventMessage); event.Data != "lunch?" {
+		t.Errorf("carol got %+v after unfollowing, want the next room message", event)
+	}
+	history := carol.call(protocol.CmdListMessages, "").Data
+	if !strings.Contains(history, "alice: release notes? (2 replies)") || strings.Contains(history, "thanks") {
+		t.Errorf("History:\n%s", history)
+	}
+
+	// THREAD pages through the replies
+	for i := range threadPageSize {
+		bob.call(protocol.CmdReply, fmt.Sprintf("%s reply %d", root, i))
+	}
+	first := carol.call(protocol.CmdThread, root)
+	if first.Message != "Thread "+root+": 22 replies (page 1 of 2)" || !strings.Contains(first.Data, "bob: drafting them now") {
+		t.Errorf("THREAD page 1 = %s\n%s", first.Message, first.Data)
+	}
+	second := carol.call(protocol.CmdThread, root+" 2")
+	if lines := strings.Split(second.Data, "\n"); len(lines) != 3 || !strings.Contains(lines[0], "release notes?") || !strings.HasSuffix(lines[2], "bob: reply 19") {
+		t.Errorf("THREAD page 2 = %s\n%s", second.Message, second.Data)
+	}
+	if resp := carol.call(protocol.CmdThread, root+" 3"); resp.Code != protocol.CodeNotFound {
+		t.Errorf("THREAD page 3 = %+v", resp)
+	}
+
+	// Deleted replies no longer count, and only the thread's followers hear about it
+	bob.call(protocol.CmdDelete, resp.Data)
+	if event := alice.readEvent(protocol.EventDelete); formatID(event.ID) != resp.Data {
+		t.Errorf("Delete event = %+v", event)
+	}
+	alice.call(protocol.CmdMessage, "done")
+	if event := carol.read(); event.Event != protocol.EventMessage || event.Data != "done" {
+		t.Errorf("carol got %+v, want the next room message", event)
+	}
+	if history := carol.call(protocol.CmdListMessages, "").Data; !strings.Contains(history, "(21 replies)") {
+		t.Errorf("History after deleting a reply:\n%s", history)
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"tcp_server/protocol"
+	"time"
+)
+
+// User is an identity shared by every session registered under the same username
+// Presence and room memberships belong to the user, not to a single connection
+type User struct {
+	name     string
+	key      string               // Secret another connection needs to register as this user
+	sessions map[*Client]struct{} // Connected sessions (guarded by Server.mu)
+	rooms    map[string]bool      // Joined rooms (guarded by Server.mu)
+
+	mu         sync.Mutex
+	status     string    // Presence status (one of the Status* constants)
+	statusText string    // Optional presence text
+	autoAway   bool      // Whether the idle timer set the user away
+	lastActive time.Time // When any session last sent a command
+}
+
+// newUser creates a user with no sessions
+func newUser(name string) *User {
+	return &User{
+		name:       name,
+		key:        newUserKey(),
+		sessions:   make(map[*Client]struct{}),
+		rooms:      make(map[string]bool),
+		status:     StatusOnline,
+		lastActive: time.Now(),
+	}
+}
+
+// Name returns the user's username
+func (u *User) Name() string {
+	return u.name
+}
+
+// newUserKey returns a random secret for adding sessions to a user
+func newUserKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newSessionID returns a short random identifier for a session
+func newSessionID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SessionID returns the identifier of this connection among its user's sessions
+func (c *Client) SessionID() string {
+	return c.sessionID
+}
+
+// User returns the identity the client registered as (nil until REGISTER)
+func (c *Client) User() *User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.user
+}
+
+// errNameInUse is returned when registering an online username without its key
+var errNameInUse = errors.New("username is in use")
+
+// attachUser moves a client to the user named name, creating the user if needed
+// Joining a user that is already online requires its key, so nobody can take over a name
+// It returns whether the user is new and the previous user if that one has no sessions left
+func (s *Server) attachUser(client *Client, name, key string) (joined bool, left *User, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client.mu.Lock()
+	old := client.user
+	client.mu.Unlock()
+
+	if old != nil && old.name == name {
+		return false, nil, nil
+	}
+
+	u, exists := s.users[name]
+	if exists && subtle.ConstantTimeCompare([]byte(key), []byte(u.key)) != 1 {
+		return false, nil, errNameInUse
+	}
+	if old != nil {
+		left = s.detachLocked(client, old)
+	}
+	if !exists {
+		u = newUser(name)
+		s.users[name] = u
+		joined = true
+	}
+	u.sessions[client] = struct{}{}
+
+	client.mu.Lock()
+	client.user = u
+	client.username = name
+	client.registered = true
+	client.room = "" // Room memberships belong to the previous user
+	if client.resumeToken == "" && s.resumeWindow > 0 {
+		client.resumeToken = newResumeToken()
+	}
+	client.mu.Unlock()
+
+	return joined, left, nil
+}
+
+// detachLocked removes a session from its user; the caller must hold s.mu
+// It returns the user if that was its last session (the user is then forgotten)
+func (s *Server) detachLocked(client *Client, u *User) *User {
+	delete(u.sessions, client)
+	if len(u.sessions) > 0 {
+		return nil
+	}
+	delete(s.users, u.name)
+	return u
+}
+
+// lookupUser returns the user registered under name
+func (s *Server) lookupUser(name string) (*User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[name]
+	return u, ok
+}
+
+// sessionsOf returns a user's connected sessions, oldest first
+func (s *Server) sessionsOf(u *User) []*Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make([]*Client, 0, len(u.sessions))
+	for c := range u.sessions {
+		sessions = append(sessions, c)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].connectedAt.Before(sessions[j].connectedAt) })
+	return sessions
+}
+
+// getConnectedUsers returns each registered username once, plus "anonymous" if any
+// connection has not registered yet
+func (s *Server) getConnectedUsers() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]string, 0, len(s.users)+1)
+	for name := range s.users {
+		users = append(users, name)
+	}
+	sort.Strings(users)
+
+	for _, client := range s.clients {
+		if !client.IsRegistered() {
+			users = append(users, "anonymous")
+			break
+		}
+	}
+	return users
+}
+
+// handleSessions lists the caller's sessions
+func (s *Server) handleSessions(client *Client, msg *protocol.Message) *protocol.Response {
+	u := client.User()
+
+	var result strings.Builder
+	for i, c := range s.sessionsOf(u) {
+		if i > 0 {
+			result.WriteString("\n")
+		}
+		result.WriteString(fmt.Sprintf("%s %s connected %s", c.sessionID, c.RemoteAddr(),
+			c.connectedAt.Format(time.RFC3339)))
+		if c == client {
+			result.WriteString(" (this session)")
+		}
+		if s.isParked(c) {
+			result.WriteString(" (disconnected, resumable)")
+		}
+	}
+	response := protocol.NewResponse(true, fmt.Sprintf("Your sessions (add one with REGISTER %s %s)", u.name, u.key), result.String())
+	response.Key = u.key
+	return response
+}
+
+// handleKillSession disconnects another session of the caller's user
+func (s *Server) handleKillSession(client *Client, msg *protocol.Message) *protocol.Response {
+	id := strings.TrimSpace(msg.Data)
+	if id == client.sessionID {
+		return protocol.NewErrorResponse(protocol.CodeValidation, "Use QUIT to end the current session")
+	}
+
+	for _, c := range s.sessionsOf(client.User()) {
+		if c.sessionID == id {
+			s.kick(c, fmt.Sprintf("Session terminated from %s", client.RemoteAddr()))
+			return protocol.NewResponse(true, fmt.Sprintf("Session %s terminated", id), "")
+		}
+	}
+	return protocol.NewErrorResponse(protocol.CodeNotFound, fmt.Sprintf("No session %s", id))
+}
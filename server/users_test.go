@@ -0,0 +1,131 @@
+package server
+
+import (
+	"strings"
+	"tcp_server/protocol"
+	"testing"
+)
+
+func TestMultipleSessions(t *testing.T) {
+	s := startTestServer(t)
+	laptop := dialTestServer(t, s)
+	key := laptop.call(protocol.CmdRegister, "alice").Key
+
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+
+	// An online username can't be taken over without its key
+	mallory := dialTestServer(t, s)
+	for _, data := range []string{"alice", "alice wrong-key"} {
+		if resp := mallory.call(protocol.CmdRegister, data); resp.Code != protocol.CodeForbidden {
+			t.Fatalf("Expected REGISTER %s to be refused, got %+v", data, resp)
+		}
+	}
+
+	// A second session for alice is not a new arrival
+	phone := dialTestServer(t, s)
+	if resp := phone.call(protocol.CmdRegister, "alice "+key); !resp.Success || resp.Key != key {
+		t.Fatalf("REGISTER with the key failed: %+v", resp)
+	}
+
+	resp := bob.call(protocol.CmdListUsers, protocol.ListUsersWithStatus)
+	if strings.Count(resp.Data, "alice - ") != 1 || !strings.Contains(resp.Data, "2 sessions") {
+		t.Errorf("Expected one alice entry with 2 sessions:\n%s", resp.Data)
+	}
+
+	// Private messages reach every session of the recipient
+	if resp := bob.call(protocol.CmdPrivateMessage, "alice:hi"); !resp.Success {
+		t.Fatalf("PM failed: %+v", resp)
+	}
+	for _, tc := range []*testConn{laptop, phone} {
+		if event := tc.readEvent(protocol.EventPrivateMessage); event.From != "bob" || event.Data != "hi" {
+			t.Errorf("Unexpected private message event: %+v", event)
+		}
+	}
+
+	resp = phone.call(protocol.CmdSessions, "")
+	lines := strings.Split(resp.Data, "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[1], "(this session)") {
+		t.Fatalf("Unexpected sessions listing:\n%s", resp.Data)
+	}
+
+	// Killing the laptop session leaves alice online through her phone
+	laptopID := strings.Fields(lines[0])[0]
+	if resp := phone.call(protocol.CmdKillSession, laptopID); !resp.Success {
+		t.Fatalf("KILL_SESSION failed: %+v", resp)
+	}
+	laptop.readEvent(protocol.EventKicked)
+
+	if resp := phone.call(protocol.CmdKillSession, laptopID); resp.Code != protocol.CodeNotFound {
+		t.Errorf("Expected NOT_FOUND for a dead session, got %+v", resp)
+	}
+	if resp := bob.call(protocol.CmdPrivateMessage, "alice:still there?"); !resp.Success {
+		t.Errorf("Expected alice to stay online, got %+v", resp)
+	}
+}
+
+func TestRooms(t *testing.T) {
+	s := startTestServer(t)
+	alice := dialTestServer(t, s)
+	alice.call(protocol.CmdRegister, "alice")
+	bob := dialTestServer(t, s)
+	bob.call(protocol.CmdRegister, "bob")
+	carol := dialTestServer(t, s)
+	carol.call(protocol.CmdRegister, "carol")
+
+	alice.call(protocol.CmdJoinRoom, "#ops")
+	bob.call(protocol.CmdJoinRoom, "ops")
+
+	if resp := alice.call(protocol.CmdMessage, "deploying"); !resp.Success {
+		t.Fatalf("MESSAGE failed: %+v", resp)
+	}
+	event := bob.readEvent(protocol.EventMessage)
+	if event.Room != "ops" || event.Data != "deploying" {
+		t.Errorf("Unexpected room message: %+v", event)
+	}
+
+	// Carol stays in the lobby and sees neither the room message nor its history
+	carol.call(protocol.CmdMessage, "hello lobby")
+	if event := bob.readEvent(protocol.EventMessage); event.Room != "" || event.Data != "hello lobby" {
+		t.Errorf("Expected lobby message, got %+v", event)
+	}
+	if resp := carol.call(protocol.CmdListMessages, ""); strings.Contains(resp.Data, "deploying") {
+		t.Errorf("Room history leaked into the lobby:\n%s", resp.Data)
+	}
+	if resp := bob.call(protocol.CmdListMessages, ""); !strings.Contains(resp.Data, "deploying") {
+		t.Errorf("Room history missing:\n%s", resp.Data)
+	}
+
+	if resp := carol.call(protocol.CmdListRooms, ""); !strings.Contains(resp.Data, "#ops (2 member(s))") {
+		t.Errorf("Unexpected rooms listing:\n%s", resp.Data)
+	}
+	if resp := carol.call(protocol.CmdLeaveRoom, "ops"); resp.Code != protocol.CodeNotFound {
+		t.Errorf("Expected NOT_FOUND leaving a room carol never joined, got %+v", resp)
+	}
+
+	// Switching back to the lobby keeps the room membership
+	alice.call(protocol.CmdJoinRoom, "lobby")
+	alice.call(protocol.CmdMessage, "back in the lobby")
+	if event := carol.readEvent(protocol.EventMessage); event.Room != "" || event.Data != "back in the lobby" {
+		t.Errorf("Expected alice's lobby message, got %+v", event)
+	}
+	if resp := carol.call(protocol.CmdListRooms, ""); !strings.Contains(resp.Data, "#ops (2 member(s))") {
+		t.Errorf("alice left #ops by switching to the lobby:\n%s", resp.Data)
+	}
+
+	// SAY posts to one of your rooms without switching to it
+	bob.readEvent(protocol.EventMessage) // alice's lobby message
+	if resp := alice.call(protocol.CmdSay, "#ops from the lobby"); !resp.Success {
+		t.Fatalf("SAY failed: %+v", resp)
+	}
+	if event := bob.readEvent(protocol.EventMessage); event.Room != "ops" || event.Data != "from the lobby" {
+		t.Errorf("Expected alice's message in ops, got %+v", event)
+	}
+	alice.call(protocol.CmdMessage, "still in the lobby")
+	if event := carol.readEvent(protocol.EventMessage); event.Room != "" || event.Data != "still in the lobby" {
+		t.Errorf("SAY changed alice's active room, got %+v", event)
+	}
+	if resp := carol.call(protocol.CmdSay, "ops let me in"); resp.Code != protocol.CodeNotFound {
+		t.Errorf("Expected NOT_FOUND for SAY to a room carol is not in, got %+v", resp)
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"tcp_server/protocol"
+	"tcp_server/websocket"
+)
+
+// WebSocketHandler returns an HTTP handler that upgrades requests to WebSocket and
+// serves them like TCP clients: each text message carries one protocol message and
+// each reply or event comes back as one text message
+// Browser users share the same users, rooms and history as everyone else
+// Use ServeWebSocket to give the gateway its own listener policy and connection limit
+func (s *Server) WebSocketHandler() http.Handler {
+	return s.webSocketHandler(&listener{name: "websocket", codec: protocol.JSONCodec})
+}
+
+// ServeWebSocket serves WebSocket clients at /ws on l until it is closed
+// The gateway is a listener like the others: cfg sets its name, codec, TLS, auth,
+// connection limit and rate limit, and Drain and Shutdown close it
+func (s *Server) ServeWebSocket(l net.Listener, cfg ListenerConfig) error {
+	if len(cfg.TrustedProxies) > 0 {
+		return fmt.Errorf("websocket listener %s: PROXY headers are not supported", l.Addr())
+	}
+	if cfg.Name == "" {
+		cfg.Name = "websocket"
+	}
+	wl := configureListener(l, cfg)
+
+	// TLS is served by the HTTP server, underneath the WebSocket upgrade
+	tlsConfig := wl.tls
+	wl.tls = nil
+	var httpListener net.Listener = wl
+	if tlsConfig != nil {
+		httpListener = tls.NewListener(wl, tlsConfig)
+	}
+
+	s.trackListener(wl)
+	s.logger.Info("websocket gateway started", "address", l.Addr().String(), "listener", wl.name,
+		"codec", wl.codec.Name(), "tls", tlsConfig != nil)
+
+	mux := http.NewServeMux()
+	mux.Handle("/ws", s.webSocketHandler(wl))
+	err := (&http.Server{Handler: mux}).Serve(httpListener)
+	if errors.Is(err, net.ErrClosed) {
+		// Drain or Shutdown closed the listener
+		return nil
+	}
+	return err
+}
+
+// webSocketHandler upgrades requests and admits them as clients of l
+func (s *Server) webSocketHandler(l *listener) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.draining.Load() {
+			http.Error(w, "Server is draining", http.StatusServiceUnavailable)
+			return
+		}
+
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			s.logger.Debug("websocket handshake failed", "remote_addr", r.RemoteAddr, "error", err)
+			return
+		}
+
+		// Socket options apply to the TCP connection underneath the WebSocket and TLS layers
+		raw := conn.Conn
+		if tlsConn, ok := raw.(*tls.Conn); ok {
+			raw = tlsConn.NetConn()
+		}
+		if err := s.socketOptions.Apply(raw); err != nil {
+			s.logger.Warn("failed to set socket options", "remote_addr", raw.RemoteAddr().String(), "error", err)
+		}
+		s.admit(l, conn, nil)
+	})
+}
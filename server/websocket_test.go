@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"tcp_server/protocol"
+	"tcp_server/websocket"
+	"testing"
+	"time"
+)
+
+func TestWebSocketClient(t *testing.T) {
+	s := startTestServer(t)
+	alice := dialTestServer(t, s)
+	alice.call(protocol.CmdRegister, "alice")
+
+	web := httptest.NewServer(s.WebSocketHandler())
+	t.Cleanup(web.Close)
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(web.URL, "http"), time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	browser := &testConn{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	browser.read()
+
+	if resp := browser.call(protocol.CmdRegister, "browser"); !resp.Success {
+		t.Fatalf("REGISTER over WebSocket failed: %+v", resp)
+	}
+	if event := alice.readEvent(protocol.EventJoin); event.From != "browser" {
+		t.Errorf("Expected browser to join, got %+v", event)
+	}
+
+	// Web and TCP users share rooms and history
+	alice.call(protocol.CmdMessage, "hello web")
+	if event := browser.readEvent(protocol.EventMessage); !strings.Contains(event.Message, "hello web") {
+		t.Errorf("Browser got %+v, want alice's message", event)
+	}
+	if resp := browser.call(protocol.CmdListMessages, ""); !strings.Contains(resp.Data, "hello web") {
+		t.Errorf("LIST_MESSAGES over WebSocket = %q, want the history", resp.Data)
+	}
+	if list := s.describeConnections(); !strings.Contains(list, "via websocket") {
+		t.Errorf("Connection list missing the websocket client:\n%s", list)
+	}
+}
+
+func TestWebSocketListener(t *testing.T) {
+	s := startTestServer(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.ServeWebSocket(l, ListenerConfig{Name: "web", MaxConnections: 1}) }()
+	waitFor(t, func() bool { return len(s.Addrs()) == 2 })
+
+	dial := func() *testConn {
+		conn, err := websocket.Dial("ws://"+l.Addr().String()+"/ws", time.Second)
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return &testConn{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	}
+
+	// The gateway's clients count against its own connection limit
+	first := dial()
+	first.read()
+	if list := s.describeConnections(); !strings.Contains(list, "via web") {
+		t.Errorf("Connection list missing the web client:\n%s", list)
+	}
+	if resp := dial().read(); resp.Code != protocol.CodeRejected {
+		t.Errorf("Second connection = %+v, want REJECTED", resp)
+	}
+
+	// Shutdown closes the gateway like any other listener
+	s.Shutdown()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("ServeWebSocket() error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeWebSocket() still running after Shutdown")
+	}
+}
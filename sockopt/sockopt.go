@@ -0,0 +1,99 @@
+// Package sockopt applies TCP socket options to connections on both ends
+package sockopt
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options are TCP-level settings; zero values keep the Go and OS defaults
+type Options struct {
+	KeepAlive   *net.KeepAliveConfig // Keepalive probes (nil = Go default: enabled, 15s)
+	NoDelay     *bool                // TCP_NODELAY; false enables Nagle's algorithm (nil = Go default: true)
+	ReadBuffer  int                  // SO_RCVBUF in bytes (0 = OS default)
+	WriteBuffer int                  // SO_SNDBUF in bytes (0 = OS default)
+	Linger      *time.Duration       // SO_LINGER; 0 discards unsent data on close (nil = OS default)
+}
+
+// IsZero reports whether no option is set
+func (o Options) IsZero() bool {
+	return o.KeepAlive == nil && o.NoDelay == nil && o.ReadBuffer == 0 && o.WriteBuffer == 0 && o.Linger == nil
+}
+
+// Apply sets the options on a connection
+// Connections that are not TCP (e.g., Unix sockets) are left alone
+func (o Options) Apply(conn net.Conn) error {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok || o.IsZero() {
+		return nil
+	}
+
+	var errs []error
+	if o.KeepAlive != nil {
+		if err := tcp.SetKeepAliveConfig(*o.KeepAlive); err != nil {
+			errs = append(errs, fmt.Errorf("keepalive: %w", err))
+		}
+	}
+	if o.NoDelay != nil {
+		if err := tcp.SetNoDelay(*o.NoDelay); err != nil {
+			errs = append(errs, fmt.Errorf("nodelay: %w", err))
+		}
+	}
+	if o.ReadBuffer > 0 {
+		if err := tcp.SetReadBuffer(o.ReadBuffer); err != nil {
+			errs = append(errs, fmt.Errorf("read buffer: %w", err))
+		}
+	}
+	if o.WriteBuffer > 0 {
+		if err := tcp.SetWriteBuffer(o.WriteBuffer); err != nil {
+			errs = append(errs, fmt.Errorf("write buffer: %w", err))
+		}
+	}
+	if o.Linger != nil {
+		if err := tcp.SetLinger(int(o.Linger.Round(time.Second) / time.Second)); err != nil {
+			errs = append(errs, fmt.Errorf("linger: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseKeepAlive parses "off" or "idle,interval,count" (e.g., "30s,10s,3")
+// Empty parts keep the OS default; an empty string returns nil (Go default)
+func ParseKeepAlive(s string) (*net.KeepAliveConfig, error) {
+	switch s {
+	case "":
+		return nil, nil
+	case "off":
+		return &net.KeepAliveConfig{Enable: false}, nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid keepalive %q: want idle,interval,count", s)
+	}
+	parts = append(parts, "", "")[:3]
+
+	cfg := &net.KeepAliveConfig{Enable: true}
+	for i, dst := range []*time.Duration{&cfg.Idle, &cfg.Interval} {
+		if parts[i] == "" {
+			continue
+		}
+		d, err := time.ParseDuration(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid keepalive duration %q: %w", parts[i], err)
+		}
+		*dst = d
+	}
+	if parts[2] != "" {
+		count, err := strconv.Atoi(parts[2])
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid keepalive count %q", parts[2])
+		}
+		cfg.Count = count
+	}
+	return cfg, nil
+}
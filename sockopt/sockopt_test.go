@@ -0,0 +1,82 @@
+package sockopt
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseKeepAlive(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    *net.KeepAliveConfig
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "off", want: &net.KeepAliveConfig{Enable: false}},
+		{in: "30s,10s,3", want: &net.KeepAliveConfig{Enable: true, Idle: 30 * time.Second, Interval: 10 * time.Second, Count: 3}},
+		{in: "1m", want: &net.KeepAliveConfig{Enable: true, Idle: time.Minute}},
+		{in: ",,5", want: &net.KeepAliveConfig{Enable: true, Count: 5}},
+		{in: "soon", wantErr: true},
+		{in: "1s,1s,x", wantErr: true},
+		{in: "1s,1s,1,1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseKeepAlive(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeepAlive(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("ParseKeepAlive(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	noDelay := false
+	linger := time.Duration(0)
+	opts := Options{
+		KeepAlive:   &net.KeepAliveConfig{Enable: true, Idle: 30 * time.Second, Interval: 5 * time.Second, Count: 3},
+		NoDelay:     &noDelay,
+		ReadBuffer:  64 << 10,
+		WriteBuffer: 64 << 10,
+		Linger:      &linger,
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := opts.Apply(conn); err != nil {
+		t.Errorf("Apply() on TCP error = %v", err)
+	}
+
+	// Unix sockets have no TCP options; Apply leaves them alone
+	ul, err := net.Listen("unix", filepath.Join(t.TempDir(), "s.sock"))
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer ul.Close()
+	uconn, err := net.Dial("unix", ul.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uconn.Close()
+	if err := opts.Apply(uconn); err != nil {
+		t.Errorf("Apply() on unix socket error = %v", err)
+	}
+}
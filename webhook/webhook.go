@@ -0,0 +1,387 @@
+// Package webhook POSTs chat events to external HTTP endpoints
+// Each hook selects events (message in a room, join, keyword match...), signs its
+// payloads with HMAC-SHA256, retries with backoff and records failures in a dead-letter log
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"tcp_server/protocol"
+	"time"
+)
+
+const (
+	defaultAttempts = 5                // Deliveries tried before a payload goes to the dead-letter log
+	queueSize       = 256              // Payloads waiting per hook before new ones are dead-lettered
+	requestTimeout  = 10 * time.Second // Default timeout of one delivery
+)
+
+// Request headers
+const (
+	HeaderEvent     = "X-Chat-Event"     // Event type, e.g. "message"
+	HeaderDelivery  = "X-Chat-Delivery"  // Unique delivery ID, the same across retries
+	HeaderSignature = "X-Chat-Signature" // "sha256=" + hex HMAC of the body with the hook's secret
+)
+
+// Hook is one registered endpoint and the events it wants
+type Hook struct {
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret,omitempty"`       // Signs payloads (empty = unsigned)
+	Events      []string `json:"events,omitempty"`       // Event types (empty = "message")
+	Rooms       []string `json:"rooms,omitempty"`        // Only events in these rooms, "lobby" for the lobby (empty = any)
+	Keywords    []string `json:"keywords,omitempty"`     // Only messages containing one of these, case-insensitive (empty = any)
+	Concurrency int      `json:"concurrency,omitempty"`  // Deliveries in flight at once (0 = 1, which keeps them in order)
+	MaxAttempts int      `json:"max_attempts,omitempty"` // Tries per payload (0 = 5)
+}
+
+// Payload is the JSON body POSTed to a hook
+type Payload struct {
+	Hook      string    `json:"hook"`
+	Event     string    `json:"event"`
+	Seq       uint64    `json:"seq"`
+	Room      string    `json:"room,omitempty"`
+	From      string    `json:"from,omitempty"`
+	Message   string    `json:"message"`
+	Data      string    `json:"data,omitempty"`
+	Keyword   string    `json:"keyword,omitempty"` // The keyword that matched, if the hook has keywords
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DeadLetter is a payload that could not be delivered
+type DeadLetter struct {
+	Hook     string    `json:"hook"`
+	URL      string    `json:"url"`
+	Payload  Payload   `json:"payload"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+// Option configures a Dispatcher
+type Option func(*Dispatcher)
+
+// WithHTTPClient sets the client used for deliveries (default: 10s timeout)
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// WithLogger sets the logger for delivery failures (default slog.Default())
+func WithLogger(logger *slog.Logger) Option {
+	return func(d *Dispatcher) {
+		d.logger = logger
+	}
+}
+
+// WithDeadLetterLog appends undeliverable payloads to w as JSON lines
+func WithDeadLetterLog(w io.Writer) Option {
+	return func(d *Dispatcher) {
+		d.deadLetters = w
+	}
+}
+
+// WithBackoff sets the delay before the first retry and the cap it doubles up to
+// (default 1s and 1m)
+func WithBackoff(initial, max time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.initialDelay = initial
+		d.maxDelay = max
+	}
+}
+
+// Dispatcher delivers events to hooks in the background
+type Dispatcher struct {
+	hooks        []*hook
+	client       *http.Client
+	logger       *slog.Logger
+	initialDelay time.Duration
+	maxDelay     time.Duration
+
+	deadMu      sync.Mutex
+	deadLetters io.Writer // nil = failures are only logged
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// hook is a registered hook with its queue
+type hook struct {
+	Hook
+	events   map[string]bool
+	rooms    map[string]bool
+	keywords []string
+	queue    chan Payload
+}
+
+// New validates the hooks and starts their delivery workers
+// Feed it events with Handle, e.g. server.Subscribe(dispatcher.Handle)
+func New(hooks []Hook, opts ...Option) (*Dispatcher, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		client:       &http.Client{Timeout: requestTimeout},
+		logger:       slog.Default(),
+		initialDelay: time.Second,
+		maxDelay:     time.Minute,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	for _, cfg := range hooks {
+		h, err := newHook(cfg)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		d.hooks = append(d.hooks, h)
+	}
+
+	for _, h := range d.hooks {
+		for range h.Concurrency {
+			d.workers.Add(1)
+			go d.worker(h)
+		}
+	}
+	return d, nil
+}
+
+// newHook validates a hook and fills in defaults
+func newHook(cfg Hook) (*hook, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook %q: invalid URL %q", cfg.Name, cfg.URL)
+	}
+	if cfg.Name == "" {
+		cfg.Name = u.Host
+	}
+	if len(cfg.Events) == 0 {
+		cfg.Events = []string{protocol.EventMessage}
+	}
+	cfg.Concurrency = max(cfg.Concurrency, 1)
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultAttempts
+	}
+
+	h := &hook{
+		Hook:   cfg,
+		events: make(map[string]bool),
+		rooms:  make(map[string]bool),
+		queue:  make(chan Payload, queueSize),
+	}
+	for _, event := range cfg.Events {
+		h.events[event] = true
+	}
+	for _, room := range cfg.Rooms {
+		room = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(room), "#"))
+		if room == "lobby" {
+			room = ""
+		}
+		h.rooms[room] = true
+	}
+	for _, keyword := range cfg.Keywords {
+		h.keywords = append(h.keywords, strings.ToLower(keyword))
+	}
+	return h, nil
+}
+
+// match reports whether the hook wants an event and which keyword matched
+func (h *hook) match(event *protocol.Response) (keyword string, ok bool) {
+	if !h.events[event.Event] {
+		return "", false
+	}
+	if len(h.rooms) > 0 && !h.rooms[event.Room] {
+		return "", false
+	}
+	if len(h.keywords) == 0 {
+		return "", true
+	}
+	text := strings.ToLower(event.Data)
+	for _, keyword := range h.keywords {
+		if strings.Contains(text, keyword) {
+			return keyword, true
+		}
+	}
+	return "", false
+}
+
+// Handle queues an event for every hook that wants it
+// It never blocks: a hook whose queue is full gets the payload dead-lettered instead
+func (d *Dispatcher) Handle(event *protocol.Response) {
+	if d.ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, h := range d.hooks {
+		keyword, ok := h.match(event)
+		if !ok {
+			continue
+		}
+
+		payload := Payload{
+			Hook:      h.Name,
+			Event:     event.Event,
+			Seq:       event.Seq,
+			Room:      event.Room,
+			From:      event.From,
+			Message:   event.Message,
+			Data:      event.Data,
+			Keyword:   keyword,
+			Timestamp: now,
+		}
+		select {
+		case h.queue <- payload:
+		default:
+			d.deadLetter(h, payload, 0, fmt.Errorf("queue full"))
+		}
+	}
+}
+
+// Close stops delivering; queued and retrying payloads go to the dead-letter log
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.workers.Wait()
+}
+
+// worker delivers a hook's payloads until the dispatcher is closed
+func (d *Dispatcher) worker(h *hook) {
+	defer d.workers.Done()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			for {
+				select {
+				case payload := <-h.queue:
+					d.deadLetter(h, payload, 0, d.ctx.Err())
+				default:
+					return
+				}
+			}
+		case payload := <-h.queue:
+			d.deliver(h, payload)
+		}
+	}
+}
+
+// deliver POSTs a payload, retrying failures with exponential backoff
+func (d *Dispatcher) deliver(h *hook, payload Payload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		d.deadLetter(h, payload, 0, err)
+		return
+	}
+	delivery := strconv.FormatUint(payload.Seq, 10) + "-" + h.Name
+
+	delay := d.initialDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := d.post(h, body, payload.Event, delivery)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= h.MaxAttempts {
+			d.deadLetter(h, payload, attempt, err)
+			return
+		}
+		d.logger.Warn("webhook delivery failed, retrying", "hook", h.Name, "attempt", attempt, "delay", delay, "error", err)
+
+		select {
+		case <-d.ctx.Done():
+			d.deadLetter(h, payload, attempt, err)
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, d.maxDelay)
+	}
+}
+
+// post makes one delivery attempt
+// It reports whether a failure is worth retrying (network errors, 429 and 5xx)
+func (d *Dispatcher) post(h *hook, body []byte, event, delivery string) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, delivery)
+	if h.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(h.Secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %s", resp.Status)
+	default:
+		return false, fmt.Errorf("status %s", resp.Status)
+	}
+}
+
+// deadLetter records a payload that will not be delivered
+func (d *Dispatcher) deadLetter(h *hook, payload Payload, attempts int, err error) {
+	d.logger.Error("webhook delivery abandoned", "hook", h.Name, "seq", payload.Seq, "attempts", attempts, "error", err)
+
+	d.deadMu.Lock()
+	defer d.deadMu.Unlock()
+	if d.deadLetters == nil {
+		return
+	}
+
+	entry := DeadLetter{Hook: h.Name, URL: h.URL, Payload: payload, Attempts: attempts, Error: err.Error(), Time: time.Now()}
+	line, _ := json.Marshal(entry)
+	d.deadLetters.Write(append(line, '\n'))
+}
+
+// Sign returns the signature header value for a body: "sha256=" + hex HMAC-SHA256
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header against a body in constant time
+// Receivers use it to make sure a payload came from the chat server
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// LoadFile reads hooks from a JSON file holding an array of Hook objects
+func LoadFile(path string) ([]Hook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var hooks []Hook
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return hooks, nil
+}
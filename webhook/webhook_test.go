@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"tcp_server/protocol"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for the dispatcher's workers
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newTestDispatcher creates a dispatcher with fast retries that is closed after the test
+func newTestDispatcher(t *testing.T, hooks []Hook, opts ...Option) *Dispatcher {
+	t.Helper()
+
+	opts = append([]Option{WithLogger(slog.New(slog.DiscardHandler)), WithBackoff(time.Millisecond, 10*time.Millisecond)}, opts...)
+	d, err := New(hooks, opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(d.Close)
+	return d
+}
+
+// roomMessage builds a message event like the server delivers
+func roomMessage(seq uint64, room, from, text string) *protocol.Response {
+	event := protocol.NewEvent(protocol.EventMessage, from, from+": "+text, text)
+	event.Room = room
+	event.Seq = seq
+	return event
+}
+
+func TestDeliverSignedAndFiltered(t *testing.T) {
+	received := make(chan Payload, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify("s3cret", body, r.Header.Get(HeaderSignature)) {
+			t.Errorf("Bad signature %q", r.Header.Get(HeaderSignature))
+		}
+		if r.Header.Get(HeaderEvent) == "" || r.Header.Get(HeaderDelivery) == "" {
+			t.Errorf("Missing headers: %v", r.Header)
+		}
+		var payload Payload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Unmarshal() error = %v", err)
+		}
+		received <- payload
+	}))
+	defer srv.Close()
+
+	d := newTestDispatcher(t, []Hook{
+		{Name: "incidents", URL: srv.URL, Secret: "s3cret", Rooms: []string{"#incidents"}, Keywords: []string{"SEV1"}},
+		{Name: "joins", URL: srv.URL, Secret: "s3cret", Events: []string{protocol.EventJoin}},
+	})
+
+	d.Handle(roomMessage(1, "ops", "alice", "sev1 in ops"))                  // Wrong room
+	d.Handle(roomMessage(2, "incidents", "alice", "all good"))               // No keyword
+	d.Handle(roomMessage(3, "incidents", "alice", "Sev1: db is down"))       // Match
+	d.Handle(protocol.NewEvent(protocol.EventJoin, "bob", "bob joined", "")) // Join hook
+
+	got := map[string]Payload{}
+	for range 2 {
+		select {
+		case p := <-received:
+			got[p.Hook] = p
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out, got %+v", got)
+		}
+	}
+	if p := got["incidents"]; p.Seq != 3 || p.Keyword != "sev1" || p.Room != "incidents" || p.Data != "Sev1: db is down" {
+		t.Errorf("Incident payload = %+v", p)
+	}
+	if p := got["joins"]; p.Event != protocol.EventJoin || p.From != "bob" {
+		t.Errorf("Join payload = %+v", p)
+	}
+	select {
+	case p := <-received:
+		t.Errorf("Unexpected delivery %+v", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	var calls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer flaky.Close()
+	gone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer gone.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	var dead syncBuffer
+	d := newTestDispatcher(t, []Hook{
+		{Name: "flaky", URL: flaky.URL},
+		{Name: "gone", URL: gone.URL},
+		{Name: "down", URL: down.URL, MaxAttempts: 2},
+	}, WithDeadLetterLog(&dead))
+	d.Handle(roomMessage(7, "", "alice", "hello"))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for (strings.Count(dead.String(), "\n") < 2 || calls.Load() < 3) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The flaky hook succeeds on its third attempt
+	if n := calls.Load(); n != 3 {
+		t.Errorf("flaky hook called %d times, want 3", n)
+	}
+
+	// A 4xx is not retried; a 5xx is retried until MaxAttempts
+	letters := map[string]DeadLetter{}
+	for _, line := range strings.Split(strings.TrimSpace(dead.String()), "\n") {
+		var letter DeadLetter
+		if err := json.Unmarshal([]byte(line), &letter); err != nil {
+			t.Fatalf("Unmarshal(%q) error = %v", line, err)
+		}
+		letters[letter.Hook] = letter
+	}
+	if l, ok := letters["gone"]; !ok || l.Attempts != 1 || l.Payload.Seq != 7 {
+		t.Errorf("gone dead letter = %+v", l)
+	}
+	if l, ok := letters["down"]; !ok || l.Attempts != 2 {
+		t.Errorf("down dead letter = %+v", l)
+	}
+	if _, ok := letters["flaky"]; ok {
+		t.Error("flaky hook should not be dead-lettered")
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	var done sync.WaitGroup
+	done.Add(6)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer done.Done()
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		inFlight.Add(-1)
+	}))
+	defer srv.Close()
+
+	d := newTestDispatcher(t, []Hook{{Name: "slow", URL: srv.URL, Concurrency: 2}})
+	for i := range 6 {
+		d.Handle(roomMessage(uint64(i+1), "", "alice", "hi"))
+	}
+	done.Wait()
+
+	if p := peak.Load(); p != 2 {
+		t.Errorf("Peak concurrent deliveries = %d, want 2", p)
+	}
+}
+
+func TestNewRejectsBadURL(t *testing.T) {
+	if _, err := New([]Hook{{Name: "bad", URL: "ftp://example.com"}}); err == nil {
+		t.Error("Expected an error for a non-HTTP URL")
+	}
+}
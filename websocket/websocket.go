@@ -0,0 +1,368 @@
+// Package websocket implements the RFC 6455 handshake and framing on top of net/http
+// A Conn carries one line of the chat protocol per text message, so the server can
+// treat browsers exactly like TCP clients
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acceptGUID is appended to the client's key to compute Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// MaxMessageSize is the largest message a Conn accepts; bigger ones close the connection
+const MaxMessageSize = 64 * 1024
+
+// Frame opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// Close status codes
+const (
+	CloseNormal        = 1000
+	CloseProtocolError = 1002
+	CloseTooBig        = 1009
+)
+
+// ErrHandshake is returned when a request or response is not a valid WebSocket handshake
+var ErrHandshake = errors.New("websocket: bad handshake")
+
+// Conn is a WebSocket connection presented as a byte stream of newline-terminated
+// messages: Read returns each received message followed by "\n", and each Write is
+// sent as one text message without its trailing newline
+type Conn struct {
+	net.Conn
+	reader   *bufio.Reader
+	isClient bool // Clients mask their frames, servers must not
+
+	readMu  sync.Mutex
+	pending []byte // Rest of the current message not yet returned by Read
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+}
+
+// acceptKey computes Sec-WebSocket-Accept for a Sec-WebSocket-Key
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains reports whether a comma-separated header has the token (case-insensitive)
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade completes the server side of the handshake and takes over the connection
+// On failure it has already replied with an HTTP error
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet:
+		http.Error(w, "WebSocket handshake must use GET", http.StatusMethodNotAllowed)
+		return nil, ErrHandshake
+	case !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket"):
+		http.Error(w, "Expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, ErrHandshake
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, ErrHandshake
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, ErrHandshake
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, err
+	}
+
+	// The hijacked connection may still carry the HTTP server's deadlines
+	conn.SetDeadline(time.Time{})
+
+	// The handshake is written straight to the hijacked connection
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{Conn: conn, reader: rw.Reader}, nil
+}
+
+// Dial opens a client connection to a ws:// URL
+func Dial(rawURL string, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+
+	conn, err := net.DialTimeout("tcp", host, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    u,
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-Websocket-Key":     {key},
+			"Sec-Websocket-Version": {"13"},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %s", ErrHandshake, resp.Status)
+	}
+	return &Conn{Conn: conn, reader: reader, isClient: true}, nil
+}
+
+// Read returns received messages, each followed by "\n"
+// Pings are answered and a close frame ends the stream with io.EOF
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for len(c.pending) == 0 {
+		message, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.pending = append(message, '\n')
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// readMessage reads frames until a whole data message has arrived
+func (c *Conn) readMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, true, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.closeWith(CloseNormal, "")
+			return nil, io.EOF
+		case opText, opBinary:
+			if started {
+				return nil, c.fail(CloseProtocolError, "new message before the previous one ended")
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				return nil, c.fail(CloseProtocolError, "continuation without a message")
+			}
+		default:
+			return nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", opcode))
+		}
+
+		if len(message)+len(payload) > MaxMessageSize {
+			return nil, c.fail(CloseTooBig, "message too big")
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads and unmasks one frame
+func (c *Conn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7f)
+
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	if masked == c.isClient {
+		return false, 0, nil, c.fail(CloseProtocolError, "wrong frame masking")
+	}
+	if opcode >= opClose && (!fin || length > 125) {
+		return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > MaxMessageSize {
+		return false, 0, nil, c.fail(CloseTooBig, "frame too big")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// Write sends b as one text message, dropping a trailing newline
+func (c *Conn) Write(b []byte) (int, error) {
+	payload := b
+	if n := len(payload); n > 0 && payload[n-1] == '\n' {
+		payload = payload[:n-1]
+	}
+	if err := c.writeFrame(opText, true, payload); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// writeFrame sends one frame, masked if this is the client side
+// fin is false for all but the last frame of a fragmented message
+func (c *Conn) writeFrame(opcode byte, fin bool, payload []byte) error {
+	frame := []byte{opcode, 0}
+	if fin {
+		frame[0] |= 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame[1] = byte(n)
+	case n <= 0xffff:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if c.isClient {
+		frame[1] |= 0x80
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range payload {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// fail closes the connection with a status code and returns the reason as an error
+func (c *Conn) fail(code int, reason string) error {
+	c.closeWith(code, reason)
+	return fmt.Errorf("websocket: %s", reason)
+}
+
+// closeWith sends a close frame once, best effort
+func (c *Conn) closeWith(code int, reason string) {
+	c.closeOnce.Do(func() {
+		payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+		payload = append(payload, reason...)
+		c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+		c.writeFrame(opClose, true, payload)
+	})
+}
+
+// Close sends a normal close frame and closes the connection
+func (c *Conn) Close() error {
+	c.closeWith(CloseNormal, "")
+	return c.Conn.Close()
+}
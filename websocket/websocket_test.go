@@ -0,0 +1,92 @@
+package websocket
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startEcho serves a WebSocket endpoint that writes every message back
+func startEcho(t *testing.T) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(line))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestEcho(t *testing.T) {
+	conn, err := Dial(startEcho(t), time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	// Short, 16-bit and fragmented messages all arrive as one line each
+	long := strings.Repeat("x", 300)
+	conn.Write([]byte("hello\n"))
+	conn.Write([]byte(long + "\n"))
+	conn.writeFrame(opText, false, []byte("frag"))
+	conn.writeFrame(opPing, true, []byte("are you there"))
+	conn.writeFrame(opContinuation, true, []byte("mented"))
+
+	for _, want := range []string{"hello", long, "fragmented"} {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() error = %v", err)
+		}
+		if got := strings.TrimSuffix(line, "\n"); got != want {
+			t.Errorf("Echo = %q, want %q", got, want)
+		}
+	}
+
+	// Closing gets a close frame back and ends the stream
+	conn.closeWith(CloseNormal, "")
+	if _, err := reader.ReadString('\n'); err != io.EOF {
+		t.Errorf("ReadString() after close error = %v, want EOF", err)
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Upgrade(w, r)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Plain GET status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455 section 1.3
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("acceptKey() = %q", got)
+	}
+}